@@ -1,39 +1,210 @@
 package webcam
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image"
+	"log"
 	"os"
+	"time"
 )
 
 func FindWebcams() ([]WebcamInfo, error) {
-	return findWebcams()
+	return findWebcams(defaultLayout)
 }
 
 func OpenWebcam(path string) (Webcam, error) {
-	return openWebcam(path)
+	return openWebcam(path, defaultLayout)
+}
+
+// OpenWebcamBy opens the first webcam matching all non-empty fields of the
+// selector, which allows to address a camera independently of its /dev/videoN
+// number.
+func OpenWebcamBy(selector WebcamSelector) (Webcam, error) {
+	return openWebcamBy(selector, defaultLayout)
+}
+
+// StreamSnapshotsResilient streams like Webcam.StreamSnapshots, but when the
+// device gets lost (e.g. an USB camera resets), it waits for the same physical
+// camera to reappear, reopens it, restores the frame rate and controls the
+// webcam had when the stream started and resumes streaming. Every such interruption
+// is reported on gapChan, which may be nil. The stream takes over the webcam and
+// closes it (and any reopened one) when it finishes.
+func StreamSnapshotsResilient(cam Webcam, framesize *DiscreteFrameSize, options ReconnectOptions, snapChan chan Snapshot, gapChan chan StreamGap, errChan chan error, stop chan bool) {
+	streamSnapshotsResilient(cam, framesize, options, OpenWebcamBy, snapChan, gapChan, errChan, stop)
+}
+
+// LoadProfile reads a profile stored as JSON.
+func LoadProfile(path string) (Profile, error) {
+	return loadProfile(path)
+}
+
+// NewDeviceReport collects everything the webcam tells about itself into a
+// structure that can be stored as JSON (or YAML) and loaded back.
+func NewDeviceReport(cam Webcam) (DeviceReport, error) {
+	return newDeviceReport(cam)
+}
+
+// Watch reports video devices being plugged in and out until the context is
+// cancelled. The returned channel is closed once watching ends. When the kernel
+// drops uevents of a burst, the devices are rescanned and the changes reported.
+func Watch(ctx context.Context) (<-chan DeviceEvent, error) {
+	return watch(ctx, defaultLayout)
+}
+
+// NewPTZ returns the pan, tilt and zoom controller of the webcam. It fails when
+// the webcam has none of these axes.
+func NewPTZ(cam Webcam) (PTZ, error) {
+	return newPTZ(cam)
+}
+
+// Autofocus focuses a webcam with a manual focus control (V4L2_CID_FOCUS_ABSOLUTE).
+// It switches continuous autofocus off, streams frames of the frame size (the
+// current one when nil), sweeps the focus over its range scoring every position,
+// refines around the sharpest one and leaves the webcam focused there. When the
+// sweep fails, the focus position and autofocus are restored. The webcam must
+// not be streaming.
+func Autofocus(cam Webcam, frameSize *DiscreteFrameSize, options AutofocusOptions) (FocusResult, error) {
+	return autofocus(cam, frameSize, options)
+}
+
+// Sharpness scores the focus of a snapshot of a GREY, YUYV, UYVY or 4:2:0 YUV
+// format by the variance of the Laplacian of its luma within the region of
+// interest (the whole frame when empty). Scores only compare frames of the same
+// scene, the higher the sharper.
+func Sharpness(snap Snapshot, frameSize DiscreteFrameSize, roi image.Rectangle) (float64, error) {
+	return sharpness(snap, frameSize, roi)
+}
+
+// NewExposureController returns a controller of the exposure, gain and white
+// balance of a webcam lacking them, which adjusts them from the frames of the
+// given frame size it is fed. It switches the automatic modes of the webcam off.
+func NewExposureController(cam Webcam, frameSize DiscreteFrameSize, options ExposureOptions) (ExposureController, error) {
+	return newExposureController(cam, frameSize, options)
+}
+
+// SetLogger sets the logger of the module, webcams without a logger of their
+// own log through it. Nothing is logged by default, nil silences logging again.
+func SetLogger(logger Logger) {
+	setLogger(logger)
+}
+
+// NewStdLogger returns a logger printing records of at least the given level
+// through a standard logger, one line per record. A nil logger prints like the
+// standard logger of the log package.
+func NewStdLogger(logger *log.Logger, min Level) Logger {
+	return newStdLogger(logger, min)
 }
 
 //-------------------------------------------------------------------------
 //MAIN INTERFACE
 //-------------------------------------------------------------------------
 
+// WebcamInfo identifies a webcam. Name is the driver name, the rest comes from
+// the capabilities of the device and from sysfs. VendorID, ProductID and Serial
+// are known only for USB devices, ByID and ByPath only when udev created
+// the links in /dev/v4l.
 type WebcamInfo struct {
-	File *os.File
-	Name string
+	Path      string `json:"path" yaml:"path"`
+	Name      string `json:"name" yaml:"name"`
+	Card      string `json:"card" yaml:"card"`
+	BusInfo   string `json:"bus_info" yaml:"bus_info"`
+	Index     uint32 `json:"index" yaml:"index"`
+	VendorID  uint16 `json:"vendor_id" yaml:"vendor_id"`
+	ProductID uint16 `json:"product_id" yaml:"product_id"`
+	Serial    string `json:"serial,omitempty" yaml:"serial,omitempty"`
+	ByID      string `json:"by_id,omitempty" yaml:"by_id,omitempty"`
+	ByPath    string `json:"by_path,omitempty" yaml:"by_path,omitempty"`
 }
 
 func (i WebcamInfo) String() string {
-	return fmt.Sprintf("Webcam[%s:%s]", i.Name, i.File.Name())
+	return fmt.Sprintf("Webcam[%s:%s]", i.Name, i.Path)
+}
+
+type WebcamSelector struct {
+	Path      string
+	BusInfo   string
+	VendorID  uint16
+	ProductID uint16
+	Serial    string
+	ByID      string
+	ByPath    string
+}
+
+func (s WebcamSelector) Matches(info WebcamInfo) bool {
+	return matchesField(s.Path, info.Path) &&
+		matchesField(s.BusInfo, info.BusInfo) &&
+		(s.VendorID == 0 || s.VendorID == info.VendorID) &&
+		(s.ProductID == 0 || s.ProductID == info.ProductID) &&
+		matchesField(s.Serial, info.Serial) &&
+		matchesLink(s.ByID, info.ByID) &&
+		matchesLink(s.ByPath, info.ByPath)
 }
 
+func (s WebcamSelector) String() string {
+	return fmt.Sprintf("WebcamSelector[path=%s,bus_info=%s,vendor=%04x,product=%04x,serial=%s,by_id=%s,by_path=%s]", s.Path, s.BusInfo, s.VendorID, s.ProductID, s.Serial, s.ByID, s.ByPath)
+}
+
+var ErrBusyStreaming = errors.New("Device is streaming, the operation would interfere with the stream.")
+var ErrDeviceClosed = errors.New("Device has been closed.")
+var ErrUnsupportedBufferType = errors.New("Device does not support the buffer type.")
+
+// Webcam is safe for concurrent use by multiple goroutines. Access to the device
+// is serialized; operations that would reconfigure the device while
+// StreamSnapshots or StreamFrames is running fail with ErrBusyStreaming, and any operation on a
+// closed webcam fails with ErrDeviceClosed.
 type Webcam interface {
 	File() *os.File
+	Info() WebcamInfo
 	QueryCapabilities() (Capabilities, error)
 	QueryFormats() ([]PixelFormat, error)
+	QueryFormatsOf(bufType BufferType) ([]PixelFormat, error)
 	QueryFrameSizes(f PixelFormat) (FrameSizes, error)
+	QueryFrameIntervals(frameSize DiscreteFrameSize) (FrameIntervals, error)
 	DiscreteFrameSize() DiscreteFrameSizeSelector
+	CurrentFrameSize() (DiscreteFrameSize, error)
+	FrameInterval() (Fraction, error)
+	SetFrameInterval(interval Fraction) (Fraction, error)
 	TakeSnapshot(frameSize *DiscreteFrameSize) (Snapshot, error)
+	// SetSnapshotReadIO forces TakeSnapshot and StreamSnapshots to read frames by
+	// read(), as StreamOptions.ReadIO does for StreamFrames.
+	SetSnapshotReadIO(readIO bool) error
 	StreamSnapshots(framesize *DiscreteFrameSize, snapChan chan Snapshot, errChan chan error, stop chan bool)
+	StreamFrames(framesize *DiscreteFrameSize, options StreamOptions, frameChan chan Frame, errChan chan error, stop chan bool)
+	// Stats returns the statistics of the running stream, or of the last one once
+	// it finished.
+	Stats() StreamStats
+	// Totals returns the statistics of all the streams since the webcam was opened.
+	Totals() StreamTotals
+	// Err returns ErrDeviceClosed once the webcam is closed, otherwise the error the
+	// last stream failed with (nil when it finished cleanly); it issues no ioctl.
+	Err() error
+	// SetLogger routes records of the webcam to its own logger, nil goes back to the
+	// logger of the module.
+	SetLogger(logger Logger)
+	// SubscribeEvents delivers events of the given types on the returned channel
+	// (e.g. EVENT_CTRL when another application changes a control), a running
+	// stream dispatches them from its poll loop. Events are dropped when the
+	// channel is full.
+	SubscribeEvents(types ...EventType) (<-chan Event, error)
+	QueryControls() ([]Control, error)
+	GetControl(id ControlID) (int32, error)
+	SetControl(id ControlID, value int32) error
+	// QueryExtControls lists the controls of a class (all of them for 0) including
+	// 64-bit, string, array and compound ones.
+	QueryExtControls(class ControlClass) ([]ExtControl, error)
+	GetExtControls(ids ...ControlID) ([]ControlValue, error)
+	// SetExtControls sets all the values in one call, so that the driver applies
+	// them atomically. It fails with an *ExtControlsError.
+	SetExtControls(values ...ControlValue) error
+	// TryExtControls only validates the values and returns them as the driver
+	// would adjust them. It fails with an *ExtControlsError.
+	TryExtControls(values ...ControlValue) ([]ControlValue, error)
+	ApplyProfile(profile Profile) (ProfileReport, error)
+	CaptureProfile() (Profile, error)
+	// Close stops a running stream, unsubscribes from events and closes the
+	// channels of SubscribeEvents.
 	Close() error
 }
 
@@ -69,6 +240,52 @@ type Capabilities interface {
 type PixelFormat interface {
 	Name() string
 	Description() string
+	FourCC() FourCC
+	Compressed() bool
+	// Emulated formats are converted in software by libv4l, not produced by the device.
+	Emulated() bool
+	BufferType() BufferType
+}
+
+// BufferType is the kind of stream a format belongs to, see the BUF_TYPE_* constants.
+type BufferType uint32
+
+// FourCC is the four character code identifying a pixel format, e.g. "YUYV" or "MJPG".
+// The highest bit flags big-endian variants of a format.
+type FourCC uint32
+
+// FormatInfo describes the layout of a pixel format. BitsPerPixel is the average
+// over all planes and is 0 for compressed formats.
+type FormatInfo struct {
+	FourCC       FourCC `json:"fourcc" yaml:"fourcc"`
+	Name         string `json:"name" yaml:"name"`
+	Compressed   bool   `json:"compressed" yaml:"compressed"`
+	BitsPerPixel int    `json:"bits_per_pixel,omitempty" yaml:"bits_per_pixel,omitempty"`
+	Planes       int    `json:"planes" yaml:"planes"`
+	Subsampling  string `json:"subsampling,omitempty" yaml:"subsampling,omitempty"`
+}
+
+// ParseFourCC parses a code like "YUYV", "Y10" or "Y16 -BE". Codes shorter than
+// four characters are padded with spaces.
+func ParseFourCC(s string) (FourCC, error) {
+	return parseFourCC(s)
+}
+
+// RegisterFormat makes a pixel format known by its name and metadata, e.g. a
+// vendor specific one. A format registered with an already known code replaces it.
+func RegisterFormat(info FormatInfo) error {
+	return registerFormat(info)
+}
+
+// LookupFormat returns the metadata of a known pixel format.
+func LookupFormat(code FourCC) (FormatInfo, bool) {
+	return lookupFormat(code)
+}
+
+// NewPixelFormat builds a pixel format from its code, so that a frame size can
+// be selected without querying the webcam formats first.
+func NewPixelFormat(code FourCC) PixelFormat {
+	return newPixelFormat(code, "")
 }
 
 //---------------------------------------------------------------------------------------
@@ -104,6 +321,44 @@ func (s StepwiseFrameSize) String() string {
 	return fmt.Sprintf("StepwiseFrame[min_w=%d,max_w=%d,min_h=%d,max_height=%d,step_w=%d,step_h=%d]", s.MinWidth, s.MaxWidth, s.MinHeight, s.MaxHeight, s.StepWidth, s.StepHeight)
 }
 
+//----------------------------------------------------------------------------------------
+//FRAME INTERVALS
+//----------------------------------------------------------------------------------------
+
+// Fraction is a frame interval in seconds, e.g. 1/30 for 30 frames per second.
+type Fraction struct {
+	Numerator   uint32 `json:"numerator" yaml:"numerator"`
+	Denominator uint32 `json:"denominator" yaml:"denominator"`
+}
+
+func (f Fraction) FPS() float64 {
+	if f.Numerator == 0 {
+		return 0
+	}
+	return float64(f.Denominator) / float64(f.Numerator)
+}
+
+func (f Fraction) String() string {
+	return fmt.Sprintf("%d/%d", f.Numerator, f.Denominator)
+}
+
+type FrameIntervals interface {
+	Discrete() []Fraction
+	Stepwise() []StepwiseFrameInterval
+}
+
+// StepwiseFrameInterval describes a range of supported frame intervals, a
+// continuous range has the step 1/1.
+type StepwiseFrameInterval struct {
+	Min  Fraction `json:"min" yaml:"min"`
+	Max  Fraction `json:"max" yaml:"max"`
+	Step Fraction `json:"step" yaml:"step"`
+}
+
+func (s StepwiseFrameInterval) String() string {
+	return fmt.Sprintf("StepwiseFrameInterval[min=%v,max=%v,step=%v]", s.Min, s.Max, s.Step)
+}
+
 //----------------------------------------------------------------------------------------
 //FRAME SIZE SELECTOR
 //----------------------------------------------------------------------------------------
@@ -116,10 +371,631 @@ type DiscreteFrameSizeSelector interface {
 	Select() (DiscreteFrameSize, error)
 }
 
+//----------------------------------------------------------------------------------------
+//CONTROLS
+//----------------------------------------------------------------------------------------
+
+type ControlID uint32
+
+type ControlType uint32
+
+type ControlMenuItem struct {
+	Index uint32 `json:"index" yaml:"index"`
+	Name  string `json:"name" yaml:"name"`
+	Value int64  `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+type Control struct {
+	ID      ControlID         `json:"id" yaml:"id"`
+	Name    string            `json:"name" yaml:"name"`
+	Type    ControlType       `json:"type" yaml:"type"`
+	Minimum int64             `json:"minimum" yaml:"minimum"`
+	Maximum int64             `json:"maximum" yaml:"maximum"`
+	Step    uint64            `json:"step" yaml:"step"`
+	Default int64             `json:"default" yaml:"default"`
+	Flags   uint32            `json:"flags" yaml:"flags"`
+	Menu    []ControlMenuItem `json:"menu,omitempty" yaml:"menu,omitempty"`
+}
+
+func (c Control) String() string {
+	return fmt.Sprintf("Control[%s,%v,min=%d,max=%d,step=%d,default=%d]", c.Name, c.Type, c.Minimum, c.Maximum, c.Step, c.Default)
+}
+
+// ControlClass groups controls, e.g. CTRL_CLASS_CAMERA or CTRL_CLASS_JPEG.
+type ControlClass uint32
+
+// ExtControl is a control as VIDIOC_QUERY_EXT_CTRL reports it. Array and compound
+// controls consist of Elems elements of ElemSize bytes, arranged in Dims.
+type ExtControl struct {
+	Control  `yaml:",inline"`
+	Elems    uint32   `json:"elems" yaml:"elems"`
+	ElemSize uint32   `json:"elem_size" yaml:"elem_size"`
+	Dims     []uint32 `json:"dims,omitempty" yaml:"dims,omitempty"`
+}
+
+// ControlValue is the value of a control in extended control calls. Value holds
+// integer, boolean, menu, bitmask and 64-bit controls, String string controls and
+// Payload the raw bytes of arrays and compound controls.
+type ControlValue struct {
+	ID      ControlID `json:"id" yaml:"id"`
+	Value   int64     `json:"value,omitempty" yaml:"value,omitempty"`
+	String  string    `json:"string,omitempty" yaml:"string,omitempty"`
+	Payload []byte    `json:"payload,omitempty" yaml:"payload,omitempty"`
+}
+
+// ExtControlsError tells which control made an extended control call fail. Index
+// is the position of the control among the values, -1 when the driver failed
+// before processing any of them (e.g. because validation failed), in which case
+// no control has been changed.
+type ExtControlsError struct {
+	Index int
+	ID    ControlID
+	Err   error
+}
+
+//----------------------------------------------------------------------------------------
+//PAN, TILT AND ZOOM
+//----------------------------------------------------------------------------------------
+
+type PTZAxis int
+
+// PTZAxisInfo tells how an axis can be moved: to a position within the range of
+// the Absolute control, by a distance with the Relative control and continuously
+// at a speed of the Speed control. Controls the webcam lacks are nil.
+type PTZAxisInfo struct {
+	Axis     PTZAxis  `json:"axis" yaml:"axis"`
+	Absolute *Control `json:"absolute,omitempty" yaml:"absolute,omitempty"`
+	Relative *Control `json:"relative,omitempty" yaml:"relative,omitempty"`
+	Speed    *Control `json:"speed,omitempty" yaml:"speed,omitempty"`
+}
+
+// PTZPosition is a position in the units of the absolute controls: arc seconds
+// for pan and tilt, a driver specific unit for zoom. Axes that are nil keep their
+// position, as do axes the webcam cannot move to a position. With sets an axis,
+// e.g. PTZPosition{}.With(PAN, 36000) pans without tilting or zooming.
+type PTZPosition struct {
+	Pan  *int32 `json:"pan,omitempty" yaml:"pan,omitempty"`
+	Tilt *int32 `json:"tilt,omitempty" yaml:"tilt,omitempty"`
+	Zoom *int32 `json:"zoom,omitempty" yaml:"zoom,omitempty"`
+}
+
+// PTZ moves a webcam through its pan, tilt and zoom controls. Positions outside
+// the ranges of axes are clamped. MoveContinuous moves an axis at a signed speed
+// until Stop is called or the speed is set to 0. MoveSmooth interpolates the
+// position over the duration and blocks until the move finishes, any other move
+// or Stop cancels it. Presets are named positions kept in memory, SavePresets and
+// LoadPresets store them as JSON.
+type PTZ interface {
+	Axes() []PTZAxisInfo
+	Position() (PTZPosition, error)
+	MoveAbsolute(position PTZPosition) error
+	MoveRelative(axis PTZAxis, delta int32) error
+	MoveContinuous(axis PTZAxis, speed int32) error
+	MoveSmooth(position PTZPosition, duration time.Duration) error
+	Stop() error
+	SavePreset(name string) error
+	GotoPreset(name string, duration time.Duration) error
+	DeletePreset(name string)
+	Presets() map[string]PTZPosition
+	SavePresets(path string) error
+	LoadPresets(path string) error
+}
+
+//----------------------------------------------------------------------------------------
+//FOCUS
+//----------------------------------------------------------------------------------------
+
+// AutofocusOptions configure Autofocus. Steps is the number of positions of the
+// coarse pass over the whole focus range, RefineSteps those of the fine pass
+// between the neighbours of the sharpest coarse position, SettleFrames the frames
+// skipped after every move while the lens travels. Defaults (DEFAULT_FOCUS_*)
+// are used when zero. ROI is the region of the frame that is to be sharp, the
+// whole frame when empty.
+type AutofocusOptions struct {
+	ROI          image.Rectangle
+	Steps        int
+	RefineSteps  int
+	SettleFrames int
+}
+
+type FocusSample struct {
+	Position int32   `json:"position" yaml:"position"`
+	Score    float64 `json:"score" yaml:"score"`
+}
+
+// FocusResult is the position the webcam was focused at with its score, and the
+// scores of all measured positions in ascending order of position.
+type FocusResult struct {
+	Position int32         `json:"position" yaml:"position"`
+	Score    float64       `json:"score" yaml:"score"`
+	Curve    []FocusSample `json:"curve" yaml:"curve"`
+}
+
+//----------------------------------------------------------------------------------------
+//EXPOSURE AND WHITE BALANCE
+//----------------------------------------------------------------------------------------
+
+// ExposureOptions configure an ExposureController, defaults (DEFAULT_EXPOSURE_*,
+// DEFAULT_ROI_WEIGHT, DEFAULT_WHITE_BALANCE_TOLERANCE) are used for zero values.
+type ExposureOptions struct {
+	// Target is the mean luma the exposure is adjusted to, Tolerance how many EV
+	// it may be off.
+	Target    float64
+	Tolerance float64
+	// Damping is the fraction of the error corrected at once, between 0 and 1.
+	Damping float64
+	// MaxClipped is the fraction of highlights that may be clipped, above it the
+	// exposure is lowered whatever the mean luma.
+	MaxClipped float64
+	// MaxExposure and MaxGain limit the controls below their maximum when not zero,
+	// e.g. to keep the exposure short enough for the frame rate.
+	MaxExposure int32
+	MaxGain     int32
+	// Every is the number of frames between adjustments, so that the driver has
+	// applied the last one before the result is measured.
+	Every int
+	// ROI is the region the exposure is metered on, pixels within it weigh
+	// ROIWeight times those outside. The whole frame weighs the same when empty.
+	ROI       image.Rectangle
+	ROIWeight float64
+	// WhiteBalanceTolerance is how far the mean chroma may be off neutral.
+	WhiteBalanceTolerance float64
+	SkipExposure          bool
+	SkipWhiteBalance      bool
+}
+
+// ExposureState is what an ExposureController measured in the last frame and
+// the values of the controls it set. Error is the number of EV the exposure is
+// off the target, Cb and Cr are the mean chroma, 128 being neutral.
+type ExposureState struct {
+	Frames      uint64  `json:"frames" yaml:"frames"`
+	Luma        float64 `json:"luma" yaml:"luma"`
+	Clipped     float64 `json:"clipped" yaml:"clipped"`
+	Error       float64 `json:"error" yaml:"error"`
+	Cb          float64 `json:"cb" yaml:"cb"`
+	Cr          float64 `json:"cr" yaml:"cr"`
+	Exposure    int32   `json:"exposure" yaml:"exposure"`
+	Gain        int32   `json:"gain" yaml:"gain"`
+	RedBalance  int32   `json:"red_balance" yaml:"red_balance"`
+	BlueBalance int32   `json:"blue_balance" yaml:"blue_balance"`
+	Temperature int32   `json:"temperature" yaml:"temperature"`
+	Converged   bool    `json:"converged" yaml:"converged"`
+}
+
+// ExposureController adjusts exposure and gain (V4L2_CID_EXPOSURE_ABSOLUTE or
+// V4L2_CID_EXPOSURE, V4L2_CID_GAIN or V4L2_CID_ANALOGUE_GAIN) toward a target
+// mean luma, and the red and blue balance (or the white balance temperature)
+// toward a gray world, in which the mean chroma is neutral. Process measures a
+// frame of a GREY, YUYV, UYVY or 4:2:0 YUV format and adjusts the controls every
+// ExposureOptions.Every frames, it is meant to be called for the frames of a
+// running stream. White balance needs a color format. Run processes and releases
+// the frames of a stream until the channel is closed; frames that fail are
+// logged and regulation goes on, the first failure is returned.
+type ExposureController interface {
+	Process(snap Snapshot) (ExposureState, error)
+	Run(frames <-chan Frame) error
+	State() ExposureState
+}
+
+//----------------------------------------------------------------------------------------
+//PROFILES
+//----------------------------------------------------------------------------------------
+
+// Profile describes settings of a webcam. Zero fields are left untouched when the
+// profile is applied. Controls are addressed either by V4L2 names like
+// "V4L2_CID_BRIGHTNESS" or by names reported by the driver like "Brightness".
+type Profile struct {
+	PixelFormat string           `json:"pixel_format,omitempty" yaml:"pixel_format,omitempty"`
+	Width       uint32           `json:"width,omitempty" yaml:"width,omitempty"`
+	Height      uint32           `json:"height,omitempty" yaml:"height,omitempty"`
+	FrameRate   float64          `json:"frame_rate,omitempty" yaml:"frame_rate,omitempty"`
+	Controls    map[string]int32 `json:"controls,omitempty" yaml:"controls,omitempty"`
+}
+
+type ProfileStatus int
+
+const (
+	Applied ProfileStatus = iota
+	Clamped
+	Rejected
+)
+
+func (s ProfileStatus) String() string {
+	switch s {
+	case Applied:
+		return "applied"
+	case Clamped:
+		return "clamped"
+	case Rejected:
+		return "rejected"
+	default:
+		return fmt.Sprintf("ProfileStatus(%d)", int(s))
+	}
+}
+
+type ProfileFieldReport struct {
+	Field     string        `json:"field" yaml:"field"`
+	Requested string        `json:"requested" yaml:"requested"`
+	Applied   string        `json:"applied,omitempty" yaml:"applied,omitempty"`
+	Status    ProfileStatus `json:"status" yaml:"status"`
+	Reason    string        `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+func (f ProfileFieldReport) String() string {
+	return fmt.Sprintf("%s: %v (requested=%s,applied=%s) %s", f.Field, f.Status, f.Requested, f.Applied, f.Reason)
+}
+
+type ProfileReport struct {
+	Fields []ProfileFieldReport `json:"fields" yaml:"fields"`
+}
+
 //----------------------------------------------------------------------------------------
 //SNAPSHOT
 //----------------------------------------------------------------------------------------
 
+// Snapshot is a captured frame. Data returns all its bytes, Planes splits them
+// into the planes of multi-planar formats (e.g. V4L2_PIX_FMT_NV12M), a single
+// plane format has exactly one plane. Strides are the lengths of lines in bytes,
+// one per plane. Release hands the memory of the snapshot back to a pool the
+// stream draws from, which spares allocating every frame; calling it is optional,
+// but the snapshot must not be used afterwards.
 type Snapshot interface {
 	Data() []byte
+	Planes() [][]byte
+	Strides() []uint32
+	Release()
+}
+
+// DecodeYCbCr converts a snapshot of a 4:2:0 YUV format (NV12, NV21, YUV420,
+// YVU420 or any of their multi-planar variants) of the given frame size into an image.
+func DecodeYCbCr(snap Snapshot, frameSize DiscreteFrameSize) (*image.YCbCr, error) {
+	return decodeYCbCr(snap, frameSize)
+}
+
+// PlaneView reads the samples of a snapshot in place, without converting or
+// copying them. Y is the luma of a pixel, CbCr the chroma it shares with the
+// other pixels of its block; ChromaBlock is the width and height of such a
+// block, 2x1 for packed 4:2:2 formats and 2x2 for 4:2:0 ones. GREY has no
+// chroma, CbCr of it is neutral (128).
+type PlaneView interface {
+	Width() int
+	Height() int
+	Y(x int, y int) uint8
+	HasChroma() bool
+	CbCr(x int, y int) (uint8, uint8)
+	ChromaBlock() (int, int)
+}
+
+// NewPlaneView views a snapshot of a GREY, packed 4:2:2 (YUYV, YVYU, UYVY, VYUY)
+// or 4:2:0 YUV format (NV12, NV21, YUV420, YVU420 or any of their multi-planar
+// variants) of the given frame size. Strides of the snapshot are honoured, planes
+// too short for the frame size are an error.
+func NewPlaneView(snap Snapshot, frameSize DiscreteFrameSize) (PlaneView, error) {
+	return newPlaneView(snap, frameSize)
+}
+
+//----------------------------------------------------------------------------------------
+//FRAMES
+//----------------------------------------------------------------------------------------
+
+// StreamOptions configure Webcam.StreamFrames.
+type StreamOptions struct {
+	// Buffers is the number of buffers requested from the driver. Copied frames
+	// give their buffer back right away, zero-copy frames and frames carrying
+	// dma-bufs hold it until Release, frames are delivered as long as at least
+	// one buffer is not held.
+	// DEFAULT_STREAM_BUFFERS is used when zero.
+	Buffers int
+	// ExportDMABuf exports every buffer as a dma-buf file descriptor (VIDIOC_EXPBUF)
+	// that is delivered with each frame.
+	ExportDMABuf bool
+	// SkipCopy leaves the bytes of frames uncopied, Data and Planes of frames are
+	// empty. Useful together with ExportDMABuf when frames are consumed by fd only.
+	SkipCopy bool
+	// Memory of the buffers, MEMORY_MMAP when zero. With MEMORY_USERPTR the driver
+	// captures into memory allocated by this module and frames view it without
+	// copying. With MEMORY_DMABUF the driver captures into DMABufFds. When the
+	// driver rejects the memory, the stream falls back to MEMORY_MMAP.
+	Memory MemoryType
+	// DMABufFds are the dma-bufs imported with MEMORY_DMABUF, one slice of plane
+	// fds per buffer. They still belong to the caller.
+	DMABufFds [][]int
+	// ZeroCopy delivers frames that view the memory of their buffers in place
+	// instead of copies, their data is valid only until Release. The stream keeps
+	// the memory of frames released after it finished mapped until then.
+	ZeroCopy bool
+	// MaxLeased limits how many zero-copy frames the consumer may hold at once,
+	// further frames are delivered as copies and their buffers are queued again
+	// right away. Buffers-1 when zero.
+	MaxLeased int
+	// ReadIO reads frames by read() even if the device is able to stream. Devices
+	// without streaming are always read, then the options above are ignored.
+	ReadIO bool
+	// DropLate releases frames the consumer is not ready to receive instead of
+	// waiting for it, they are counted as dropped by the consumer.
+	DropLate bool
+	// Stats receives the statistics of the stream every StatsInterval
+	// (DEFAULT_STATS_INTERVAL when zero) and is closed when the stream finishes.
+	// Reports are skipped rather than stalling the stream.
+	Stats         chan StreamStats
+	StatsInterval time.Duration
+	// StatsWindow is the sliding window rates and latencies are measured over,
+	// DEFAULT_STATS_WINDOW when zero.
+	StatsWindow time.Duration
+}
+
+// StreamStats tell how healthy a stream is. Rates and latencies are measured
+// over a sliding window, counters cover the whole stream. Latency is the time
+// from the capture of a frame by the driver to its delivery to the consumer,
+// it is zero when the driver does not timestamp frames on the monotonic clock.
+type StreamStats struct {
+	Running  bool          `json:"running" yaml:"running"`
+	Started  time.Time     `json:"started" yaml:"started"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	// Frames and Bytes delivered to the consumer.
+	Frames         uint64  `json:"frames" yaml:"frames"`
+	Bytes          uint64  `json:"bytes" yaml:"bytes"`
+	FPS            float64 `json:"fps" yaml:"fps"`
+	BytesPerSecond float64 `json:"bytes_per_second" yaml:"bytes_per_second"`
+	// DroppedByDriver are gaps in the sequence of frames, DroppedByConsumer are
+	// frames released because the consumer was not ready, see StreamOptions.DropLate.
+	DroppedByDriver   uint64        `json:"dropped_by_driver" yaml:"dropped_by_driver"`
+	DroppedByConsumer uint64        `json:"dropped_by_consumer" yaml:"dropped_by_consumer"`
+	Latency           time.Duration `json:"latency" yaml:"latency"`
+	MaxLatency        time.Duration `json:"max_latency" yaml:"max_latency"`
+	Errors            uint64        `json:"errors" yaml:"errors"`
+	// Queued is the number of buffers owned by the driver when the last frame was
+	// taken out of them, Buffers the number of buffers of the stream.
+	Queued  int `json:"queued" yaml:"queued"`
+	Buffers int `json:"buffers" yaml:"buffers"`
+}
+
+func (s StreamStats) String() string {
+	return fmt.Sprintf("StreamStats[frames=%d,fps=%.1f,dropped=%d/%d,latency=%v,queued=%d/%d,errors=%d]", s.Frames, s.FPS, s.DroppedByDriver, s.DroppedByConsumer, s.Latency, s.Queued, s.Buffers, s.Errors)
+}
+
+// StreamTotals accumulate the counters of every stream of a webcam since it was
+// opened, they never decrease. FrameSizes counts delivered frames by payload:
+// FrameSizes[i] those of at most FRAME_SIZE_BUCKETS[i] bytes (and more than the
+// bound before), the last entry the larger ones. IoctlErrors counts failed
+// ioctls by request name without the VIDIOC_ prefix (e.g. "DQBUF"), failed
+// poll() and read() calls as "poll" and "read".
+type StreamTotals struct {
+	Streams           uint64            `json:"streams" yaml:"streams"`
+	Frames            uint64            `json:"frames" yaml:"frames"`
+	Bytes             uint64            `json:"bytes" yaml:"bytes"`
+	DroppedByDriver   uint64            `json:"dropped_by_driver" yaml:"dropped_by_driver"`
+	DroppedByConsumer uint64            `json:"dropped_by_consumer" yaml:"dropped_by_consumer"`
+	Errors            uint64            `json:"errors" yaml:"errors"`
+	FrameSizes        []uint64          `json:"frame_sizes" yaml:"frame_sizes"`
+	IoctlErrors       map[string]uint64 `json:"ioctl_errors" yaml:"ioctl_errors"`
+}
+
+// MemoryType tells where buffers of a stream live, see the MEMORY_* constants.
+type MemoryType uint32
+
+// Frame is a captured frame that holds its memory until Release is called. Zero-copy
+// frames and frames carrying dma-bufs hold their buffer, the driver fills it
+// again only after that; other frames are copies. Every received frame must be
+// released; neither the frame nor its data may be used afterwards. A frame is
+// meant to be used by a single goroutine. Frames garbage collected without being
+// released are released with a warning in the log; builds tagged webcam_debug
+// panic when a frame is used after Release.
+type Frame interface {
+	Snapshot
+	// Sequence is the number the driver gave the frame, gaps mean dropped frames.
+	Sequence() uint32
+	// DMABuf returns the exported or imported planes of the buffer, nil unless
+	// the stream uses dma-bufs.
+	DMABuf() []DMABufPlane
+	Release()
+}
+
+// DMABufPlane locates a plane of a frame in an exported dma-buf. The file
+// descriptor belongs to the stream and is closed when the stream finishes, so
+// it has to be duplicated to be kept longer.
+type DMABufPlane struct {
+	Fd     int
+	Length uint32
+	Offset uint32
+}
+
+func (p DMABufPlane) String() string {
+	return fmt.Sprintf("DMABufPlane[fd=%d,length=%d,offset=%d]", p.Fd, p.Length, p.Offset)
+}
+
+//----------------------------------------------------------------------------------------
+//LOGGING
+//----------------------------------------------------------------------------------------
+
+// Level is the severity of a log record, its values are those of the levels of
+// log/slog, so that slog.Level(level) converts it.
+type Level int
+
+// Logger receives the records the module logs. Fields alternate keys and values
+// like the arguments of slog.Logger.Log; records of a webcam start with its
+// "path" and "fd", failed ioctls carry "ioctl", "errno" and "error". A slog
+// logger is plugged in by a LoggerFunc:
+//
+//	webcam.SetLogger(webcam.LoggerFunc(func(level webcam.Level, msg string, fields ...interface{}) {
+//		logger.Log(context.Background(), slog.Level(level), msg, fields...)
+//	}))
+type Logger interface {
+	Log(level Level, msg string, fields ...interface{})
+}
+
+// LoggerFunc adapts a function to a Logger.
+type LoggerFunc func(level Level, msg string, fields ...interface{})
+
+//----------------------------------------------------------------------------------------
+//V4L2 EVENTS
+//----------------------------------------------------------------------------------------
+
+// EventType selects events to subscribe to, see the EVENT_* constants.
+type EventType uint32
+
+// Event is a CtrlEvent, SourceChangeEvent, EOSEvent or FrameSyncEvent.
+type Event interface {
+	Type() EventType
+	Header() EventHeader
+}
+
+// EventHeader is common to all events. Sequence counts the events of the device,
+// Timestamp is the time the event was raised on the monotonic clock.
+type EventHeader struct {
+	Sequence  uint32
+	Timestamp time.Duration
+}
+
+// CtrlEvent tells that a control changed, Changes is a mask of EVENT_CTRL_CH_*
+// telling whether the value, the flags or the range of the control changed.
+type CtrlEvent struct {
+	EventHeader
+	ID      ControlID
+	Changes uint32
+	Value   int64
+	Flags   uint32
+	Minimum int32
+	Maximum int32
+	Step    int32
+	Default int32
+}
+
+// SourceChangeEvent tells that the source changed, e.g. the resolution of an HDMI
+// input (EVENT_SRC_CH_RESOLUTION in Changes). The format has to be queried again.
+type SourceChangeEvent struct {
+	EventHeader
+	Changes uint32
+}
+
+// EOSEvent tells that the last frame of the stream has been captured.
+type EOSEvent struct {
+	EventHeader
+}
+
+// FrameSyncEvent tells that the driver started capturing a frame.
+type FrameSyncEvent struct {
+	EventHeader
+	FrameSequence uint32
+}
+
+//----------------------------------------------------------------------------------------
+//HOTPLUG EVENTS
+//----------------------------------------------------------------------------------------
+
+type DeviceEventType int
+
+const (
+	Added DeviceEventType = iota
+	Removed
+)
+
+func (t DeviceEventType) String() string {
+	switch t {
+	case Added:
+		return "Added"
+	case Removed:
+		return "Removed"
+	default:
+		return fmt.Sprintf("DeviceEventType(%d)", int(t))
+	}
+}
+
+// DeviceEvent tells that a video device has been plugged in or out. VendorID,
+// ProductID and Serial identify the camera like in WebcamInfo. They are read
+// from sysfs when the device is added and remembered for its removal, as sysfs
+// of a removed device is gone already.
+type DeviceEvent struct {
+	Type      DeviceEventType
+	Path      string
+	SysPath   string
+	Major     uint32
+	Minor     uint32
+	VendorID  uint16
+	ProductID uint16
+	Serial    string
+}
+
+func (e DeviceEvent) String() string {
+	return fmt.Sprintf("DeviceEvent[%v:%s,%04x:%04x,serial=%s]", e.Type, e.Path, e.VendorID, e.ProductID, e.Serial)
+}
+
+//----------------------------------------------------------------------------------------
+//RESILIENT STREAMING
+//----------------------------------------------------------------------------------------
+
+// ReconnectOptions control how a lost device is waited for. The delay between
+// attempts to reopen it starts at InitialBackoff and doubles up to MaxBackoff.
+// Zero MaxAttempts means trying forever. Reconfigure, if set, is called on every
+// reopened webcam before streaming resumes.
+type ReconnectOptions struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	MaxAttempts    int
+	Reconfigure    func(cam Webcam) error
+}
+
+type StreamGap struct {
+	Cause    error
+	Lost     time.Time
+	Resumed  time.Time
+	Attempts int
+	Webcam   Webcam
+}
+
+func (g StreamGap) String() string {
+	return fmt.Sprintf("StreamGap[%v,attempts=%d,cause=%v]", g.Resumed.Sub(g.Lost), g.Attempts, g.Cause)
+}
+
+//----------------------------------------------------------------------------------------
+//DEVICE REPORT
+//----------------------------------------------------------------------------------------
+
+type DeviceReport struct {
+	Info         WebcamInfo         `json:"info" yaml:"info"`
+	Capabilities CapabilitiesReport `json:"capabilities" yaml:"capabilities"`
+	Formats      []FormatReport     `json:"formats" yaml:"formats"`
+	Controls     []ControlReport    `json:"controls" yaml:"controls"`
+}
+
+type CapabilitiesReport struct {
+	Driver       string   `json:"driver" yaml:"driver"`
+	Card         string   `json:"card" yaml:"card"`
+	BusInfo      string   `json:"bus_info" yaml:"bus_info"`
+	Version      uint32   `json:"version" yaml:"version"`
+	Capabilities []string `json:"capabilities" yaml:"capabilities"`
+}
+
+type FormatReport struct {
+	Name          string               `json:"name" yaml:"name"`
+	Description   string               `json:"description" yaml:"description"`
+	Code          uint32               `json:"code" yaml:"code"`
+	BufferType    BufferType           `json:"buffer_type" yaml:"buffer_type"`
+	Compressed    bool                 `json:"compressed" yaml:"compressed"`
+	Emulated      bool                 `json:"emulated" yaml:"emulated"`
+	Sizes         []FrameSizeReport    `json:"sizes" yaml:"sizes"`
+	StepwiseSizes []StepwiseSizeReport `json:"stepwise_sizes,omitempty" yaml:"stepwise_sizes,omitempty"`
+}
+
+type FrameSizeReport struct {
+	Width             uint32                  `json:"width" yaml:"width"`
+	Height            uint32                  `json:"height" yaml:"height"`
+	Intervals         []Fraction              `json:"intervals" yaml:"intervals"`
+	StepwiseIntervals []StepwiseFrameInterval `json:"stepwise_intervals,omitempty" yaml:"stepwise_intervals,omitempty"`
+}
+
+type StepwiseSizeReport struct {
+	MinWidth   uint32 `json:"min_width" yaml:"min_width"`
+	MaxWidth   uint32 `json:"max_width" yaml:"max_width"`
+	StepWidth  uint32 `json:"step_width" yaml:"step_width"`
+	MinHeight  uint32 `json:"min_height" yaml:"min_height"`
+	MaxHeight  uint32 `json:"max_height" yaml:"max_height"`
+	StepHeight uint32 `json:"step_height" yaml:"step_height"`
+}
+
+// ControlReport is a control together with its value at the time the report
+// was made. Value is nil for controls that cannot be read.
+type ControlReport struct {
+	Control `yaml:",inline"`
+	Value   *int32 `json:"value,omitempty" yaml:"value,omitempty"`
 }
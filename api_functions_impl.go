@@ -3,90 +3,119 @@ package webcam
 import (
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"sync"
 )
 
-func openWebcam(path string) (Webcam, error) {
+func openWebcam(path string, layout sysfsLayout) (Webcam, error) {
 	file, err := os.OpenFile(path, os.O_RDWR, 0666)
 
-	log.Printf("Opening device %s\n", path)
+	logRecord(LEVEL_DEBUG, "Opening device", "path", path)
 
 	if err != nil {
 		return nil, err
 	}
 
-	log.Println("Reading capability")
-
-	dev := &device{file}
+	dev := &device{file: file, info: WebcamInfo{Path: path}, backend: v4l2Backend{}}
+	dev.log(LEVEL_DEBUG, "Reading capability")
 
 	caps, err := dev.QueryCapabilities()
 
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
 
-	if !caps.HasCapability(CAP_VIDEO_CAPTURE) {
+	switch {
+	case caps.HasCapability(CAP_VIDEO_CAPTURE):
+		dev.bufType = BUF_TYPE_VIDEO_CAPTURE
+	case caps.HasCapability(CAP_VIDEO_CAPTURE_MPLANE):
+		dev.bufType = BUF_TYPE_VIDEO_CAPTURE_MPLANE
+	default:
+		file.Close()
 		return nil, errors.New(fmt.Sprintf("Device %s is not a video capturing device.", caps.Card()))
 	}
 
-	if !caps.HasCapability(CAP_STREAMING) {
-		return nil, errors.New(fmt.Sprintf("Device %s is not able to stream frames.", caps.Card()))
+	if !caps.HasCapability(CAP_STREAMING) && !caps.HasCapability(CAP_READWRITE) {
+		file.Close()
+		return nil, errors.New(fmt.Sprintf("Device %s is able neither to stream nor to read frames.", caps.Card()))
 	}
 
-	log.Printf("Device %s is a video device", file.Name())
+	dev.canStream = caps.HasCapability(CAP_STREAMING)
+	dev.canRead = caps.HasCapability(CAP_READWRITE)
+
+	dev.info = newWebcamInfo(path, caps, layout)
+
+	dev.log(LEVEL_DEBUG, "Device is a video device", "card", dev.info.Card)
 	return dev, nil
 }
 
-func findWebcams() ([]WebcamInfo, error) {
+func openWebcamBy(selector WebcamSelector, layout sysfsLayout) (Webcam, error) {
+
+	if selector == (WebcamSelector{}) {
+		return nil, errors.New("Webcam selector is empty.")
+	}
+
+	infos, err := findWebcams(layout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		if selector.Matches(info) {
+			return openWebcam(info.Path, layout)
+		}
+	}
+
+	return nil, fmt.Errorf("No webcam matches %v.", selector)
+}
+
+func findWebcams(layout sysfsLayout) ([]WebcamInfo, error) {
 
-	files, error := filepath.Glob("/dev/video*")
+	files, error := filepath.Glob(filepath.Join(layout.dev, "video*"))
 
 	if error != nil {
 		return nil, error
 	}
 
 	channel := make(chan Webcam)
-	go probeDevices(files, channel)
+	go probeDevices(files, layout, channel)
 
 	valid := []WebcamInfo{}
 
 	for device := range channel {
-		cap, _ := device.QueryCapabilities()
+		valid = append(valid, device.Info())
 
-		info := WebcamInfo{File: device.File(), Name: cap.Driver()}
-		valid = append(valid, info)
-		
 		if err := device.Close(); err != nil {
-			log.Printf("Could not close webcam %v\n", device)
+			logRecord(LEVEL_WARN, "Could not close webcam", errorFields(err, "path", device.Info().Path)...)
 		}
 	}
 
 	return valid, nil
 }
 
-func probeDevices(files []string, channel chan Webcam) {
+func probeDevices(files []string, layout sysfsLayout, channel chan Webcam) {
 	wg := sync.WaitGroup{}
 	wg.Add(len(files))
 
 	for _, file := range files {
-		go probeDevice(file, channel, &wg)
+		go probeDevice(file, layout, channel, &wg)
 	}
 
 	wg.Wait()
 	close(channel)
 }
 
-func probeDevice(file string, ch chan Webcam, wg *sync.WaitGroup) {
+func probeDevice(file string, layout sysfsLayout, ch chan Webcam, wg *sync.WaitGroup) {
 
-	device, error := openWebcam(file)
+	device, error := openWebcam(file, layout)
 
 	defer wg.Done()
 
 	if error != nil {
-		log.Printf("Device %s is not a camera\n", file)
+		logRecord(LEVEL_DEBUG, "Device is not a camera", errorFields(error, "path", file)...)
 		return
 	}
 
@@ -1,21 +1,225 @@
 package webcam
 
+// #include "v4l2-binding.h"
+import "C"
+
 import (
-	"log"
+	"errors"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type deviceState int
+
+const (
+	stateIdle deviceState = iota
+	stateConfigured
+	stateStreaming
+	stateClosed
 )
 
 type device struct {
 	file *os.File
+	info WebcamInfo
+	//issues the ioctls of capturing
+	backend backend
+
+	//either BUF_TYPE_VIDEO_CAPTURE or BUF_TYPE_VIDEO_CAPTURE_MPLANE,
+	//chosen when the device is opened
+	bufType BufferType
+	//memory of the requested buffers
+	memory MemoryType
+	//I/O methods the device supports
+	canStream bool
+	canRead   bool
+
+	//guards all the fields below and serializes ioctls issued on the file
+	mu    sync.Mutex
+	state deviceState
+
+	//closed by Close() to ask a running stream to finish, the stream
+	//closes streamDone once it has released the device
+	closing    chan struct{}
+	streamDone chan struct{}
+
+	//frame interval requested by SetFrameInterval(), applied after every
+	//change of the frame size
+	frameInterval *Fraction
+	//snapshots are read() rather than streamed, see SetSnapshotReadIO()
+	snapshotReadIO bool
+
+	//state of capturing, tracked so that Close() and error paths
+	//are able to tear everything down
+	streaming bool
+	requested bool
+	buffers   []mappedBuffer
+	layout    frameLayout
+
+	//frames are read() from the device instead of being streamed
+	reading      bool
+	readSequence uint32
+
+	//number of buffers owned by the driver, the rest is held by consumers
+	queued int
+	//number of buffers viewed by zero-copy frames
+	leased int
+	//incremented by every start of capturing, so that frames released after
+	//their stream finished are not queued into a later one
+	generation uint64
+
+	//counters of all the streams since the device was opened
+	totals deviceTotals
+	//error the last stream failed with, nil when it finished cleanly
+	streamErr error
+
+	//receivers of events, delivered by the event pump while no stream runs;
+	//stopEvents is closed to stop the pump, which then closes eventsDone
+	subscribers []*eventSubscriber
+	stopEvents  chan struct{}
+	eventsDone  chan struct{}
+
+	//logger set by SetLogger(), read without locking the device
+	logger atomic.Value
+	//*streamStats of the running stream or of the last one, empty before the
+	//first; read by Stats() without locking the device
+	stats atomic.Value
+
+	//scratch array the driver fills planes of multi-planar buffers into
+	planes *C.struct_v4l2_plane
 }
 
 func (d *device) File() *os.File {
 	return d.file
 }
 
+func (d *device) Info() WebcamInfo {
+	return d.info
+}
+
 func (d *device) Close() error {
-	log.Printf("Closing video device.\n")
-	return d.file.Close()
+	d.mu.Lock()
+
+	for d.state == stateStreaming {
+		done := d.streamDone
+
+		if d.closing != nil {
+			close(d.closing)
+			d.closing = nil
+		}
+
+		d.mu.Unlock()
+		<-done
+		d.mu.Lock()
+	}
+
+	defer d.mu.Unlock()
+
+	if d.state == stateClosed {
+		return ErrDeviceClosed
+	}
+
+	d.log(LEVEL_DEBUG, "Closing video device")
+
+	//unsubscribing unlocks the device while the event pump finishes, nobody
+	//may start using it meanwhile
+	d.state = stateClosed
+	err := combineErrors(d.unsubscribeEvents(), d.stopCapture())
+
+	if closeErr := d.file.Close(); closeErr != nil {
+		err = combineErrors(err, closeErr)
+	}
+
+	return err
+}
+
+// Err tells whether the device is still usable without issuing an ioctl.
+func (d *device) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.state == stateClosed {
+		return ErrDeviceClosed
+	}
+
+	return d.streamErr
+}
+
+// lock acquires the device for an operation and checks that the device is in
+// a state that allows it. The device stays locked only if nil is returned.
+func (d *device) lock(reconfigures bool) error {
+	d.mu.Lock()
+
+	if d.state == stateClosed {
+		d.mu.Unlock()
+		return ErrDeviceClosed
+	}
+
+	if reconfigures && d.state == stateStreaming {
+		d.mu.Unlock()
+		return ErrBusyStreaming
+	}
+
+	return nil
 }
 
+//--------------------------------------------------------------------------------------
+//AGGREGATED ERRORS
+//--------------------------------------------------------------------------------------
 
+type multiError []error
+
+func (m multiError) Error() string {
+	messages := make([]string, 0, len(m))
+	for _, err := range m {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is lets errors.Is find any of the errors, errors.Is follows Unwrap() []error
+// only from Go 1.20 on.
+func (m multiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As lets errors.As find the first of the errors matching the target.
+func (m multiError) As(target interface{}) bool {
+	for _, err := range m {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func combineErrors(errs ...error) error {
+	result := multiError{}
+
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if nested, ok := err.(multiError); ok {
+			result = append(result, nested...)
+		} else {
+			result = append(result, err)
+		}
+	}
+
+	switch len(result) {
+	case 0:
+		return nil
+	case 1:
+		return result[0]
+	default:
+		return result
+	}
+}
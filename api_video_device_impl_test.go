@@ -0,0 +1,188 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// run with -race
+func TestConcurrentAccess(t *testing.T) {
+	dev, _ := testDevice(t)
+	defer dev.Close()
+
+	frameSize := testFrameSize(t)
+	stop := make(chan bool)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			snaps := make(chan Snapshot)
+			errs := make(chan error, 1)
+
+			go dev.StreamSnapshots(frameSize, snaps, errs, stop)
+
+			for snap := range snaps {
+				snap.Release()
+			}
+
+			//only one of the streams may run, the other finds the device busy
+			if err := <-errs; err != nil && err != ErrBusyStreaming {
+				t.Errorf("Stream failed: %v", err)
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				if _, err := dev.QueryFormats(); err != nil {
+					t.Errorf("QueryFormats failed: %v", err)
+				}
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 5; j++ {
+				snap, err := dev.TakeSnapshot(frameSize)
+
+				if err == ErrBusyStreaming {
+					continue
+				}
+
+				if err != nil {
+					t.Errorf("TakeSnapshot failed: %v", err)
+					continue
+				}
+
+				snap.Release()
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+func TestTakeSnapshotWaitsUnlocked(t *testing.T) {
+	dev, backend := testDevice(t)
+	backend.stall(true)
+
+	result := make(chan error, 1)
+
+	go func() {
+		_, err := dev.TakeSnapshot(testFrameSize(t))
+		result <- err
+	}()
+
+	//wait for the snapshot to start capturing
+	for backend.called("STREAMON") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := dev.QueryFormats(); err != nil {
+		t.Fatalf("QueryFormats failed while a snapshot waits: %v", err)
+	}
+
+	if _, err := dev.TakeSnapshot(testFrameSize(t)); err != ErrBusyStreaming {
+		t.Errorf("Second snapshot returned %v, expected %v", err, ErrBusyStreaming)
+	}
+
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-result:
+		if err != ErrDeviceClosed {
+			t.Errorf("Snapshot returned %v, expected %v", err, ErrDeviceClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Snapshot did not finish after Close")
+	}
+
+	assertReleased(t, backend)
+}
+
+func TestStatsDoNotLock(t *testing.T) {
+	dev, _ := testDevice(t)
+	defer dev.Close()
+
+	snap, err := dev.TakeSnapshot(testFrameSize(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap.Release()
+
+	//a device busy with an ioctl still reports its statistics
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+
+	stats := make(chan StreamStats, 1)
+	go func() { stats <- dev.Stats() }()
+
+	select {
+	case s := <-stats:
+		if s.Frames != 1 {
+			t.Errorf("Stats report %d frames, expected 1", s.Frames)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stats waited for the device")
+	}
+}
+
+func TestErrFollowsStreams(t *testing.T) {
+	dev, backend := testDevice(t)
+
+	if err := dev.Err(); err != nil {
+		t.Errorf("Opened device reports %v", err)
+	}
+
+	backend.fail("DQBUF", syscall.ENODEV)
+
+	if _, err := dev.TakeSnapshot(testFrameSize(t)); !errors.Is(err, syscall.ENODEV) {
+		t.Fatalf("TakeSnapshot returned %v, expected %v", err, syscall.ENODEV)
+	}
+
+	if err := dev.Err(); !errors.Is(err, syscall.ENODEV) {
+		t.Errorf("Device reports %v after a failed stream, expected %v", err, syscall.ENODEV)
+	}
+
+	backend.fail("DQBUF", nil)
+
+	snap, err := dev.TakeSnapshot(testFrameSize(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap.Release()
+
+	if err := dev.Err(); err != nil {
+		t.Errorf("Device reports %v after a clean stream", err)
+	}
+
+	dev.Close()
+
+	if err := dev.Err(); err != ErrDeviceClosed {
+		t.Errorf("Closed device reports %v, expected %v", err, ErrDeviceClosed)
+	}
+}
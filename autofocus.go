@@ -0,0 +1,322 @@
+package webcam
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	DEFAULT_FOCUS_STEPS         = 16
+	DEFAULT_FOCUS_REFINE_STEPS  = 8
+	DEFAULT_FOCUS_SETTLE_FRAMES = 3
+)
+
+func (o AutofocusOptions) withDefaults() AutofocusOptions {
+	if o.Steps < 2 {
+		o.Steps = DEFAULT_FOCUS_STEPS
+	}
+
+	if o.RefineSteps <= 0 {
+		o.RefineSteps = DEFAULT_FOCUS_REFINE_STEPS
+	}
+
+	if o.SettleFrames <= 0 {
+		o.SettleFrames = DEFAULT_FOCUS_SETTLE_FRAMES
+	}
+
+	return o
+}
+
+func (s FocusSample) String() string {
+	return fmt.Sprintf("FocusSample[position=%d,score=%.1f]", s.Position, s.Score)
+}
+
+func (r FocusResult) String() string {
+	return fmt.Sprintf("FocusResult[position=%d,score=%.1f,samples=%d]", r.Position, r.Score, len(r.Curve))
+}
+
+//-------------------------------------------------------------------------------------
+//FOCUS SWEEP
+//-------------------------------------------------------------------------------------
+
+// focusSweep moves the focus of a streaming webcam and scores the frames
+// captured at every position.
+type focusSweep struct {
+	cam       Webcam
+	focus     Control
+	frameSize DiscreteFrameSize
+	options   AutofocusOptions
+
+	frames chan Frame
+	errs   chan error
+	stop   chan bool
+
+	scores map[int32]float64
+}
+
+func autofocus(cam Webcam, frameSize *DiscreteFrameSize, options AutofocusOptions) (FocusResult, error) {
+
+	options = options.withDefaults()
+
+	controls, err := cam.QueryControls()
+
+	if err != nil {
+		return FocusResult{}, err
+	}
+
+	sweep := &focusSweep{cam: cam, options: options, scores: map[int32]float64{}}
+	found := false
+	hasAuto := false
+
+	for _, control := range controls {
+		switch control.ID {
+		case CID_FOCUS_ABSOLUTE:
+			sweep.focus = control
+			found = true
+		case CID_FOCUS_AUTO:
+			hasAuto = true
+		}
+	}
+
+	if !found {
+		return FocusResult{}, fmt.Errorf("Device %s has no absolute focus control.", cam.Info().Path)
+	}
+
+	if frameSize != nil {
+		sweep.frameSize = *frameSize
+	} else if sweep.frameSize, err = cam.CurrentFrameSize(); err != nil {
+		return FocusResult{}, err
+	}
+
+	previous, err := saveFocus(cam, hasAuto)
+
+	if err != nil {
+		return FocusResult{}, err
+	}
+
+	//continuous autofocus would fight the sweep
+	if hasAuto {
+		if err := cam.SetControl(CID_FOCUS_AUTO, 0); err != nil {
+			return FocusResult{}, fmt.Errorf("Cannot switch autofocus off: %w", err)
+		}
+	}
+
+	if err := sweep.run(); err != nil {
+		return FocusResult{}, combineErrors(err, previous.restore(cam))
+	}
+
+	return sweep.result(), nil
+}
+
+func (s *focusSweep) run() error {
+
+	s.frames = make(chan Frame)
+	s.errs = make(chan error, 1)
+	s.stop = make(chan bool)
+
+	//frames the sweep is not waiting for are dropped, so that every frame it
+	//receives is a recent one
+	go s.cam.StreamFrames(&s.frameSize, StreamOptions{DropLate: true}, s.frames, s.errs, s.stop)
+	defer s.finish()
+
+	min := int32(s.focus.Minimum)
+	max := int32(s.focus.Maximum)
+
+	//coarse pass over the whole range
+	if err := s.measureRange(min, max, s.options.Steps); err != nil {
+		return err
+	}
+
+	//fine pass between the neighbours of the peak
+	positions := s.positions()
+	peak := s.peak(positions)
+
+	low, high := positions[0], positions[len(positions)-1]
+
+	if peak > 0 {
+		low = positions[peak-1]
+	}
+
+	if peak < len(positions)-1 {
+		high = positions[peak+1]
+	}
+
+	if err := s.measureRange(low, high, s.options.RefineSteps+2); err != nil {
+		return err
+	}
+
+	best := s.result().Position
+
+	if err := s.cam.SetControl(s.focus.ID, best); err != nil {
+		return fmt.Errorf("Cannot move focus to %d: %w", best, err)
+	}
+
+	return nil
+}
+
+// measureRange scores the given number of positions spread evenly from low to
+// high, positions measured before are skipped.
+func (s *focusSweep) measureRange(low int32, high int32, steps int) error {
+	for i := 0; i < steps; i++ {
+		target := float64(low) + float64(high-low)*float64(i)/float64(steps-1)
+		position, _, _ := fitControlValue(s.focus, int32(math.Round(target)))
+
+		if _, done := s.scores[position]; done {
+			continue
+		}
+
+		score, err := s.measure(position)
+
+		if err != nil {
+			return err
+		}
+
+		s.scores[position] = score
+	}
+
+	return nil
+}
+
+// measure moves the focus, lets the lens settle and scores the next frame.
+func (s *focusSweep) measure(position int32) (float64, error) {
+
+	if err := s.cam.SetControl(s.focus.ID, position); err != nil {
+		return 0, fmt.Errorf("Cannot move focus to %d: %w", position, err)
+	}
+
+	for i := 0; ; i++ {
+		frame, err := s.next()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if i < s.options.SettleFrames {
+			frame.Release()
+			continue
+		}
+
+		score, err := sharpness(frame, s.frameSize, s.options.ROI)
+		frame.Release()
+
+		return score, err
+	}
+}
+
+func (s *focusSweep) next() (Frame, error) {
+	select {
+	case frame, ok := <-s.frames:
+		if ok {
+			return frame, nil
+		}
+	case err := <-s.errs:
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errors.New("Stream finished during the focus sweep.")
+}
+
+// finish stops the stream and waits for it to release its buffers.
+func (s *focusSweep) finish() {
+	close(s.stop)
+
+	for frame := range s.frames {
+		frame.Release()
+	}
+}
+
+// positions returns the measured positions in ascending order.
+func (s *focusSweep) positions() []int32 {
+	result := make([]int32, 0, len(s.scores))
+
+	for position := range s.scores {
+		result = append(result, position)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// peak returns the index of the sharpest of the positions.
+func (s *focusSweep) peak(positions []int32) int {
+	best := 0
+
+	for i, position := range positions {
+		if s.scores[position] > s.scores[positions[best]] {
+			best = i
+		}
+	}
+
+	return best
+}
+
+func (s *focusSweep) result() FocusResult {
+	positions := s.positions()
+	best := positions[s.peak(positions)]
+
+	result := FocusResult{Position: best, Score: s.scores[best]}
+
+	for _, position := range positions {
+		result.Curve = append(result.Curve, FocusSample{Position: position, Score: s.scores[position]})
+	}
+
+	return result
+}
+
+//-------------------------------------------------------------------------------------
+//RESTORING FOCUS
+//-------------------------------------------------------------------------------------
+
+// savedFocus is the focus of a webcam before a sweep, so that a failed sweep
+// does not leave the webcam out of focus with autofocus switched off.
+type savedFocus struct {
+	position int32
+	//nil when the webcam has no autofocus
+	auto *int32
+}
+
+func saveFocus(cam Webcam, hasAuto bool) (savedFocus, error) {
+
+	position, err := cam.GetControl(CID_FOCUS_ABSOLUTE)
+
+	if err != nil {
+		return savedFocus{}, fmt.Errorf("Cannot read focus position: %w", err)
+	}
+
+	saved := savedFocus{position: position}
+
+	if hasAuto {
+		auto, err := cam.GetControl(CID_FOCUS_AUTO)
+
+		if err != nil {
+			return savedFocus{}, fmt.Errorf("Cannot read autofocus: %w", err)
+		}
+
+		saved.auto = &auto
+	}
+
+	return saved, nil
+}
+
+// restore moves the focus back and then switches autofocus back, every step is
+// attempted although the previous one failed.
+func (f savedFocus) restore(cam Webcam) error {
+
+	var errs multiError
+
+	if err := cam.SetControl(CID_FOCUS_ABSOLUTE, f.position); err != nil {
+		errs = append(errs, fmt.Errorf("Cannot move focus back to %d: %w", f.position, err))
+	}
+
+	if f.auto != nil {
+		if err := cam.SetControl(CID_FOCUS_AUTO, *f.auto); err != nil {
+			errs = append(errs, fmt.Errorf("Cannot switch autofocus back: %w", err))
+		}
+	}
+
+	return combineErrors(errs...)
+}
@@ -0,0 +1,42 @@
+package webcam
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// brokenStreamCam fails every stream right away, its channels are closed once
+// the stream is stopped.
+type brokenStreamCam struct {
+	*fakeControlCam
+}
+
+func (c brokenStreamCam) StreamFrames(framesize *DiscreteFrameSize, options StreamOptions, frameChan chan Frame, errChan chan error, stop chan bool) {
+	errChan <- syscall.EIO
+	<-stop
+	close(frameChan)
+	close(errChan)
+}
+
+func TestFailedAutofocusRestoresFocus(t *testing.T) {
+	controls := newFakeControlCam(
+		Control{ID: CID_FOCUS_ABSOLUTE, Name: "Focus, Absolute", Type: CTRL_TYPE_INTEGER, Minimum: 0, Maximum: 250, Step: 5, Default: 0},
+		Control{ID: CID_FOCUS_AUTO, Name: "Focus, Auto", Type: CTRL_TYPE_BOOLEAN, Minimum: 0, Maximum: 1, Step: 1, Default: 1},
+	)
+	controls.values[CID_FOCUS_ABSOLUTE] = 120
+
+	_, err := autofocus(brokenStreamCam{controls}, testFrameSize(t), AutofocusOptions{})
+
+	if !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Autofocus returned %v, expected %v", err, syscall.EIO)
+	}
+
+	if focus := controls.value(CID_FOCUS_ABSOLUTE); focus != 120 {
+		t.Errorf("Focus is at %d, expected 120", focus)
+	}
+
+	if auto := controls.value(CID_FOCUS_AUTO); auto != 1 {
+		t.Errorf("Autofocus is %d, expected it switched back on", auto)
+	}
+}
@@ -0,0 +1,153 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+//-----------------------------------------------------------------------------
+//BACKEND
+//-----------------------------------------------------------------------------
+
+// backend issues the ioctls, memory mappings, polls and reads a device captures
+// frames with, as well as the ioctls of extended controls. Devices talk to the
+// driver through v4l2Backend, the tests use a fake one instead.
+type backend interface {
+	enumFormat(fd int, bufType BufferType, index uint32, desc *C.struct_v4l2_fmtdesc) error
+	setFormat(fd int, bufType BufferType, frameSize *DiscreteFrameSize, format *C.struct_v4l2_format) error
+	getFormat(fd int, bufType BufferType, format *C.struct_v4l2_format) error
+	getFrameInterval(fd int, bufType BufferType, capture *C.struct_v4l2_captureparm) error
+	setFrameInterval(fd int, bufType BufferType, interval *C.struct_v4l2_fract) error
+	requestBuffers(fd int, bufType BufferType, memory MemoryType, count uint32) (uint32, error)
+	queryBuffer(fd int, buffer *C.struct_v4l2_buffer) error
+	exportBuffer(fd int, bufType BufferType, index uint32, plane uint32) (int, error)
+	queueBuffer(fd int, buffer *C.struct_v4l2_buffer) error
+	dequeueBuffer(fd int, buffer *C.struct_v4l2_buffer) error
+	streamOn(fd int, bufType BufferType) error
+	streamOff(fd int, bufType BufferType) error
+	mmap(fd int, length uint32, offset uint32) ([]byte, error)
+	munmap(data []byte) error
+	poll(fd int, events C.short, timeout int) (C.short, error)
+	read(fd int, data []byte) (int, error)
+	queryExtControl(fd int, id uint32, ctrl *C.struct_v4l2_query_ext_ctrl) error
+	//op is one of extGet, extSet and extTry, the returned index is that of the
+	//failed control or count when the request failed as a whole
+	extControls(fd int, op int, count uint32, controls *C.struct_v4l2_ext_control) (uint32, error)
+}
+
+// v4l2Backend talks to the driver.
+type v4l2Backend struct{}
+
+func (v4l2Backend) enumFormat(fd int, bufType BufferType, index uint32, desc *C.struct_v4l2_fmtdesc) error {
+	_, err := C.enumFormat(C.int(fd), C.__u32(bufType), C.__u32(index), desc)
+	return err
+}
+
+func (v4l2Backend) setFormat(fd int, bufType BufferType, frameSize *DiscreteFrameSize, format *C.struct_v4l2_format) error {
+	_, err := C.setFormat(C.int(fd), C.__u32(bufType), C.__u32(frameSize.PixelFormat.FourCC()), C.__u32(frameSize.Width), C.__u32(frameSize.Height), format)
+	return err
+}
+
+func (v4l2Backend) getFormat(fd int, bufType BufferType, format *C.struct_v4l2_format) error {
+	_, err := C.getFormat(C.int(fd), C.__u32(bufType), format)
+	return err
+}
+
+func (v4l2Backend) getFrameInterval(fd int, bufType BufferType, capture *C.struct_v4l2_captureparm) error {
+	_, err := C.getFrameInterval(C.int(fd), C.__u32(bufType), capture)
+	return err
+}
+
+func (v4l2Backend) setFrameInterval(fd int, bufType BufferType, interval *C.struct_v4l2_fract) error {
+	_, err := C.setFrameInterval(C.int(fd), C.__u32(bufType), interval)
+	return err
+}
+
+func (v4l2Backend) requestBuffers(fd int, bufType BufferType, memory MemoryType, count uint32) (uint32, error) {
+	var granted C.__u32
+	_, err := C.requestBuffers(C.int(fd), C.__u32(bufType), C.__u32(memory), C.__u32(count), &granted)
+	return uint32(granted), err
+}
+
+func (v4l2Backend) queryBuffer(fd int, buffer *C.struct_v4l2_buffer) error {
+	_, err := C.queryBuffer(C.int(fd), buffer)
+	return err
+}
+
+func (v4l2Backend) exportBuffer(fd int, bufType BufferType, index uint32, plane uint32) (int, error) {
+	var dmabuf C.int
+	_, err := C.exportBuffer(C.int(fd), C.__u32(bufType), C.__u32(index), C.__u32(plane), &dmabuf)
+	return int(dmabuf), err
+}
+
+func (v4l2Backend) queueBuffer(fd int, buffer *C.struct_v4l2_buffer) error {
+	_, err := C.queueBuffer(C.int(fd), buffer)
+	return err
+}
+
+func (v4l2Backend) dequeueBuffer(fd int, buffer *C.struct_v4l2_buffer) error {
+	_, err := C.dequeueBuffer(C.int(fd), buffer)
+	return err
+}
+
+func (v4l2Backend) streamOn(fd int, bufType BufferType) error {
+	_, err := C.streamOn(C.int(fd), C.__u32(bufType))
+	return err
+}
+
+func (v4l2Backend) streamOff(fd int, bufType BufferType) error {
+	_, err := C.streamOff(C.int(fd), C.__u32(bufType))
+	return err
+}
+
+func (v4l2Backend) mmap(fd int, length uint32, offset uint32) ([]byte, error) {
+
+	ptr, err := C.mmap2(C.int(fd), C.__u32(length), C.__u32(offset))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ptr == nil {
+		return nil, errors.New("Cannot mmap buffer of the device.")
+	}
+
+	return (*[1 << 30]byte)(ptr)[:length:length], nil
+}
+
+func (v4l2Backend) munmap(data []byte) error {
+	_, err := C.munmap2(unsafe.Pointer(&data[0]), C.uint(len(data)))
+	return err
+}
+
+// poll returns the events that occurred, an error only when poll() failed.
+func (v4l2Backend) poll(fd int, events C.short, timeout int) (C.short, error) {
+
+	var revents C.short
+	result, err := C.pollDevice(C.int(fd), events, C.int(timeout), &revents)
+
+	if result < 0 {
+		return 0, err
+	}
+
+	return revents, nil
+}
+
+func (v4l2Backend) read(fd int, data []byte) (int, error) {
+	return syscall.Read(fd, data)
+}
+
+func (v4l2Backend) queryExtControl(fd int, id uint32, ctrl *C.struct_v4l2_query_ext_ctrl) error {
+	_, err := C.queryExtControl(C.int(fd), C.__u32(id), ctrl)
+	return err
+}
+
+func (v4l2Backend) extControls(fd int, op int, count uint32, controls *C.struct_v4l2_ext_control) (uint32, error) {
+	var errorIndex C.__u32
+	_, err := C.extControls(C.int(fd), C.int(op), C.V4L2_CTRL_WHICH_CUR_VAL, C.__u32(count), controls, &errorIndex)
+	return uint32(errorIndex), err
+}
@@ -0,0 +1,723 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+// #define _GNU_SOURCE
+// #include <sys/mman.h>
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+//-----------------------------------------------------------------------------
+//FAKE BACKEND
+//-----------------------------------------------------------------------------
+
+// fakeBackend stands in for the driver of a single-planar capture device in the
+// tests, which cannot use cgo themselves. Frames are two bytes per pixel, every
+// byte of a frame holds the low byte of its sequence number. Buffers live in
+// memfds, so that they can be mapped and exported like those of a driver.
+// The backend records the ioctls it is asked for and fails those it is told to.
+type fakeBackend struct {
+	mu sync.Mutex
+
+	formats  []FourCC
+	failures map[string]error
+	calls    map[string]int
+
+	layout    frameLayout
+	memfds    []int
+	queued    []uint32
+	streaming bool
+	sequence  uint32
+	mappings  int
+	scratch   []byte
+	//no frame gets captured while stalled
+	stalled bool
+
+	//extended controls ordered by their IDs
+	controls []*fakeExtControl
+}
+
+// how long a poll of the fake waits between checks for a frame
+const fakePollInterval = time.Millisecond
+
+func newFakeBackend(formats ...FourCC) *fakeBackend {
+	return &fakeBackend{formats: formats, failures: map[string]error{}, calls: map[string]int{}}
+}
+
+// fail makes the operation, named like the ioctl or "mmap", "munmap", "poll"
+// and "read", fail with the error from now on.
+func (f *fakeBackend) fail(op string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures[op] = err
+}
+
+// called returns how many times the operation has been issued.
+func (f *fakeBackend) called(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[op]
+}
+
+// stall stops or resumes capturing of frames.
+func (f *fakeBackend) stall(stalled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stalled = stalled
+}
+
+// liveMappings returns the number of buffers mapped and not unmapped yet.
+func (f *fakeBackend) liveMappings() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.mappings
+}
+
+// call records the operation, the caller holds the lock.
+func (f *fakeBackend) call(op string) error {
+	f.calls[op]++
+	return f.failures[op]
+}
+
+func (f *fakeBackend) enumFormat(fd int, bufType BufferType, index uint32, desc *C.struct_v4l2_fmtdesc) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("ENUM_FMT"); err != nil {
+		return err
+	}
+
+	if bufType != BUF_TYPE_VIDEO_CAPTURE || index >= uint32(len(f.formats)) {
+		return syscall.EINVAL
+	}
+
+	desc.pixelformat = C.__u32(f.formats[index])
+	name := []byte(f.formats[index].String())
+
+	for i := 0; i < len(name) && i < len(desc.description)-1; i++ {
+		desc.description[i] = C.__u8(name[i])
+	}
+
+	return nil
+}
+
+func (f *fakeBackend) setFormat(fd int, bufType BufferType, frameSize *DiscreteFrameSize, format *C.struct_v4l2_format) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("S_FMT"); err != nil {
+		return err
+	}
+
+	if bufType != BUF_TYPE_VIDEO_CAPTURE || len(f.memfds) > 0 {
+		return syscall.EBUSY
+	}
+
+	stride := 2 * frameSize.Width
+	f.layout = frameLayout{
+		format:  frameSize.PixelFormat.FourCC(),
+		width:   frameSize.Width,
+		height:  frameSize.Height,
+		strides: []uint32{stride},
+		sizes:   []uint32{stride * frameSize.Height},
+	}
+
+	f.fillFormat(format)
+	return nil
+}
+
+func (f *fakeBackend) getFormat(fd int, bufType BufferType, format *C.struct_v4l2_format) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("G_FMT"); err != nil {
+		return err
+	}
+
+	f.fillFormat(format)
+	return nil
+}
+
+func (f *fakeBackend) fillFormat(format *C.struct_v4l2_format) {
+	format._type = C.V4L2_BUF_TYPE_VIDEO_CAPTURE
+	pix := (*C.struct_v4l2_pix_format)(unsafe.Pointer(&format.fmt))
+	pix.pixelformat = C.__u32(f.layout.format)
+	pix.width = C.__u32(f.layout.width)
+	pix.height = C.__u32(f.layout.height)
+
+	if len(f.layout.sizes) > 0 {
+		pix.bytesperline = C.__u32(f.layout.strides[0])
+		pix.sizeimage = C.__u32(f.layout.sizes[0])
+	}
+}
+
+func (f *fakeBackend) getFrameInterval(fd int, bufType BufferType, capture *C.struct_v4l2_captureparm) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	capture.capability = C.V4L2_CAP_TIMEPERFRAME
+	capture.timeperframe = C.struct_v4l2_fract{numerator: 1, denominator: 30}
+
+	return f.call("G_PARM")
+}
+
+func (f *fakeBackend) setFrameInterval(fd int, bufType BufferType, interval *C.struct_v4l2_fract) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.call("S_PARM")
+}
+
+// requestBuffers creates a memfd for every buffer, releasing them by a request
+// of no buffers is recorded as "REQBUFS(0)".
+func (f *fakeBackend) requestBuffers(fd int, bufType BufferType, memory MemoryType, count uint32) (uint32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if count == 0 {
+		if err := f.call("REQBUFS(0)"); err != nil {
+			return 0, err
+		}
+
+		for _, memfd := range f.memfds {
+			syscall.Close(memfd)
+		}
+
+		f.memfds = nil
+		f.queued = nil
+		return 0, nil
+	}
+
+	if err := f.call("REQBUFS"); err != nil {
+		return 0, err
+	}
+
+	if memory != MEMORY_MMAP {
+		return 0, syscall.EINVAL
+	}
+
+	if len(f.memfds) > 0 {
+		return 0, syscall.EBUSY
+	}
+
+	for i := uint32(0); i < count; i++ {
+		name := C.CString(fmt.Sprintf("fake-buffer-%d", i))
+		memfd, err := C.memfd_create(name, 0)
+		C.free(unsafe.Pointer(name))
+
+		if memfd < 0 {
+			return 0, err
+		}
+
+		f.memfds = append(f.memfds, int(memfd))
+
+		if err := syscall.Ftruncate(int(memfd), int64(f.bufferLength())); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+func (f *fakeBackend) bufferLength() uint32 {
+	return pageAlign(f.layout.sizes[0])
+}
+
+func (f *fakeBackend) queryBuffer(fd int, buffer *C.struct_v4l2_buffer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("QUERYBUF"); err != nil {
+		return err
+	}
+
+	if int(buffer.index) >= len(f.memfds) {
+		return syscall.EINVAL
+	}
+
+	buffer.length = C.__u32(f.bufferLength())
+	*(*C.__u32)(unsafe.Pointer(&buffer.m)) = C.__u32(uint32(buffer.index) * f.bufferLength())
+
+	return nil
+}
+
+// exportBuffer exports a duplicate of the memfd of the buffer.
+func (f *fakeBackend) exportBuffer(fd int, bufType BufferType, index uint32, plane uint32) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("EXPBUF"); err != nil {
+		return -1, err
+	}
+
+	if int(index) >= len(f.memfds) || plane > 0 {
+		return -1, syscall.EINVAL
+	}
+
+	return syscall.Dup(f.memfds[index])
+}
+
+func (f *fakeBackend) queueBuffer(fd int, buffer *C.struct_v4l2_buffer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("QBUF"); err != nil {
+		return err
+	}
+
+	if int(buffer.index) >= len(f.memfds) {
+		return syscall.EINVAL
+	}
+
+	for _, index := range f.queued {
+		if index == uint32(buffer.index) {
+			return syscall.EINVAL
+		}
+	}
+
+	f.queued = append(f.queued, uint32(buffer.index))
+	return nil
+}
+
+// dequeueBuffer captures a frame into the first queued buffer.
+func (f *fakeBackend) dequeueBuffer(fd int, buffer *C.struct_v4l2_buffer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("DQBUF"); err != nil {
+		return err
+	}
+
+	if !f.streaming {
+		return syscall.EINVAL
+	}
+
+	if len(f.queued) == 0 {
+		return syscall.EAGAIN
+	}
+
+	index := f.queued[0]
+	f.queued = f.queued[1:]
+
+	size := int(f.layout.sizes[0])
+
+	if _, err := syscall.Pwrite(f.memfds[index], f.frame(size), 0); err != nil {
+		return err
+	}
+
+	now := monotonicNow()
+
+	buffer.index = C.__u32(index)
+	buffer.bytesused = C.__u32(size)
+	buffer.sequence = C.__u32(f.sequence)
+	buffer.flags = C.V4L2_BUF_FLAG_TIMESTAMP_MONOTONIC
+	buffer.timestamp.tv_sec = C.__time_t(now / time.Second)
+	buffer.timestamp.tv_usec = C.__suseconds_t(now % time.Second / time.Microsecond)
+
+	f.sequence++
+	return nil
+}
+
+// frame returns the content of the next frame.
+func (f *fakeBackend) frame(size int) []byte {
+	if cap(f.scratch) < size {
+		f.scratch = make([]byte, size)
+	}
+
+	data := f.scratch[:size]
+
+	for i := range data {
+		data[i] = byte(f.sequence)
+	}
+
+	return data
+}
+
+func (f *fakeBackend) streamOn(fd int, bufType BufferType) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("STREAMON"); err != nil {
+		return err
+	}
+
+	f.streaming = true
+	return nil
+}
+
+// streamOff stops streaming and returns all the queued buffers, like a driver.
+func (f *fakeBackend) streamOff(fd int, bufType BufferType) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("STREAMOFF"); err != nil {
+		return err
+	}
+
+	f.streaming = false
+	f.queued = nil
+	return nil
+}
+
+func (f *fakeBackend) mmap(fd int, length uint32, offset uint32) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("mmap"); err != nil {
+		return nil, err
+	}
+
+	index := int(offset / f.bufferLength())
+
+	if index >= len(f.memfds) {
+		return nil, syscall.EINVAL
+	}
+
+	data, err := syscall.Mmap(f.memfds[index], 0, int(length), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.mappings++
+	return data, nil
+}
+
+func (f *fakeBackend) munmap(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("munmap"); err != nil {
+		return err
+	}
+
+	if err := syscall.Munmap(data); err != nil {
+		return err
+	}
+
+	f.mappings--
+	return nil
+}
+
+// poll reports a frame when a streaming buffer is queued, reading is always
+// ready. Otherwise it waits for the timeout, forever when it is negative.
+func (f *fakeBackend) poll(fd int, events C.short, timeout int) (C.short, error) {
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Millisecond)
+
+	for {
+		f.mu.Lock()
+		err := f.call("poll")
+		ready := !f.stalled && ((f.streaming && len(f.queued) > 0) || (!f.streaming && len(f.memfds) == 0))
+		f.mu.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if ready && events&C.POLLIN != 0 {
+			return C.POLLIN, nil
+		}
+
+		if timeout >= 0 && !time.Now().Before(deadline) {
+			return 0, nil
+		}
+
+		time.Sleep(fakePollInterval)
+	}
+}
+
+func (f *fakeBackend) read(fd int, data []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("read"); err != nil {
+		return 0, err
+	}
+
+	n := copy(data, f.frame(int(f.layout.sizes[0])))
+	f.sequence++
+
+	return n, nil
+}
+
+//-----------------------------------------------------------------------------
+//FAKE EXTENDED CONTROLS
+//-----------------------------------------------------------------------------
+
+// fakeExtControl is an extended control of the fake backend with its value,
+// which is kept in payload for string, array and compound controls.
+type fakeExtControl struct {
+	ExtControl
+	value   int64
+	payload []byte
+	//size of the payload passed by the last set or try
+	passed uint32
+	//error setting the control fails with after the request has been validated
+	failure error
+}
+
+func (c *fakeExtControl) hasPayload() bool {
+	return c.Type == CTRL_TYPE_STRING || c.Type >= CTRL_TYPE_U8 || c.Elems > 1
+}
+
+// addExtControl adds an extended control, its value is the default one.
+func (f *fakeBackend) addExtControl(control ExtControl) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if control.Elems == 0 {
+		control.Elems = 1
+	}
+
+	c := &fakeExtControl{ExtControl: control, value: control.Default}
+
+	if c.hasPayload() {
+		c.payload = make([]byte, control.Elems*control.ElemSize)
+	}
+
+	f.controls = append(f.controls, c)
+	sort.Slice(f.controls, func(i, j int) bool { return f.controls[i].ID < f.controls[j].ID })
+}
+
+// failExtControl makes setting the control fail with the error, nil clears it.
+func (f *fakeBackend) failExtControl(id ControlID, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c := f.findExtControl(uint32(id)); c != nil {
+		c.failure = err
+	}
+}
+
+// extControl returns a copy of the control and its value.
+func (f *fakeBackend) extControl(id ControlID) fakeExtControl {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c := f.findExtControl(uint32(id)); c != nil {
+		result := *c
+		result.payload = append([]byte(nil), c.payload...)
+		return result
+	}
+
+	return fakeExtControl{}
+}
+
+// findExtControl finds a control by its ID, the caller holds the lock.
+func (f *fakeBackend) findExtControl(id uint32) *fakeExtControl {
+	for _, c := range f.controls {
+		if uint32(c.ID) == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *fakeBackend) queryExtControl(fd int, id uint32, ctrl *C.struct_v4l2_query_ext_ctrl) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("QUERY_EXT_CTRL"); err != nil {
+		return err
+	}
+
+	var found *fakeExtControl
+	next := uint32(C.V4L2_CTRL_FLAG_NEXT_CTRL | C.V4L2_CTRL_FLAG_NEXT_COMPOUND)
+
+	if id&next != 0 {
+		for _, c := range f.controls {
+			if uint32(c.ID) > id&^next {
+				found = c
+				break
+			}
+		}
+	} else {
+		found = f.findExtControl(id)
+	}
+
+	if found == nil {
+		return syscall.EINVAL
+	}
+
+	*ctrl = C.struct_v4l2_query_ext_ctrl{}
+	ctrl.id = C.__u32(found.ID)
+	ctrl._type = C.__u32(found.Type)
+	ctrl.minimum = C.__s64(found.Minimum)
+	ctrl.maximum = C.__s64(found.Maximum)
+	ctrl.step = C.__u64(found.Step)
+	ctrl.default_value = C.__s64(found.Default)
+	ctrl.flags = C.__u32(found.Flags)
+	ctrl.elems = C.__u32(found.Elems)
+	ctrl.elem_size = C.__u32(found.ElemSize)
+	ctrl.nr_of_dims = C.__u32(len(found.Dims))
+
+	if found.hasPayload() {
+		ctrl.flags |= C.V4L2_CTRL_FLAG_HAS_PAYLOAD
+	}
+
+	for i, dim := range found.Dims {
+		ctrl.dims[i] = C.__u32(dim)
+	}
+
+	for i := 0; i < len(found.Name) && i < len(ctrl.name)-1; i++ {
+		ctrl.name[i] = C.char(found.Name[i])
+	}
+
+	return nil
+}
+
+// extControls validates all the controls before it changes any, like drivers
+// do. Invalid controls of a set make the request fail as a whole, those of a get
+// or try are reported by their index, as well as controls failing to be set.
+func (f *fakeBackend) extControls(fd int, op int, count uint32, controls *C.struct_v4l2_ext_control) (uint32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(extOpToString[op]); err != nil {
+		return count, err
+	}
+
+	invalid := func(index uint32, err error) (uint32, error) {
+		if op == extSet {
+			return count, err
+		}
+		return index, err
+	}
+
+	found := make([]*fakeExtControl, count)
+
+	for i := uint32(0); i < count; i++ {
+		c := f.findExtControl(uint32(C.extID(controls, C.__u32(i))))
+
+		if c == nil {
+			return invalid(i, syscall.EINVAL)
+		}
+
+		found[i] = c
+		size := uint32(C.extSize(controls, C.__u32(i)))
+
+		switch {
+		case c.hasPayload() && op == extGet && size < uint32(len(c.payload)):
+			//the driver tells the size it needs
+			C.setExtSize(controls, C.__u32(i), C.__u32(len(c.payload)))
+			return i, syscall.ENOSPC
+		case c.hasPayload() && size > uint32(len(c.payload)):
+			return invalid(i, syscall.ENOSPC)
+		case !c.hasPayload() && op != extGet:
+			if value := int64(C.extValue(controls, C.__u32(i), c.is64())); value < c.Minimum || value > c.Maximum {
+				return invalid(i, syscall.ERANGE)
+			}
+		}
+	}
+
+	for i, c := range found {
+		index := C.__u32(i)
+
+		switch {
+		case op == extGet && c.hasPayload():
+			copy((*[1 << 30]byte)(C.extPayload(controls, index))[:len(c.payload):len(c.payload)], c.payload)
+		case op == extGet:
+			C.setExtValue(controls, index, C.__u32(c.ID), C.__s64(c.value), c.is64())
+		case op == extTry && c.hasPayload():
+			c.passed = uint32(C.extSize(controls, index))
+		case op == extSet:
+			if c.failure != nil {
+				return uint32(i), c.failure
+			}
+
+			if c.hasPayload() {
+				c.passed = uint32(C.extSize(controls, index))
+				c.payload = make([]byte, len(c.payload))
+				copy(c.payload, C.GoBytes(C.extPayload(controls, index), C.int(c.passed)))
+			} else {
+				c.value = int64(C.extValue(controls, index, c.is64()))
+			}
+		}
+	}
+
+	return count, nil
+}
+
+func (c *fakeExtControl) is64() C.int {
+	if c.Type == CTRL_TYPE_INTEGER64 {
+		return 1
+	}
+	return 0
+}
+
+// newFakeDevice opens a device capturing through the backend, /dev/null stands
+// in for its file.
+func newFakeDevice(backend *fakeBackend) (*device, error) {
+
+	file, err := os.Open(os.DevNull)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info := WebcamInfo{Path: "/dev/video-fake", Name: "fake", Card: "Fake Camera"}
+
+	return &device{file: file, info: info, backend: backend, bufType: BUF_TYPE_VIDEO_CAPTURE, canStream: true, canRead: true}, nil
+}
+
+//-----------------------------------------------------------------------------
+//FAKE EVENTS
+//-----------------------------------------------------------------------------
+
+// fakeEvent encodes an event the way the driver queues it, the inverse of
+// newEvent. ctrlType tells the width of the value of a CtrlEvent.
+func fakeEvent(event Event, ctrlType ControlType) *C.struct_v4l2_event {
+
+	result := &C.struct_v4l2_event{_type: C.__u32(event.Type())}
+	header := event.Header()
+
+	result.sequence = C.__u32(header.Sequence)
+	result.timestamp.tv_sec = C.__time_t(header.Timestamp / time.Second)
+	result.timestamp.tv_nsec = C.__syscall_slong_t(header.Timestamp % time.Second)
+
+	payload := unsafe.Pointer(&result.u[0])
+
+	switch e := event.(type) {
+	case CtrlEvent:
+		result.id = C.__u32(e.ID)
+
+		ctrl := (*C.struct_v4l2_event_ctrl)(payload)
+		ctrl.changes = C.__u32(e.Changes)
+		ctrl._type = C.__u32(ctrlType)
+		ctrl.flags = C.__u32(e.Flags)
+		ctrl.minimum = C.__s32(e.Minimum)
+		ctrl.maximum = C.__s32(e.Maximum)
+		ctrl.step = C.__s32(e.Step)
+		ctrl.default_value = C.__s32(e.Default)
+
+		if ctrlType == CTRL_TYPE_INTEGER64 {
+			*(*int64)(unsafe.Pointer(&ctrl.anon0[0])) = e.Value
+		} else {
+			*(*int32)(unsafe.Pointer(&ctrl.anon0[0])) = int32(e.Value)
+		}
+	case SourceChangeEvent:
+		change := (*C.struct_v4l2_event_src_change)(payload)
+		change.changes = C.__u32(e.Changes)
+	case FrameSyncEvent:
+		sync := (*C.struct_v4l2_event_frame_sync)(payload)
+		sync.frame_sequence = C.__u32(e.FrameSequence)
+	}
+
+	return result
+}
@@ -0,0 +1,177 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	MEMORY_MMAP    MemoryType = C.V4L2_MEMORY_MMAP
+	MEMORY_USERPTR MemoryType = C.V4L2_MEMORY_USERPTR
+	MEMORY_DMABUF  MemoryType = C.V4L2_MEMORY_DMABUF
+)
+
+var memoryTypeToString = map[MemoryType]string{
+	MEMORY_MMAP:    "V4L2_MEMORY_MMAP",
+	MEMORY_USERPTR: "V4L2_MEMORY_USERPTR",
+	MEMORY_DMABUF:  "V4L2_MEMORY_DMABUF",
+}
+
+func (m MemoryType) String() string {
+	if name, ok := memoryTypeToString[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("MemoryType(%d)", uint32(m))
+}
+
+//-----------------------------------------------------------------------------
+//REQUESTING BUFFERS
+//-----------------------------------------------------------------------------
+
+// requestBuffers requests buffers of the memory the options ask for and falls
+// back to MMAP buffers when the driver rejects that memory. It returns the number
+// of buffers the driver granted.
+func (d *device) requestBuffers(options StreamOptions) (uint32, error) {
+
+	memory := options.Memory
+	count := options.Buffers
+
+	if memory == 0 {
+		memory = MEMORY_MMAP
+	}
+
+	if memory == MEMORY_DMABUF {
+		if len(options.DMABufFds) == 0 {
+			return 0, errors.New("No dma-buf to import has been given.")
+		}
+		count = len(options.DMABufFds)
+	}
+
+	granted, err := d.requestBuffersOf(memory, count)
+
+	if err == syscall.EINVAL && memory != MEMORY_MMAP {
+		d.log(LEVEL_INFO, "Driver rejects memory of buffers, falling back", "memory", memory, "fallback", MEMORY_MMAP)
+		granted, err = d.requestBuffersOf(MEMORY_MMAP, options.Buffers)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if granted == 0 {
+		return 0, errors.New("Driver did not grant any buffer.")
+	}
+
+	//there is nothing to import into buffers the driver added on its own
+	if d.memory == MEMORY_DMABUF && granted > uint32(count) {
+		granted = uint32(count)
+	}
+
+	return granted, nil
+}
+
+func (d *device) requestBuffersOf(memory MemoryType, count int) (uint32, error) {
+
+	d.memory = memory
+	d.requested = true
+	granted, err := d.backend.requestBuffers(int(d.file.Fd()), d.bufType, memory, uint32(count))
+	d.ioctlFailed("REQBUFS", err)
+
+	return granted, err
+}
+
+//-----------------------------------------------------------------------------
+//USERPTR AND DMABUF MEMORY
+//-----------------------------------------------------------------------------
+
+// allocateBuffer allocates page aligned memory for every plane of the format,
+// the driver captures into it directly.
+func (d *device) allocateBuffer() (mappedBuffer, error) {
+
+	result := mappedBuffer{}
+
+	for i, size := range d.layout.sizes {
+		if size == 0 {
+			return result, fmt.Errorf("Driver does not tell the size of plane %d.", i)
+		}
+
+		length := pageAlign(size)
+		data, err := syscall.Mmap(-1, 0, int(length), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS)
+
+		if err != nil {
+			return result, err
+		}
+
+		result.planes = append(result.planes, mappedPlane{data: data, length: length, unmap: syscall.Munmap, dmabuf: -1})
+	}
+
+	return result, nil
+}
+
+// importBuffer uses dma-bufs of the caller as the planes of a buffer. They are
+// mapped as well if possible, so that frames can be copied out of them.
+func (d *device) importBuffer(fds []int) (mappedBuffer, error) {
+
+	result := mappedBuffer{}
+
+	if len(fds) != len(d.layout.sizes) {
+		return result, fmt.Errorf("Format has %d planes, %d dma-bufs were given for a buffer.", len(d.layout.sizes), len(fds))
+	}
+
+	for i, fd := range fds {
+		length := d.layout.sizes[i]
+		plane := mappedPlane{length: length, dmabuf: fd}
+
+		data, err := syscall.Mmap(fd, 0, int(length), syscall.PROT_READ, syscall.MAP_SHARED)
+
+		if err == nil {
+			plane.data = data
+			plane.unmap = syscall.Munmap
+		} else {
+			d.log(LEVEL_WARN, "Cannot map dma-buf, its frames will not be copied", errorFields(err, "dmabuf", fd)...)
+		}
+
+		result.planes = append(result.planes, plane)
+	}
+
+	return result, nil
+}
+
+func pageAlign(size uint32) uint32 {
+	page := uint32(os.Getpagesize())
+	return (size + page - 1) / page * page
+}
+
+//-----------------------------------------------------------------------------
+//QUEUEING
+//-----------------------------------------------------------------------------
+
+// queueBuffer hands a buffer to the driver, telling it where the memory of
+// USERPTR and DMABUF planes is.
+func (d *device) queueBuffer(index uint32) error {
+
+	buffer := d.newCaptureBuffer(index)
+
+	for i, plane := range d.buffers[index].planes {
+		switch d.memory {
+		case MEMORY_USERPTR:
+			C.setUserptr(&buffer, C.__u32(i), C.ulong(uintptr(unsafe.Pointer(&plane.data[0]))), C.__u32(plane.length))
+		case MEMORY_DMABUF:
+			C.setDMABuf(&buffer, C.__u32(i), C.int(plane.dmabuf), C.__u32(plane.length))
+		}
+	}
+
+	if err := d.backend.queueBuffer(int(d.file.Fd()), &buffer); err != nil {
+		d.ioctlFailed("QBUF", err)
+		return err
+	}
+
+	d.queued++
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jalasoft/go-webcam"
+)
+
+//----------------------------------------------------------------------------------
+//SNAP
+//----------------------------------------------------------------------------------
+
+type snapView struct {
+	File   string `json:"file"`
+	Format string `json:"format"`
+	Width  uint32 `json:"width"`
+	Height uint32 `json:"height"`
+	Bytes  int    `json:"bytes"`
+}
+
+func runSnap(args []string) error {
+	opts := newOptions("snap")
+	size := frameSizeOptions{}
+	size.register(opts.flags)
+	output := opts.flags.String("o", "", "file to write the snapshot to")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return errors.New("Output file must be given with -o.")
+	}
+
+	cam, err := opts.open()
+
+	if err != nil {
+		return err
+	}
+
+	defer closeWebcam(cam)
+
+	frameSize, err := size.selectFrameSize(cam)
+
+	if err != nil {
+		return err
+	}
+
+	snap, err := cam.TakeSnapshot(frameSize)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(*output, snap.Data(), 0644); err != nil {
+		return err
+	}
+
+	view := snapView{File: *output, Format: frameSize.PixelFormat.Name(), Width: frameSize.Width, Height: frameSize.Height, Bytes: len(snap.Data())}
+
+	if opts.json {
+		return printJSON(view)
+	}
+
+	fmt.Printf("%s: %dx%d %s, %d bytes\n", view.File, view.Width, view.Height, view.Format, view.Bytes)
+	return nil
+}
+
+//----------------------------------------------------------------------------------
+//STREAM
+//----------------------------------------------------------------------------------
+
+type streamView struct {
+	Format   string  `json:"format"`
+	Width    uint32  `json:"width"`
+	Height   uint32  `json:"height"`
+	Frames   int     `json:"frames"`
+	Bytes    int64   `json:"bytes"`
+	Duration float64 `json:"duration_seconds"`
+	FPS      float64 `json:"fps"`
+}
+
+func runStream(args []string) error {
+	opts := newOptions("stream")
+	size := frameSizeOptions{}
+	size.register(opts.flags)
+	duration := opts.flags.Duration("duration", 5*time.Second, "how long to stream")
+	dir := opts.flags.String("o", "", "directory to write every frame to, frames are dropped if empty")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	cam, err := opts.open()
+
+	if err != nil {
+		return err
+	}
+
+	defer closeWebcam(cam)
+
+	frameSize, err := size.selectFrameSize(cam)
+
+	if err != nil {
+		return err
+	}
+
+	view := streamView{Format: frameSize.PixelFormat.Name(), Width: frameSize.Width, Height: frameSize.Height}
+	start := time.Now()
+
+	err = streamFor(cam, frameSize, *duration, func(snap webcam.Snapshot) error {
+		view.Frames++
+		view.Bytes += int64(len(snap.Data()))
+
+		if *dir == "" {
+			return nil
+		}
+
+		name := filepath.Join(*dir, fmt.Sprintf("frame-%06d.%s", view.Frames, fileExtension(frameSize.PixelFormat)))
+		return os.WriteFile(name, snap.Data(), 0644)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	elapsed := time.Since(start)
+	view.Duration = elapsed.Seconds()
+	view.FPS = float64(view.Frames) / elapsed.Seconds()
+
+	if opts.json {
+		return printJSON(view)
+	}
+
+	fmt.Printf("%d frames (%d bytes) of %dx%d %s in %v, %.2f fps\n", view.Frames, view.Bytes, view.Width, view.Height, view.Format, elapsed.Round(time.Millisecond), view.FPS)
+	return nil
+}
+
+//----------------------------------------------------------------------------------
+//RECORD
+//----------------------------------------------------------------------------------
+
+func runRecord(args []string) error {
+	opts := newOptions("record")
+	size := frameSizeOptions{}
+	size.register(opts.flags)
+	duration := opts.flags.Duration("duration", 10*time.Second, "how long to record")
+	output := opts.flags.String("o", "", "file to write the motion JPEG stream to")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return errors.New("Output file must be given with -o.")
+	}
+
+	cam, err := opts.open()
+
+	if err != nil {
+		return err
+	}
+
+	defer closeWebcam(cam)
+
+	frameSize, err := size.selectFrameSize(cam)
+
+	if err != nil {
+		return err
+	}
+
+	if !isJPEG(frameSize.PixelFormat) {
+		return fmt.Errorf("Recording needs a JPEG pixel format, %s was selected.", frameSize.PixelFormat.Name())
+	}
+
+	file, err := os.Create(*output)
+
+	if err != nil {
+		return err
+	}
+
+	frames := 0
+
+	err = streamFor(cam, frameSize, *duration, func(snap webcam.Snapshot) error {
+		frames++
+		_, err := file.Write(snap.Data())
+		return err
+	})
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		return printJSON(map[string]interface{}{"file": *output, "frames": frames})
+	}
+
+	fmt.Printf("%s: %d frames\n", *output, frames)
+	return nil
+}
+
+//----------------------------------------------------------------------------------
+//STREAMING HELPERS
+//----------------------------------------------------------------------------------
+
+// streamFor streams from the webcam for the given duration and passes every
+// snapshot to the consumer.
+func streamFor(cam webcam.Webcam, frameSize *webcam.DiscreteFrameSize, duration time.Duration, consume func(webcam.Snapshot) error) error {
+
+	snaps := make(chan webcam.Snapshot)
+	errs := make(chan error, 1)
+	stop := make(chan bool, 1)
+
+	go cam.StreamSnapshots(frameSize, snaps, errs, stop)
+
+	timeout := time.After(duration)
+	var consumeErr error
+
+	for {
+		select {
+		case snap, ok := <-snaps:
+			if !ok {
+				if err := <-errs; err != nil {
+					return err
+				}
+				return consumeErr
+			}
+
+			if consumeErr != nil {
+				snap.Release()
+				continue
+			}
+
+			consumeErr = consume(snap)
+			snap.Release()
+
+			if consumeErr != nil {
+				stop <- true
+				timeout = nil
+			}
+
+		case <-timeout:
+			stop <- true
+			timeout = nil
+		}
+	}
+}
+
+func isJPEG(format webcam.PixelFormat) bool {
+	return format.Name() == "V4L2_PIX_FMT_MJPEG" || format.Name() == "V4L2_PIX_FMT_JPEG"
+}
+
+func fileExtension(format webcam.PixelFormat) string {
+	if isJPEG(format) {
+		return "jpg"
+	}
+	return "raw"
+}
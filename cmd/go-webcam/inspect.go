@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jalasoft/go-webcam"
+)
+
+//----------------------------------------------------------------------------------
+//LIST
+//----------------------------------------------------------------------------------
+
+func runList(args []string) error {
+	opts := newOptions("list")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	infos, err := webcam.FindWebcams()
+
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		return printJSON(infos)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tCARD\tDRIVER\tBUS\tUSB ID\tSERIAL")
+
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%04x:%04x\t%s\n", info.Path, info.Card, info.Name, info.BusInfo, info.VendorID, info.ProductID, info.Serial)
+	}
+
+	return w.Flush()
+}
+
+//----------------------------------------------------------------------------------
+//INFO
+//----------------------------------------------------------------------------------
+
+type infoView struct {
+	Path         string   `json:"path"`
+	Driver       string   `json:"driver"`
+	Card         string   `json:"card"`
+	BusInfo      string   `json:"bus_info"`
+	Version      string   `json:"version"`
+	Capabilities []string `json:"capabilities"`
+}
+
+func runInfo(args []string) error {
+	opts := newOptions("info")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	cam, err := opts.open()
+
+	if err != nil {
+		return err
+	}
+
+	defer closeWebcam(cam)
+
+	caps, err := cam.QueryCapabilities()
+
+	if err != nil {
+		return err
+	}
+
+	version := caps.Version()
+
+	view := infoView{
+		Path:         opts.device,
+		Driver:       caps.Driver(),
+		Card:         caps.Card(),
+		BusInfo:      caps.BusInfo(),
+		Version:      fmt.Sprintf("%d.%d.%d", version>>16, (version>>8)&0xff, version&0xff),
+		Capabilities: capabilityNames(caps.Capabilities()),
+	}
+
+	if opts.json {
+		return printJSON(view)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Path:\t%s\n", view.Path)
+	fmt.Fprintf(w, "Driver:\t%s\n", view.Driver)
+	fmt.Fprintf(w, "Card:\t%s\n", view.Card)
+	fmt.Fprintf(w, "Bus info:\t%s\n", view.BusInfo)
+	fmt.Fprintf(w, "Version:\t%s\n", view.Version)
+	fmt.Fprintf(w, "Capabilities:\t%s\n", joinOrDash(view.Capabilities))
+
+	return w.Flush()
+}
+
+//----------------------------------------------------------------------------------
+//FORMATS
+//----------------------------------------------------------------------------------
+
+type formatView struct {
+	FourCC      string `json:"fourcc"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Compressed  bool   `json:"compressed"`
+	Emulated    bool   `json:"emulated"`
+}
+
+var bufferTypes = map[string]webcam.BufferType{
+	"capture":        webcam.BUF_TYPE_VIDEO_CAPTURE,
+	"capture-mplane": webcam.BUF_TYPE_VIDEO_CAPTURE_MPLANE,
+	"output":         webcam.BUF_TYPE_VIDEO_OUTPUT,
+	"output-mplane":  webcam.BUF_TYPE_VIDEO_OUTPUT_MPLANE,
+	"meta":           webcam.BUF_TYPE_META_CAPTURE,
+}
+
+func (v formatView) flags() string {
+	flags := []string{}
+
+	if v.Compressed {
+		flags = append(flags, "compressed")
+	}
+
+	if v.Emulated {
+		flags = append(flags, "emulated")
+	}
+
+	return strings.Join(flags, ",")
+}
+
+func runFormats(args []string) error {
+	opts := newOptions("formats")
+	bufType := opts.flags.String("type", "capture", "buffer type: capture, capture-mplane, output, output-mplane or meta")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	t, ok := bufferTypes[*bufType]
+
+	if !ok {
+		return fmt.Errorf("Unknown buffer type %s.", *bufType)
+	}
+
+	cam, err := opts.open()
+
+	if err != nil {
+		return err
+	}
+
+	defer closeWebcam(cam)
+
+	formats, err := cam.QueryFormatsOf(t)
+
+	if err != nil {
+		return err
+	}
+
+	views := make([]formatView, 0, len(formats))
+	for _, f := range formats {
+		views = append(views, formatView{FourCC: f.FourCC().String(), Name: f.Name(), Description: f.Description(), Compressed: f.Compressed(), Emulated: f.Emulated()})
+	}
+
+	if opts.json {
+		return printJSON(views)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FOURCC\tFORMAT\tDESCRIPTION\tFLAGS")
+
+	for _, v := range views {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.FourCC, v.Name, v.Description, v.flags())
+	}
+
+	return w.Flush()
+}
+
+//----------------------------------------------------------------------------------
+//SIZES
+//----------------------------------------------------------------------------------
+
+type discreteView struct {
+	Width  uint32 `json:"width"`
+	Height uint32 `json:"height"`
+}
+
+type stepwiseView struct {
+	MinWidth   uint32 `json:"min_width"`
+	MaxWidth   uint32 `json:"max_width"`
+	StepWidth  uint32 `json:"step_width"`
+	MinHeight  uint32 `json:"min_height"`
+	MaxHeight  uint32 `json:"max_height"`
+	StepHeight uint32 `json:"step_height"`
+}
+
+type sizesView struct {
+	Format   string         `json:"format"`
+	Discrete []discreteView `json:"discrete"`
+	Stepwise []stepwiseView `json:"stepwise"`
+}
+
+func runSizes(args []string) error {
+	opts := newOptions("sizes")
+	format := opts.flags.String("format", "", "pixel format, all formats if empty")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	cam, err := opts.open()
+
+	if err != nil {
+		return err
+	}
+
+	defer closeWebcam(cam)
+
+	formats, err := cam.QueryFormats()
+
+	if err != nil {
+		return err
+	}
+
+	views := []sizesView{}
+
+	for _, f := range formats {
+		if *format != "" && f.Name() != *format && f.FourCC().String() != *format {
+			continue
+		}
+
+		sizes, err := cam.QueryFrameSizes(f)
+
+		if err != nil {
+			return err
+		}
+
+		view := sizesView{Format: f.Name(), Discrete: []discreteView{}, Stepwise: []stepwiseView{}}
+
+		for _, d := range sizes.Discrete() {
+			view.Discrete = append(view.Discrete, discreteView{d.Width, d.Height})
+		}
+
+		for _, s := range sizes.Stepwise() {
+			view.Stepwise = append(view.Stepwise, stepwiseView{s.MinWidth, s.MaxWidth, s.StepWidth, s.MinHeight, s.MaxHeight, s.StepHeight})
+		}
+
+		views = append(views, view)
+	}
+
+	if *format != "" && len(views) == 0 {
+		return fmt.Errorf("Pixel format %s is not supported by %s.", *format, opts.device)
+	}
+
+	if opts.json {
+		return printJSON(views)
+	}
+
+	for _, view := range views {
+		fmt.Printf("%s:\n", view.Format)
+
+		for _, d := range view.Discrete {
+			fmt.Printf("  %dx%d\n", d.Width, d.Height)
+		}
+
+		for _, s := range view.Stepwise {
+			fmt.Printf("  %d-%d/%d x %d-%d/%d\n", s.MinWidth, s.MaxWidth, s.StepWidth, s.MinHeight, s.MaxHeight, s.StepHeight)
+		}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------
+//CONTROLS
+//----------------------------------------------------------------------------------
+
+type controlView struct {
+	ID      uint32            `json:"id"`
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Minimum int64             `json:"minimum"`
+	Maximum int64             `json:"maximum"`
+	Step    uint64            `json:"step"`
+	Default int64             `json:"default"`
+	Value   *int32            `json:"value,omitempty"`
+	Menu    map[uint32]string `json:"menu,omitempty"`
+}
+
+func runControls(args []string) error {
+	opts := newOptions("controls")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	cam, err := opts.open()
+
+	if err != nil {
+		return err
+	}
+
+	defer closeWebcam(cam)
+
+	controls, err := cam.QueryControls()
+
+	if err != nil {
+		return err
+	}
+
+	views := make([]controlView, 0, len(controls))
+
+	for _, c := range controls {
+		view := controlView{ID: uint32(c.ID), Name: c.Name, Type: c.Type.String(), Minimum: c.Minimum, Maximum: c.Maximum, Step: c.Step, Default: c.Default}
+
+		if !c.WriteOnly() && c.Type != webcam.CTRL_TYPE_BUTTON {
+			if value, err := cam.GetControl(c.ID); err == nil {
+				view.Value = &value
+			}
+		}
+
+		if len(c.Menu) > 0 {
+			view.Menu = map[uint32]string{}
+			for _, item := range c.Menu {
+				view.Menu[item.Index] = item.Name
+			}
+		}
+
+		views = append(views, view)
+	}
+
+	if opts.json {
+		return printJSON(views)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTYPE\tMIN\tMAX\tSTEP\tDEFAULT\tVALUE")
+
+	for _, v := range views {
+		value := "-"
+		if v.Value != nil {
+			value = fmt.Sprintf("%d", *v.Value)
+		}
+
+		fmt.Fprintf(w, "0x%08x\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", v.ID, v.Name, v.Type, v.Minimum, v.Maximum, v.Step, v.Default, value)
+	}
+
+	return w.Flush()
+}
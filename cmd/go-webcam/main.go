@@ -0,0 +1,161 @@
+// Command go-webcam lists, inspects and captures from webcams using the
+// go-webcam library.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jalasoft/go-webcam"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"list":     {"list available webcams", runList},
+	"info":     {"show capabilities of a webcam", runInfo},
+	"formats":  {"list supported pixel formats", runFormats},
+	"sizes":    {"list supported frame sizes", runSizes},
+	"controls": {"list controls and their current values", runControls},
+	"snap":     {"take a snapshot and write it to a file", runSnap},
+	"stream":   {"stream frames for a while and report the frame rate", runStream},
+	"record":   {"record a motion JPEG stream to a file", runRecord},
+	"serve":    {"serve a motion JPEG stream over HTTP", runServe},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "go-webcam %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: go-webcam <command> [options]\n\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nRun 'go-webcam <command> -h' for options of a command.\n")
+}
+
+//----------------------------------------------------------------------------------
+//COMMON OPTIONS
+//----------------------------------------------------------------------------------
+
+type options struct {
+	flags   *flag.FlagSet
+	device  string
+	json    bool
+	verbose bool
+}
+
+func newOptions(name string) *options {
+	o := &options{flags: flag.NewFlagSet(name, flag.ExitOnError)}
+	o.flags.StringVar(&o.device, "d", "/dev/video0", "path of the webcam")
+	o.flags.BoolVar(&o.json, "json", false, "print output as JSON")
+	o.flags.BoolVar(&o.verbose, "v", false, "print log messages of the library")
+	return o
+}
+
+func (o *options) parse(args []string) error {
+	if err := o.flags.Parse(args); err != nil {
+		return err
+	}
+
+	if o.verbose {
+		webcam.SetLogger(webcam.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), webcam.LEVEL_DEBUG))
+	}
+
+	return nil
+}
+
+func (o *options) open() (webcam.Webcam, error) {
+	return webcam.OpenWebcam(o.device)
+}
+
+// frameSizeOptions select the frame size of commands capturing pictures.
+type frameSizeOptions struct {
+	format string
+	width  uint
+	height uint
+}
+
+func (f *frameSizeOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.format, "format", webcam.DEFAULT_PIXEL_FORMAT, "pixel format")
+	flags.UintVar(&f.width, "width", 0, "preferred width, the first supported one if 0")
+	flags.UintVar(&f.height, "height", 0, "preferred height, the first supported one if 0")
+}
+
+func (f *frameSizeOptions) selectFrameSize(cam webcam.Webcam) (*webcam.DiscreteFrameSize, error) {
+	size, err := cam.DiscreteFrameSize().
+		PixelFormatName(f.format).
+		Width(uint32(f.width)).
+		Height(uint32(f.height)).
+		Select()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &size, nil
+}
+
+//----------------------------------------------------------------------------------
+//OUTPUT
+//----------------------------------------------------------------------------------
+
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func closeWebcam(cam webcam.Webcam) {
+	if err := cam.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot close webcam: %v\n", err)
+	}
+}
+
+func capabilityNames(caps []webcam.Capability) []string {
+	names := make([]string, 0, len(caps))
+	for _, c := range caps {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func joinOrDash(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jalasoft/go-webcam"
+	"github.com/jalasoft/go-webcam/metrics"
+)
+
+// how long the server waits for the requests being served when it shuts down
+const serveShutdownTimeout = 5 * time.Second
+
+func runServe(args []string) error {
+	opts := newOptions("serve")
+	size := frameSizeOptions{}
+	size.register(opts.flags)
+	addr := opts.flags.String("addr", ":8080", "address to listen on")
+
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	cam, err := opts.open()
+
+	if err != nil {
+		return err
+	}
+
+	defer closeWebcam(cam)
+
+	frameSize, err := size.selectFrameSize(cam)
+
+	if err != nil {
+		return err
+	}
+
+	if !isJPEG(frameSize.PixelFormat) {
+		return fmt.Errorf("Serving needs a JPEG pixel format, %s was selected.", frameSize.PixelFormat.Name())
+	}
+
+	b := newBroadcaster()
+
+	snaps := make(chan webcam.Snapshot)
+	errs := make(chan error, 1)
+	stop := make(chan bool, 1)
+	streamDone := make(chan error, 1)
+
+	go cam.StreamSnapshots(frameSize, snaps, errs, stop)
+
+	go func() {
+		for snap := range snaps {
+			//clients keep the frame for as long as they write it, so it must
+			//outlive the snapshot's memory
+			frame := append([]byte(nil), snap.Data()...)
+			snap.Release()
+			b.publish(frame)
+		}
+
+		b.close()
+		streamDone <- <-errs
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", b.serveStream)
+	mux.HandleFunc("/snapshot", b.serveSnapshot)
+
+	exporter := metrics.NewExporter()
+	exporter.Add(cam)
+	mux.Handle("/metrics", exporter)
+
+	server := &http.Server{Addr: *addr, Handler: mux}
+	serveDone := make(chan error, 1)
+
+	go func() {
+		serveDone <- server.ListenAndServe()
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	fmt.Printf("Serving %s (%dx%d) on %s\n", opts.device, frameSize.Width, frameSize.Height, *addr)
+
+	select {
+	case err = <-serveDone:
+		stop <- true
+		<-streamDone
+		return err
+	case err = <-streamDone:
+		if err != nil {
+			err = fmt.Errorf("Streaming failed: %w", err)
+		}
+	case <-interrupt:
+		stop <- true
+		err = <-streamDone
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := server.Shutdown(ctx); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+
+	return err
+}
+
+//----------------------------------------------------------------------------------
+//BROADCASTING FRAMES TO CLIENTS
+//----------------------------------------------------------------------------------
+
+// broadcaster keeps the latest frame and wakes up all clients waiting for
+// the next one. Slow clients just skip frames.
+type broadcaster struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	frame    []byte
+	sequence uint64
+	//no more frames are published once the stream has finished
+	closed bool
+}
+
+func newBroadcaster() *broadcaster {
+	b := &broadcaster{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *broadcaster) publish(frame []byte) {
+	b.mu.Lock()
+	b.frame = frame
+	b.sequence++
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// close wakes up all clients for good, the stream has finished.
+func (b *broadcaster) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// wakeOnDone wakes up the waiting clients once the context is done, so that a
+// client that has gone away stops waiting. The returned function releases the
+// context.
+func (b *broadcaster) wakeOnDone(ctx context.Context) func() {
+	released := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			//locking makes sure the client either waits already or sees the
+			//context done before it would wait
+			b.mu.Lock()
+			b.cond.Broadcast()
+			b.mu.Unlock()
+		case <-released:
+		}
+	}()
+
+	return func() { close(released) }
+}
+
+// next waits for a frame newer than the given sequence number. It returns false
+// when the stream has finished or the context is done; contexts must be
+// registered by wakeOnDone.
+func (b *broadcaster) next(ctx context.Context, after uint64) ([]byte, uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.sequence == after {
+		if b.closed || ctx.Err() != nil {
+			return nil, after, false
+		}
+		b.cond.Wait()
+	}
+
+	return b.frame, b.sequence, true
+}
+
+func (b *broadcaster) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	defer b.wakeOnDone(r.Context())()
+
+	frame, _, ok := b.next(r.Context(), 0)
+
+	if !ok {
+		http.Error(w, "Stream has finished.", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(frame)
+}
+
+func (b *broadcaster) serveStream(w http.ResponseWriter, r *http.Request) {
+	defer b.wakeOnDone(r.Context())()
+
+	writer := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+writer.Boundary())
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "image/jpeg")
+
+	var sequence uint64
+
+	for {
+		var frame []byte
+		var ok bool
+
+		if frame, sequence, ok = b.next(r.Context(), sequence); !ok {
+			writer.Close()
+			return
+		}
+
+		part, err := writer.CreatePart(header)
+
+		if err != nil {
+			return
+		}
+
+		if _, err := part.Write(frame); err != nil {
+			return
+		}
+
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
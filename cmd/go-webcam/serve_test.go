@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBroadcasterNextFrame(t *testing.T) {
+	b := newBroadcaster()
+	b.publish([]byte{1})
+
+	frame, sequence, ok := b.next(context.Background(), 0)
+
+	if !ok || !bytes.Equal(frame, []byte{1}) || sequence != 1 {
+		t.Fatalf("Got frame %v, sequence %d, %v, expected the published frame", frame, sequence, ok)
+	}
+
+	//a client waiting for a newer frame wakes up once it is published
+	go b.publish([]byte{2})
+
+	frame, sequence, ok = b.next(context.Background(), sequence)
+
+	if !ok || !bytes.Equal(frame, []byte{2}) || sequence != 2 {
+		t.Errorf("Got frame %v, sequence %d, %v, expected the second frame", frame, sequence, ok)
+	}
+}
+
+func TestBroadcasterWakesClients(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		wake func(b *broadcaster, cancel context.CancelFunc)
+	}{
+		{"client gone", func(b *broadcaster, cancel context.CancelFunc) { cancel() }},
+		{"stream finished", func(b *broadcaster, cancel context.CancelFunc) { b.close() }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := newBroadcaster()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			defer b.wakeOnDone(ctx)()
+
+			done := make(chan bool)
+
+			go func() {
+				_, _, ok := b.next(ctx, 0)
+				done <- ok
+			}()
+
+			c.wake(b, cancel)
+
+			select {
+			case ok := <-done:
+				if ok {
+					t.Errorf("Client got a frame, none was published")
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Client keeps waiting")
+			}
+		})
+	}
+}
+
+func TestServeSnapshot(t *testing.T) {
+	b := newBroadcaster()
+	b.publish([]byte("jpeg"))
+
+	recorder := httptest.NewRecorder()
+	b.serveSnapshot(recorder, httptest.NewRequest("GET", "/snapshot", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "jpeg" {
+		t.Errorf("Got %d %q, expected the frame", recorder.Code, recorder.Body.String())
+	}
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "image/jpeg" {
+		t.Errorf("Content type is %q", contentType)
+	}
+
+	//no frame is coming once the stream has finished
+	b = newBroadcaster()
+	b.close()
+
+	recorder = httptest.NewRecorder()
+	b.serveSnapshot(recorder, httptest.NewRequest("GET", "/snapshot", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Got %d after the stream finished, expected %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestServeStreamEndsWithClient(t *testing.T) {
+	b := newBroadcaster()
+	handlerDone := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handlerDone)
+		b.serveStream(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.publish([]byte("first"))
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+
+	_, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := multipart.NewReader(bufio.NewReader(response.Body), params["boundary"])
+
+	for _, expected := range []string{"first", "second"} {
+		part, err := parts.NextPart()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		//the part ends only with the boundary of the next frame, so just the
+		//frame itself is read
+		data := make([]byte, len(expected))
+
+		if _, err := io.ReadFull(part, data); err != nil || string(data) != expected {
+			t.Fatalf("Got part %q, %v, expected %q", data, err, expected)
+		}
+
+		if contentType := part.Header.Get("Content-Type"); contentType != "image/jpeg" {
+			t.Errorf("Part has content type %q", contentType)
+		}
+
+		if expected == "first" {
+			b.publish([]byte("second"))
+		}
+	}
+
+	//no frame is published anymore, the handler waits until the client leaves
+	cancel()
+
+	select {
+	case <-handlerDone:
+	case <-time.After(time.Second):
+		t.Fatalf("Handler keeps waiting after the client has gone")
+	}
+}
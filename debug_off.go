@@ -0,0 +1,6 @@
+//go:build !webcam_debug
+// +build !webcam_debug
+
+package webcam
+
+const debugBuild = false
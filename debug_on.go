@@ -0,0 +1,7 @@
+//go:build webcam_debug
+// +build webcam_debug
+
+package webcam
+
+// debugBuild enables checks that are too expensive for production builds.
+const debugBuild = true
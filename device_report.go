@@ -0,0 +1,239 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//--------------------------------------------------------------------------------------
+//COLLECTING REPORT
+//--------------------------------------------------------------------------------------
+
+func newDeviceReport(cam Webcam) (DeviceReport, error) {
+
+	report := DeviceReport{Info: cam.Info()}
+
+	caps, err := cam.QueryCapabilities()
+
+	if err != nil {
+		return DeviceReport{}, err
+	}
+
+	report.Capabilities = CapabilitiesReport{
+		Driver:       caps.Driver(),
+		Card:         caps.Card(),
+		BusInfo:      caps.BusInfo(),
+		Version:      caps.Version(),
+		Capabilities: []string{},
+	}
+
+	for _, c := range caps.Capabilities() {
+		report.Capabilities.Capabilities = append(report.Capabilities.Capabilities, c.Name)
+	}
+
+	formats, err := cam.QueryFormats()
+
+	if err != nil {
+		return DeviceReport{}, err
+	}
+
+	report.Formats = []FormatReport{}
+
+	for _, format := range formats {
+		formatReport, err := newFormatReport(cam, format)
+
+		if err != nil {
+			return DeviceReport{}, err
+		}
+
+		report.Formats = append(report.Formats, formatReport)
+	}
+
+	controls, err := cam.QueryControls()
+
+	if err != nil {
+		return DeviceReport{}, err
+	}
+
+	report.Controls = []ControlReport{}
+
+	for _, control := range controls {
+		controlReport := ControlReport{Control: control}
+
+		if !control.WriteOnly() && control.Type != CTRL_TYPE_BUTTON {
+			if value, err := cam.GetControl(control.ID); err == nil {
+				controlReport.Value = &value
+			}
+		}
+
+		report.Controls = append(report.Controls, controlReport)
+	}
+
+	return report, nil
+}
+
+func newFormatReport(cam Webcam, format PixelFormat) (FormatReport, error) {
+
+	report := FormatReport{
+		Name:        format.Name(),
+		Description: format.Description(),
+		Code:        uint32(format.FourCC()),
+		BufferType:  format.BufferType(),
+		Compressed:  format.Compressed(),
+		Emulated:    format.Emulated(),
+		Sizes:       []FrameSizeReport{},
+	}
+
+	sizes, err := cam.QueryFrameSizes(format)
+
+	if err != nil {
+		return FormatReport{}, err
+	}
+
+	for _, size := range sizes.Discrete() {
+		intervals, err := cam.QueryFrameIntervals(size)
+
+		if err != nil {
+			return FormatReport{}, err
+		}
+
+		report.Sizes = append(report.Sizes, FrameSizeReport{
+			Width:             size.Width,
+			Height:            size.Height,
+			Intervals:         intervals.Discrete(),
+			StepwiseIntervals: intervals.Stepwise(),
+		})
+	}
+
+	for _, s := range sizes.Stepwise() {
+		report.StepwiseSizes = append(report.StepwiseSizes, StepwiseSizeReport{s.MinWidth, s.MaxWidth, s.StepWidth, s.MinHeight, s.MaxHeight, s.StepHeight})
+	}
+
+	return report, nil
+}
+
+//--------------------------------------------------------------------------------------
+//FRAME SIZE FROM REPORT
+//--------------------------------------------------------------------------------------
+
+// FrameSize reconstructs a frame size of the reported device, so that a mode
+// picked from a stored report can be used for taking snapshots.
+func (r DeviceReport) FrameSize(format string, width uint32, height uint32) (DiscreteFrameSize, error) {
+
+	for _, f := range r.Formats {
+		if f.Name != format {
+			continue
+		}
+
+		if !f.supports(width, height) {
+			return DiscreteFrameSize{}, fmt.Errorf("Frame size %dx%d is not supported for pixel format %s.", width, height, format)
+		}
+
+		return DiscreteFrameSize{PixelFormat: f.PixelFormat(), Width: width, Height: height}, nil
+	}
+
+	return DiscreteFrameSize{}, fmt.Errorf("Pixel format %s not found in report of %v.", format, r.Info)
+}
+
+func (f FormatReport) PixelFormat() PixelFormat {
+	format := pixelFormat{name: f.Name, desc: f.Description, value: FourCC(f.Code), bufType: f.BufferType}
+
+	if f.BufferType == 0 {
+		format.bufType = BUF_TYPE_VIDEO_CAPTURE
+	}
+
+	if f.Compressed {
+		format.flags |= C.V4L2_FMT_FLAG_COMPRESSED
+	}
+
+	if f.Emulated {
+		format.flags |= C.V4L2_FMT_FLAG_EMULATED
+	}
+
+	return format
+}
+
+func (f FormatReport) supports(width uint32, height uint32) bool {
+	for _, size := range f.Sizes {
+		if size.Width == width && size.Height == height {
+			return true
+		}
+	}
+
+	for _, s := range f.StepwiseSizes {
+		if fitsStep(width, s.MinWidth, s.MaxWidth, s.StepWidth) && fitsStep(height, s.MinHeight, s.MaxHeight, s.StepHeight) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fitsStep(value uint32, min uint32, max uint32, step uint32) bool {
+	if value < min || value > max {
+		return false
+	}
+	return step == 0 || (value-min)%step == 0
+}
+
+//--------------------------------------------------------------------------------------
+//JSON OF FRAME SIZE
+//--------------------------------------------------------------------------------------
+
+type frameSizeJSON struct {
+	Format      string     `json:"format"`
+	Description string     `json:"description,omitempty"`
+	Code        uint32     `json:"code"`
+	BufferType  BufferType `json:"buffer_type,omitempty"`
+	Width       uint32     `json:"width"`
+	Height      uint32     `json:"height"`
+}
+
+func (d DiscreteFrameSize) MarshalJSON() ([]byte, error) {
+	value := frameSizeJSON{Width: d.Width, Height: d.Height}
+
+	if d.PixelFormat != nil {
+		value.Format = d.PixelFormat.Name()
+		value.Description = d.PixelFormat.Description()
+		value.Code = uint32(d.PixelFormat.FourCC())
+		value.BufferType = d.PixelFormat.BufferType()
+	}
+
+	return json.Marshal(value)
+}
+
+func (d *DiscreteFrameSize) UnmarshalJSON(data []byte) error {
+	value := frameSizeJSON{}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	if value.Code == 0 {
+		info, ok := lookupFormatByName(value.Format)
+
+		if !ok {
+			return fmt.Errorf("Unknown pixel format %s.", value.Format)
+		}
+
+		value.Code = uint32(info.FourCC)
+	}
+
+	if value.Format == "" {
+		value.Format = formatName(FourCC(value.Code))
+	}
+
+	//frame sizes stored before the buffer type was serialized are single-planar
+	if value.BufferType == 0 {
+		value.BufferType = BUF_TYPE_VIDEO_CAPTURE
+	}
+
+	d.PixelFormat = pixelFormat{name: value.Format, desc: value.Description, value: FourCC(value.Code), bufType: value.BufferType}
+	d.Width = value.Width
+	d.Height = value.Height
+
+	return nil
+}
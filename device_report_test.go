@@ -0,0 +1,45 @@
+package webcam
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFrameSizeJSONKeepsBufferType(t *testing.T) {
+	code, err := ParseFourCC("NV12")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bufType := range []BufferType{BUF_TYPE_VIDEO_CAPTURE, BUF_TYPE_VIDEO_CAPTURE_MPLANE} {
+		size := DiscreteFrameSize{PixelFormat: pixelFormat{name: "NV12", value: code, bufType: bufType}, Width: 640, Height: 480}
+
+		data, err := json.Marshal(size)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		restored := DiscreteFrameSize{}
+
+		if err := json.Unmarshal(data, &restored); err != nil {
+			t.Fatal(err)
+		}
+
+		if restored.PixelFormat.BufferType() != bufType {
+			t.Errorf("%s restored buffer type %v, expected %v", data, restored.PixelFormat.BufferType(), bufType)
+		}
+	}
+
+	//frame sizes stored without a buffer type
+	restored := DiscreteFrameSize{}
+
+	if err := json.Unmarshal([]byte(`{"format":"NV12","width":640,"height":480}`), &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.PixelFormat.BufferType() != BUF_TYPE_VIDEO_CAPTURE {
+		t.Errorf("Restored buffer type %v, expected %v", restored.PixelFormat.BufferType(), BUF_TYPE_VIDEO_CAPTURE)
+	}
+}
@@ -0,0 +1,470 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sync"
+)
+
+const (
+	DEFAULT_EXPOSURE_TARGET         = 110
+	DEFAULT_EXPOSURE_TOLERANCE      = 0.1
+	DEFAULT_EXPOSURE_DAMPING        = 0.5
+	DEFAULT_EXPOSURE_MAX_CLIPPED    = 0.02
+	DEFAULT_EXPOSURE_EVERY          = 2
+	DEFAULT_ROI_WEIGHT              = 4
+	DEFAULT_WHITE_BALANCE_TOLERANCE = 2
+)
+
+const (
+	//luma from which highlights count as clipped
+	exposureClipLevel = 250
+	//EV the exposure is lowered by at least while too many highlights are clipped
+	exposureClippedEV = 0.25
+	//value of CID_EXPOSURE_AUTO switching automatic exposure off
+	exposureManual = C.V4L2_EXPOSURE_MANUAL
+)
+
+func (o ExposureOptions) withDefaults() ExposureOptions {
+	if o.Target <= 0 {
+		o.Target = DEFAULT_EXPOSURE_TARGET
+	}
+
+	if o.Tolerance <= 0 {
+		o.Tolerance = DEFAULT_EXPOSURE_TOLERANCE
+	}
+
+	if o.Damping <= 0 || o.Damping > 1 {
+		o.Damping = DEFAULT_EXPOSURE_DAMPING
+	}
+
+	if o.MaxClipped <= 0 {
+		o.MaxClipped = DEFAULT_EXPOSURE_MAX_CLIPPED
+	}
+
+	if o.Every <= 0 {
+		o.Every = DEFAULT_EXPOSURE_EVERY
+	}
+
+	if o.ROIWeight <= 0 {
+		o.ROIWeight = DEFAULT_ROI_WEIGHT
+	}
+
+	if o.WhiteBalanceTolerance <= 0 {
+		o.WhiteBalanceTolerance = DEFAULT_WHITE_BALANCE_TOLERANCE
+	}
+
+	return o
+}
+
+func (s ExposureState) String() string {
+	return fmt.Sprintf("ExposureState[luma=%.1f,clipped=%.3f,error=%.2f,exposure=%d,gain=%d,cb=%.1f,cr=%.1f,converged=%v]", s.Luma, s.Clipped, s.Error, s.Exposure, s.Gain, s.Cb, s.Cr, s.Converged)
+}
+
+//-------------------------------------------------------------------------------------
+//CONTROLLER
+//-------------------------------------------------------------------------------------
+
+type exposureController struct {
+	cam       Webcam
+	frameSize DiscreteFrameSize
+	options   ExposureOptions
+
+	//controls the controller adjusts, nil when the webcam lacks them or they are skipped
+	exposure    *Control
+	gain        *Control
+	red         *Control
+	blue        *Control
+	temperature *Control
+
+	mu    sync.Mutex
+	state ExposureState
+}
+
+func newExposureController(cam Webcam, frameSize DiscreteFrameSize, options ExposureOptions) (ExposureController, error) {
+
+	if options.SkipExposure && options.SkipWhiteBalance {
+		return nil, errors.New("Both exposure and white balance are skipped.")
+	}
+
+	if frameSize.PixelFormat == nil {
+		return nil, fmt.Errorf("Frame size %dx%d has no pixel format.", frameSize.Width, frameSize.Height)
+	}
+
+	if !options.SkipWhiteBalance && frameSize.PixelFormat.FourCC() == C.V4L2_PIX_FMT_GREY {
+		return nil, fmt.Errorf("Pixel format %v has no colors to balance.", frameSize.PixelFormat.FourCC())
+	}
+
+	controls, err := cam.QueryControls()
+
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[ControlID]Control{}
+
+	for _, control := range controls {
+		byID[control.ID] = control
+	}
+
+	find := func(ids ...ControlID) *Control {
+		for _, id := range ids {
+			if control, ok := byID[id]; ok {
+				return &control
+			}
+		}
+		return nil
+	}
+
+	c := &exposureController{cam: cam, frameSize: frameSize, options: options.withDefaults()}
+
+	//automatic modes of the webcam would fight the controller
+	autos := map[ControlID]int32{}
+
+	if !options.SkipExposure {
+		c.exposure = find(CID_EXPOSURE_ABSOLUTE, CID_EXPOSURE)
+		c.gain = find(CID_GAIN, CID_ANALOGUE_GAIN)
+
+		if c.exposure == nil && c.gain == nil {
+			return nil, fmt.Errorf("Device %s has neither an exposure nor a gain control.", cam.Info().Path)
+		}
+
+		autos[CID_EXPOSURE_AUTO] = exposureManual
+		autos[CID_AUTOGAIN] = 0
+	}
+
+	if !options.SkipWhiteBalance {
+		c.red = find(CID_RED_BALANCE)
+		c.blue = find(CID_BLUE_BALANCE)
+
+		if c.red == nil && c.blue == nil {
+			c.temperature = find(CID_WHITE_BALANCE_TEMPERATURE)
+		}
+
+		if c.red == nil && c.blue == nil && c.temperature == nil {
+			return nil, fmt.Errorf("Device %s has no white balance control.", cam.Info().Path)
+		}
+
+		autos[CID_AUTO_WHITE_BALANCE] = 0
+	}
+
+	for id, value := range autos {
+		if _, ok := byID[id]; !ok {
+			continue
+		}
+
+		if err := cam.SetControl(id, value); err != nil {
+			return nil, fmt.Errorf("Cannot switch %v off: %w", id, err)
+		}
+	}
+
+	for _, read := range []struct {
+		control *Control
+		value   *int32
+	}{
+		{c.exposure, &c.state.Exposure},
+		{c.gain, &c.state.Gain},
+		{c.red, &c.state.RedBalance},
+		{c.blue, &c.state.BlueBalance},
+		{c.temperature, &c.state.Temperature},
+	} {
+		if read.control == nil {
+			continue
+		}
+
+		if *read.value, err = cam.GetControl(read.control.ID); err != nil {
+			return nil, fmt.Errorf("Cannot read %v: %w", read.control.ID, err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *exposureController) State() ExposureState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+func (c *exposureController) Process(snap Snapshot) (ExposureState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.measure(snap); err != nil {
+		return c.state, err
+	}
+
+	c.state.Frames++
+
+	//the driver applies changes a frame or two late, adjusting on every frame
+	//would overshoot
+	if c.state.Frames%uint64(c.options.Every) != 0 {
+		return c.state, nil
+	}
+
+	exposed, err := c.adjustExposure()
+
+	if err != nil {
+		return c.state, err
+	}
+
+	balanced, err := c.adjustWhiteBalance()
+
+	if err != nil {
+		return c.state, err
+	}
+
+	c.state.Converged = exposed && balanced
+	return c.state, nil
+}
+
+func (c *exposureController) Run(frames <-chan Frame) error {
+
+	var first error
+
+	for frame := range frames {
+		_, err := c.Process(frame)
+		frame.Release()
+
+		if err == nil {
+			continue
+		}
+
+		logRecord(LEVEL_WARN, "Cannot regulate exposure", errorFields(err, "path", c.cam.Info().Path)...)
+
+		if first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+//-------------------------------------------------------------------------------------
+//MEASURING
+//-------------------------------------------------------------------------------------
+
+// measure updates the luma, clipping and chroma of the state from the frame.
+// Every other pixel of every other line is sampled, pixels in the ROI weigh
+// ROIWeight, the others 1.
+func (c *exposureController) measure(snap Snapshot) error {
+
+	luma, err := newLumaPlane(snap, c.frameSize)
+
+	if err != nil {
+		return err
+	}
+
+	var chroma chromaPlane
+	balancing := c.red != nil || c.blue != nil || c.temperature != nil
+
+	if balancing {
+		if chroma, err = newChromaPlane(snap, c.frameSize); err != nil {
+			return err
+		}
+	}
+
+	frame := luma.region(image.Rectangle{})
+	roi := luma.region(c.options.ROI)
+	weighted := !c.options.ROI.Empty()
+
+	var total, sum, clipped, cb, cr float64
+
+	for y := frame.Min.Y; y < frame.Max.Y; y += 2 {
+		for x := frame.Min.X; x < frame.Max.X; x += 2 {
+			weight := 1.0
+
+			if weighted && image.Pt(x, y).In(roi) {
+				weight = c.options.ROIWeight
+			}
+
+			value := luma.at(x, y)
+			total += weight
+			sum += weight * float64(value)
+
+			if value >= exposureClipLevel {
+				clipped += weight
+			}
+
+			if balancing {
+				b, r := chroma.at(x, y)
+				cb += weight * float64(b)
+				cr += weight * float64(r)
+			}
+		}
+	}
+
+	c.state.Luma = sum / total
+	c.state.Clipped = clipped / total
+
+	if balancing {
+		c.state.Cb = cb / total
+		c.state.Cr = cr / total
+	}
+
+	return nil
+}
+
+//-------------------------------------------------------------------------------------
+//EXPOSURE
+//-------------------------------------------------------------------------------------
+
+// adjustExposure moves exposure and gain toward the target luma and tells whether
+// the luma is within the tolerance. Brightening raises the exposure up to its
+// limit before the gain, darkening lowers the gain before the exposure, so that
+// noise is kept low.
+func (c *exposureController) adjustExposure() (bool, error) {
+
+	if c.exposure == nil && c.gain == nil {
+		return true, nil
+	}
+
+	ev := math.Log2(c.options.Target / math.Max(c.state.Luma, 1))
+
+	if c.state.Clipped > c.options.MaxClipped {
+		ev = math.Min(ev, -exposureClippedEV)
+	}
+
+	c.state.Error = ev
+
+	if math.Abs(ev) <= c.options.Tolerance {
+		return true, nil
+	}
+
+	factor := math.Exp2(ev * c.options.Damping)
+
+	if factor > 1 {
+		factor = c.scale(c.exposure, &c.state.Exposure, c.options.MaxExposure, factor)
+		factor = c.scale(c.gain, &c.state.Gain, c.options.MaxGain, factor)
+	} else {
+		factor = c.scale(c.gain, &c.state.Gain, c.options.MaxGain, factor)
+		factor = c.scale(c.exposure, &c.state.Exposure, c.options.MaxExposure, factor)
+	}
+
+	if err := c.set(c.exposure, c.state.Exposure); err != nil {
+		return false, err
+	}
+
+	return false, c.set(c.gain, c.state.Gain)
+}
+
+// scale multiplies the value of a control by the factor within its range and the
+// limit, if any, and returns the part of the factor left for other controls.
+// Values are taken as linear, so that doubling them doubles the brightness. A
+// value is moved by at least a step, so that small values do not stall.
+func (c *exposureController) scale(control *Control, value *int32, limit int32, factor float64) float64 {
+
+	if control == nil || factor == 1 {
+		return factor
+	}
+
+	current := math.Max(float64(*value), 1)
+	target := math.Round(current * factor)
+	step := math.Max(float64(control.Step), 1)
+
+	if factor > 1 {
+		target = math.Max(target, float64(*value)+step)
+	} else {
+		target = math.Min(target, float64(*value)-step)
+	}
+
+	wanted := target
+
+	if limit > 0 && target > float64(limit) {
+		target = float64(limit)
+	}
+
+	fitted, _, _ := fitControlValue(*control, int32(math.Max(math.Min(target, math.MaxInt32), math.MinInt32)))
+	*value = fitted
+
+	//only what the control could not take for its range or limit is left,
+	//not the rounding
+	reached := math.Abs(float64(fitted)-wanted) <= step/2
+
+	if reached {
+		return 1
+	}
+
+	return factor * current / math.Max(float64(fitted), 1)
+}
+
+//-------------------------------------------------------------------------------------
+//WHITE BALANCE
+//-------------------------------------------------------------------------------------
+
+// adjustWhiteBalance moves the balance toward a gray world, in which the mean
+// chroma is neutral, and tells whether it is within the tolerance.
+func (c *exposureController) adjustWhiteBalance() (bool, error) {
+
+	if c.red == nil && c.blue == nil && c.temperature == nil {
+		return true, nil
+	}
+
+	//positive errors mean too much blue or red
+	cbError := c.state.Cb - 128
+	crError := c.state.Cr - 128
+
+	if math.Abs(cbError) <= c.options.WhiteBalanceTolerance && math.Abs(crError) <= c.options.WhiteBalanceTolerance {
+		return true, nil
+	}
+
+	if c.temperature != nil {
+		//a lower temperature makes the image bluer
+		c.state.Temperature = c.nudge(c.temperature, c.state.Temperature, (crError-cbError)/256)
+		return false, c.set(c.temperature, c.state.Temperature)
+	}
+
+	//a channel that is balanced already is left alone, a nudge moves by a step at least
+	if c.red != nil && math.Abs(crError) > c.options.WhiteBalanceTolerance {
+		c.state.RedBalance = c.nudge(c.red, c.state.RedBalance, crError/128)
+
+		if err := c.set(c.red, c.state.RedBalance); err != nil {
+			return false, err
+		}
+	}
+
+	if c.blue != nil && math.Abs(cbError) > c.options.WhiteBalanceTolerance {
+		c.state.BlueBalance = c.nudge(c.blue, c.state.BlueBalance, cbError/128)
+
+		if err := c.set(c.blue, c.state.BlueBalance); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// nudge lowers the value of a control by the damped fraction of its range, by at
+// least a step so that small errors do not stall.
+func (c *exposureController) nudge(control *Control, value int32, fraction float64) int32 {
+
+	delta := c.options.Damping * fraction * float64(control.Maximum-control.Minimum)
+	step := math.Max(float64(control.Step), 1)
+
+	if math.Abs(delta) < step {
+		delta = math.Copysign(step, delta)
+	}
+
+	fitted, _, _ := fitControlValue(*control, int32(math.Round(float64(value)-delta)))
+	return fitted
+}
+
+// set sets the value of a control, the controls the webcam lacks are skipped.
+func (c *exposureController) set(control *Control, value int32) error {
+
+	if control == nil {
+		return nil
+	}
+
+	if err := c.cam.SetControl(control.ID, value); err != nil {
+		return fmt.Errorf("Cannot set %v: %w", control.ID, err)
+	}
+
+	return nil
+}
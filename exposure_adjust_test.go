@@ -0,0 +1,174 @@
+package webcam
+
+import (
+	"math"
+	"testing"
+)
+
+// yuyvSnapshot makes a YUYV snapshot of the test frame size, the luma of every
+// pixel given by its position, the chroma the same everywhere.
+func yuyvSnapshot(t *testing.T, luma func(x, y int) byte, cb byte, cr byte) Snapshot {
+	size := testFrameSize(t)
+	data := make([]byte, 0, 2*size.Width*size.Height)
+
+	for y := 0; y < int(size.Height); y++ {
+		for x := 0; x < int(size.Width); x += 2 {
+			data = append(data, luma(x, y), cb, luma(x+1, y), cr)
+		}
+	}
+
+	return &snapshot{data: data}
+}
+
+func uniformLuma(value byte) func(x, y int) byte {
+	return func(x, y int) byte { return value }
+}
+
+func newExposureCam(exposure int64, gain int64) *fakeControlCam {
+	return newFakeControlCam(
+		Control{ID: CID_EXPOSURE_ABSOLUTE, Name: "Exposure, Absolute", Type: CTRL_TYPE_INTEGER, Minimum: 1, Maximum: 5000, Step: 1, Default: exposure},
+		Control{ID: CID_GAIN, Name: "Gain", Type: CTRL_TYPE_INTEGER, Minimum: 0, Maximum: 255, Step: 1, Default: gain},
+		Control{ID: CID_RED_BALANCE, Name: "Red Balance", Type: CTRL_TYPE_INTEGER, Minimum: 0, Maximum: 255, Step: 1, Default: 128},
+		Control{ID: CID_BLUE_BALANCE, Name: "Blue Balance", Type: CTRL_TYPE_INTEGER, Minimum: 0, Maximum: 255, Step: 1, Default: 128},
+	)
+}
+
+func newTestExposureController(t *testing.T, cam *fakeControlCam, options ExposureOptions) ExposureController {
+	options.Every = 1
+
+	controller, err := newExposureController(cam, *testFrameSize(t), options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return controller
+}
+
+func TestAdjustExposure(t *testing.T) {
+	//a quarter of the sampled pixels is clipped, the mean is on the target
+	clipped := func(x, y int) byte {
+		if x == 0 {
+			return 255
+		}
+		return 62
+	}
+
+	for _, c := range []struct {
+		name           string
+		exposure, gain int64
+		options        ExposureOptions
+		luma           func(x, y int) byte
+		//expected values, a gain of -1 is only checked to have decreased
+		exposed, gained int32
+		converged       bool
+	}{
+		//log2(110/55) = 1 EV, damped by half
+		{"dark raises exposure", 100, 10, ExposureOptions{}, uniformLuma(55), 141, 10, false},
+		{"damping", 100, 10, ExposureOptions{Damping: 1}, uniformLuma(55), 200, 10, false},
+		{"exposure limit raises gain", 100, 10, ExposureOptions{MaxExposure: 120}, uniformLuma(55), 120, 12, false},
+		{"gain limit", 5000, 10, ExposureOptions{MaxGain: 12}, uniformLuma(55), 5000, 12, false},
+		{"bright lowers gain", 1000, 100, ExposureOptions{}, uniformLuma(220), 1000, 71, false},
+		{"bright without gain lowers exposure", 1000, 0, ExposureOptions{}, uniformLuma(220), 707, 0, false},
+		{"clipped lowers gain", 1000, 100, ExposureOptions{}, clipped, 1000, -1, false},
+		{"on target", 1000, 100, ExposureOptions{}, uniformLuma(110), 1000, 100, true},
+	} {
+		cam := newExposureCam(c.exposure, c.gain)
+		c.options.SkipWhiteBalance = true
+		controller := newTestExposureController(t, cam, c.options)
+
+		state, err := controller.Process(yuyvSnapshot(t, c.luma, 128, 128))
+
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		exposure, gain := cam.value(CID_EXPOSURE_ABSOLUTE), cam.value(CID_GAIN)
+
+		if exposure != c.exposed || (c.gained >= 0 && gain != c.gained) || (c.gained < 0 && gain >= int32(c.gain)) {
+			t.Errorf("%s: exposure %d and gain %d were set, expected %d and %d", c.name, exposure, gain, c.exposed, c.gained)
+		}
+
+		if state.Exposure != exposure || state.Gain != gain || state.Converged != c.converged {
+			t.Errorf("%s: state %v does not match the controls", c.name, state)
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	control := &Control{ID: CID_GAIN, Type: CTRL_TYPE_INTEGER, Minimum: 0, Maximum: 100, Step: 1}
+	controller := &exposureController{}
+
+	for _, c := range []struct {
+		name     string
+		control  *Control
+		value    int32
+		limit    int32
+		factor   float64
+		expected int32
+		left     float64
+	}{
+		{"within range", control, 40, 0, 2, 80, 1},
+		{"beyond range", control, 40, 0, 4, 100, 1.6},
+		{"beyond limit", control, 40, 50, 2, 50, 1.6},
+		{"lowering", control, 40, 0, 0.5, 20, 1},
+		{"small value moves a step", control, 0, 0, 1.1, 1, 1},
+		{"no control", nil, 40, 0, 2, 40, 2},
+	} {
+		value := c.value
+		left := controller.scale(c.control, &value, c.limit, c.factor)
+
+		if value != c.expected || math.Abs(left-c.left) > 1e-9 {
+			t.Errorf("%s: got %d and %.3f left, expected %d and %.3f", c.name, value, left, c.expected, c.left)
+		}
+	}
+}
+
+func TestAdjustWhiteBalance(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		cb, cr    byte
+		red, blue func(before, after int32) bool
+	}{
+		{"too blue", 160, 128, unchanged, decreased},
+		{"too red", 128, 160, decreased, unchanged},
+		{"too yellow", 96, 128, unchanged, increased},
+		{"too green", 96, 96, increased, increased},
+		{"neutral", 128, 128, unchanged, unchanged},
+	} {
+		cam := newExposureCam(100, 0)
+		controller := newTestExposureController(t, cam, ExposureOptions{SkipExposure: true})
+
+		state, err := controller.Process(yuyvSnapshot(t, uniformLuma(110), c.cb, c.cr))
+
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		red, blue := cam.value(CID_RED_BALANCE), cam.value(CID_BLUE_BALANCE)
+
+		if !c.red(128, red) || !c.blue(128, blue) {
+			t.Errorf("%s: red balance went to %d, blue to %d", c.name, red, blue)
+		}
+
+		if state.Converged != (c.cb == 128 && c.cr == 128) {
+			t.Errorf("%s: state %v", c.name, state)
+		}
+	}
+
+	//without red and blue balance the temperature is lowered for a redder image
+	cam := newFakeControlCam(Control{ID: CID_WHITE_BALANCE_TEMPERATURE, Name: "White Balance Temperature", Type: CTRL_TYPE_INTEGER, Minimum: 2800, Maximum: 6500, Step: 10, Default: 4600})
+	controller := newTestExposureController(t, cam, ExposureOptions{SkipExposure: true})
+
+	if _, err := controller.Process(yuyvSnapshot(t, uniformLuma(110), 110, 150)); err != nil {
+		t.Fatal(err)
+	}
+
+	if temperature := cam.value(CID_WHITE_BALANCE_TEMPERATURE); temperature >= 4600 {
+		t.Errorf("Temperature went to %d for a red image, expected it lowered", temperature)
+	}
+}
+
+func unchanged(before, after int32) bool { return after == before }
+func decreased(before, after int32) bool { return after < before }
+func increased(before, after int32) bool { return after > before }
@@ -0,0 +1,65 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// forwardFrames passes count frames of a stream of the device on the returned
+// channel and closes it, the stream is stopped then.
+func forwardFrames(t *testing.T, dev *device, count int) <-chan Frame {
+	frames := make(chan Frame)
+	forwarded := make(chan Frame)
+	errs := make(chan error, 1)
+	stop := make(chan bool)
+
+	go dev.StreamFrames(testFrameSize(t), StreamOptions{}, frames, errs, stop)
+
+	go func() {
+		for i := 0; i < count; i++ {
+			forwarded <- <-frames
+		}
+
+		close(forwarded)
+		close(stop)
+
+		for f := range frames {
+			f.Release()
+		}
+	}()
+
+	return forwarded
+}
+
+func TestExposureControllerRun(t *testing.T) {
+	dev, backend := testDevice(t)
+	defer dev.Close()
+
+	cam := newFakeControlCam(
+		Control{ID: CID_EXPOSURE_ABSOLUTE, Name: "Exposure, Absolute", Type: CTRL_TYPE_INTEGER, Minimum: 1, Maximum: 5000, Step: 1, Default: 100},
+		Control{ID: CID_GAIN, Name: "Gain", Type: CTRL_TYPE_INTEGER, Minimum: 0, Maximum: 255, Step: 1, Default: 0},
+	)
+	cam.failures[CID_EXPOSURE_ABSOLUTE] = syscall.EIO
+
+	controller, err := newExposureController(cam, *testFrameSize(t), ExposureOptions{SkipWhiteBalance: true, Every: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the dark frames cannot be exposed longer, regulation goes on anyway
+	if err := controller.Run(forwardFrames(t, dev, 6)); !errors.Is(err, syscall.EIO) {
+		t.Errorf("Run returned %v, expected %v", err, syscall.EIO)
+	}
+
+	if frames := controller.State().Frames; frames != 6 {
+		t.Errorf("Controller processed %d frames, expected 6", frames)
+	}
+
+	dev.Close()
+	assertReleased(t, backend)
+}
@@ -0,0 +1,186 @@
+package webcam
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const fourCCBigEndian FourCC = 1 << 31
+
+//--------------------------------------------------------------------------------------
+//FOURCC
+//--------------------------------------------------------------------------------------
+
+// String returns the four characters of the code without trailing spaces and
+// with a "-BE" suffix for big-endian formats. Unprintable characters become dots.
+func (f FourCC) String() string {
+	code := uint32(f &^ fourCCBigEndian)
+	chars := make([]byte, 4)
+
+	for i := range chars {
+		c := byte(code >> (8 * uint(i)))
+
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+
+		chars[i] = c
+	}
+
+	s := strings.TrimRight(string(chars), " ")
+
+	if f&fourCCBigEndian != 0 {
+		s += "-BE"
+	}
+
+	return s
+}
+
+// BigEndian tells whether the code has the big-endian flag set.
+func (f FourCC) BigEndian() bool {
+	return f&fourCCBigEndian != 0
+}
+
+// Info returns the metadata of the format if it is known.
+func (f FourCC) Info() (FormatInfo, bool) {
+	return lookupFormat(f)
+}
+
+func (f FourCC) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *FourCC) UnmarshalText(text []byte) error {
+	code, err := parseFourCC(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*f = code
+	return nil
+}
+
+func parseFourCC(s string) (FourCC, error) {
+
+	var flags FourCC
+
+	if strings.HasSuffix(s, "-BE") {
+		flags = fourCCBigEndian
+		s = strings.TrimSuffix(s, "-BE")
+	}
+
+	s = strings.TrimRight(s, " ")
+
+	if len(s) == 0 || len(s) > 4 {
+		return 0, fmt.Errorf("Invalid FourCC %q, expected one to four characters.", s)
+	}
+
+	var code FourCC
+
+	for i := 0; i < 4; i++ {
+		c := byte(' ')
+
+		if i < len(s) {
+			c = s[i]
+		}
+
+		if c < 0x20 || c > 0x7e {
+			return 0, fmt.Errorf("Invalid FourCC %q, unprintable character at %d.", s, i)
+		}
+
+		code |= FourCC(c) << (8 * uint(i))
+	}
+
+	return code | flags, nil
+}
+
+//--------------------------------------------------------------------------------------
+//FORMAT REGISTRY
+//--------------------------------------------------------------------------------------
+
+var registry = struct {
+	sync.RWMutex
+	formats map[FourCC]FormatInfo
+}{formats: map[FourCC]FormatInfo{}}
+
+func init() {
+	for _, info := range knownFormats {
+		registry.formats[info.FourCC] = info
+	}
+}
+
+func registerFormat(info FormatInfo) error {
+
+	if info.FourCC == 0 {
+		return fmt.Errorf("Cannot register format %s without FourCC.", info.Name)
+	}
+
+	if info.Name == "" {
+		info.Name = info.FourCC.String()
+	}
+
+	if info.Planes == 0 {
+		info.Planes = 1
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	for code, known := range registry.formats {
+		if known.Name == info.Name && code != info.FourCC {
+			return fmt.Errorf("Format name %s is already registered for %v.", info.Name, code)
+		}
+	}
+
+	registry.formats[info.FourCC] = info
+	return nil
+}
+
+func lookupFormat(code FourCC) (FormatInfo, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	info, ok := registry.formats[code]
+	return info, ok
+}
+
+// lookupFormatByName accepts either the registered name of a format, e.g.
+// "V4L2_PIX_FMT_YUYV", or its FourCC, e.g. "YUYV".
+func lookupFormatByName(name string) (FormatInfo, bool) {
+	registry.RLock()
+
+	for _, info := range registry.formats {
+		if info.Name == name {
+			registry.RUnlock()
+			return info, true
+		}
+	}
+
+	registry.RUnlock()
+
+	code, err := parseFourCC(name)
+
+	if err != nil {
+		return FormatInfo{}, false
+	}
+
+	if info, ok := lookupFormat(code); ok {
+		return info, true
+	}
+
+	return FormatInfo{FourCC: code, Name: code.String(), Planes: 1}, true
+}
+
+// formatName is the registered name of the code, or its FourCC for unknown formats.
+func formatName(code FourCC) string {
+	if info, ok := lookupFormat(code); ok {
+		return info.Name
+	}
+	return code.String()
+}
+
+func matchesFormatName(format PixelFormat, name string) bool {
+	return format.Name() == name || format.FourCC().String() == name
+}
@@ -0,0 +1,45 @@
+package webcam
+
+import (
+	"sync"
+)
+
+// frames are pooled in classes of sizes rounded to this granularity, so that
+// compressed frames varying slightly in size share a class
+const framePoolGranularity = 64 * 1024
+
+// framePool keeps the data of copied frames for reuse, separately for every
+// class of sizes, as a stream mostly copies frames of similar sizes.
+type framePool struct {
+	pools sync.Map
+}
+
+var copiedFrames = &framePool{}
+
+// get returns an empty slice with a capacity of at least size bytes.
+func (p *framePool) get(size int) []byte {
+
+	class := (size + framePoolGranularity - 1) / framePoolGranularity * framePoolGranularity
+
+	if pool, ok := p.pools.Load(class); ok {
+		if data, ok := pool.(*sync.Pool).Get().(*[]byte); ok {
+			return (*data)[:0]
+		}
+	}
+
+	return make([]byte, 0, class)
+}
+
+// put returns data to the class of sizes its capacity is sufficient for.
+func (p *framePool) put(data []byte) {
+
+	class := cap(data) / framePoolGranularity * framePoolGranularity
+
+	if class == 0 {
+		return
+	}
+
+	pool, _ := p.pools.LoadOrStore(class, &sync.Pool{})
+	data = data[:0]
+	pool.(*sync.Pool).Put(&data)
+}
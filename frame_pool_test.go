@@ -0,0 +1,96 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+import (
+	"testing"
+)
+
+// benchFrameSize is a VGA frame, large enough for allocations to matter
+func benchFrameSize(b *testing.B) *DiscreteFrameSize {
+	frameSize := testFrameSize(b)
+	frameSize.Width = 640
+	frameSize.Height = 480
+	return frameSize
+}
+
+// benchmarkCopyFrame copies frames captured by the fake backend into memory
+// returned by alloc, release gives it back.
+func benchmarkCopyFrame(b *testing.B, alloc func(size int) []byte, release func(data []byte)) {
+	dev, backend := testDevice(b)
+	defer dev.Close()
+
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+
+	if err := dev.startCapture(benchFrameSize(b), StreamOptions{Buffers: 2}); err != nil {
+		b.Fatal(err)
+	}
+
+	defer dev.stopCapture()
+
+	b.SetBytes(int64(dev.layout.sizes[0]))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buffer := dev.newCaptureBuffer(0)
+
+		if err := backend.dequeueBuffer(int(dev.file.Fd()), &buffer); err != nil {
+			b.Fatal(err)
+		}
+
+		dev.queued--
+		copied := dev.copyFrame(&buffer, alloc)
+
+		if err := dev.queueBuffer(uint32(buffer.index)); err != nil {
+			b.Fatal(err)
+		}
+
+		release(copied.data)
+	}
+}
+
+func BenchmarkCopyFramePooled(b *testing.B) {
+	benchmarkCopyFrame(b, copiedFrames.get, copiedFrames.put)
+}
+
+func BenchmarkCopyFrameUnpooled(b *testing.B) {
+	benchmarkCopyFrame(b, func(size int) []byte { return make([]byte, 0, size) }, func(data []byte) {})
+}
+
+// BenchmarkStreamFrames measures the allocations of a whole stream, released
+// frames give their memory back to the pool.
+func BenchmarkStreamFrames(b *testing.B) {
+	dev, _ := testDevice(b)
+	defer dev.Close()
+
+	frames := make(chan Frame)
+	errs := make(chan error, 1)
+	stop := make(chan bool)
+
+	go dev.StreamFrames(benchFrameSize(b), StreamOptions{Buffers: 4}, frames, errs, stop)
+
+	//the first frame warms the pool up
+	(<-frames).Release()
+
+	b.SetBytes(int64(640 * 480 * 2))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		(<-frames).Release()
+	}
+
+	b.StopTimer()
+	close(stop)
+
+	for f := range frames {
+		f.Release()
+	}
+
+	if err := <-errs; err != nil {
+		b.Fatal(err)
+	}
+}
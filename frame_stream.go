@@ -0,0 +1,314 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const DEFAULT_STREAM_BUFFERS = 4
+
+func (o StreamOptions) withDefaults() StreamOptions {
+	if o.Buffers <= 0 {
+		o.Buffers = DEFAULT_STREAM_BUFFERS
+	}
+
+	if o.MaxLeased <= 0 {
+		o.MaxLeased = o.Buffers - 1
+	}
+
+	if o.MaxLeased <= 0 {
+		o.MaxLeased = 1
+	}
+
+	if o.StatsInterval <= 0 {
+		o.StatsInterval = DEFAULT_STATS_INTERVAL
+	}
+
+	return o
+}
+
+//-----------------------------------------------------------------------------
+//FRAME INTERFACE IMPL
+//-----------------------------------------------------------------------------
+
+type frame struct {
+	snapshot
+	dmabuf   []DMABufPlane
+	release  func()
+	released int32
+}
+
+func (f *frame) Data() []byte {
+	f.checkReleased()
+	return f.snapshot.Data()
+}
+
+func (f *frame) Planes() [][]byte {
+	f.checkReleased()
+	return f.snapshot.Planes()
+}
+
+func (f *frame) Sequence() uint32 {
+	return f.meta.sequence
+}
+
+func (f *frame) DMABuf() []DMABufPlane {
+	return f.dmabuf
+}
+
+func (f *frame) Release() {
+	if atomic.CompareAndSwapInt32(&f.released, 0, 1) {
+		runtime.SetFinalizer(f, nil)
+		f.release()
+	}
+}
+
+// checkReleased panics on use of a released frame in builds tagged webcam_debug,
+// other builds do not pay for the check.
+func (f *frame) checkReleased() {
+	if debugBuild && atomic.LoadInt32(&f.released) != 0 {
+		panic("webcam: frame used after Release")
+	}
+}
+
+// finalizeFrame releases a frame the consumer forgot to release, so that its
+// buffer is not lost for the stream.
+func finalizeFrame(f *frame) {
+	if atomic.LoadInt32(&f.released) == 0 {
+		logRecord(LEVEL_WARN, "Frame was not released before being garbage collected, releasing it now", "sequence", f.meta.sequence)
+		f.Release()
+	}
+}
+
+//-----------------------------------------------------------------------------
+//STREAM FRAMES
+//-----------------------------------------------------------------------------
+
+func (d *device) StreamFrames(framesize *DiscreteFrameSize, options StreamOptions, frameChan chan Frame, errChan chan error, stop chan bool) {
+
+	defer close(frameChan)
+	defer close(errChan)
+
+	if options.Stats != nil {
+		defer close(options.Stats)
+	}
+
+	options = options.withDefaults()
+
+	err := d.runStream(framesize, options, func(stats *streamStats, closing chan struct{}) error {
+		return d.streamFrames(stats, options, frameChan, stop, closing)
+	})
+
+	if err != nil {
+		errChan <- err
+	}
+}
+
+// how long a stream waits for the consumer to release a frame when it holds
+// all the buffers
+const releaseWaitTimeout = 5 * time.Millisecond
+
+func (d *device) streamFrames(stats *streamStats, options StreamOptions, frameChan chan Frame, stop chan bool, closing chan struct{}) error {
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-closing:
+			return nil
+		default:
+		}
+
+		d.mu.Lock()
+		starving := !d.reading && d.queued == 0
+		d.mu.Unlock()
+
+		if starving {
+			select {
+			case <-stop:
+				return nil
+			case <-closing:
+				return nil
+			case <-time.After(releaseWaitTimeout):
+			}
+			continue
+		}
+
+		ready, err := d.waitForFrame(streamPollTimeout, true)
+
+		if err != nil {
+			return err
+		}
+
+		if !ready {
+			continue
+		}
+
+		d.mu.Lock()
+		f, err := d.dequeueHeldFrame(options)
+
+		if err == nil {
+			stats.received(f.meta, d.queued)
+		}
+		d.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		meta := f.meta
+
+		if options.DropLate {
+			select {
+			case frameChan <- f:
+				stats.delivered(meta)
+			default:
+				f.Release()
+				stats.dropped()
+			}
+			continue
+		}
+
+		select {
+		case frameChan <- f:
+			stats.delivered(meta)
+		case <-stop:
+			f.Release()
+			return nil
+		case <-closing:
+			f.Release()
+			return nil
+		}
+	}
+}
+
+// dequeueHeldFrame takes a filled buffer from the driver and keeps it dequeued
+// until the frame is released.
+func (d *device) dequeueHeldFrame(options StreamOptions) (*frame, error) {
+
+	if d.reading {
+		return d.readHeldFrame()
+	}
+
+	buffer := d.newCaptureBuffer(0)
+
+	err := d.backend.dequeueBuffer(int(d.file.Fd()), &buffer)
+	d.ioctlFailed("DQBUF", err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.queued--
+
+	index := uint32(buffer.index)
+	generation := d.generation
+	leasing := options.ZeroCopy || d.memory == MEMORY_USERPTR
+
+	meta := d.newFrameMeta(&buffer)
+	f := &frame{dmabuf: d.dmabufPlanes(&buffer)}
+	f.release = func() { d.requeue(index, generation) }
+
+	switch {
+	case options.SkipCopy:
+		f.snapshot = snapshot{data: []byte{}, strides: d.layout.strides}
+	case leasing && d.leased < options.MaxLeased:
+		f.snapshot = *d.viewFrame(&buffer)
+		planes := d.buffers[index].planes
+		f.release = func() { d.endLease(index, generation, planes) }
+		d.buffers[index].leased = true
+		d.leased++
+	case f.dmabuf != nil && !leasing:
+		//the consumer may read the frame from its dma-buf as well, so the
+		//buffer is held until the copy is released
+		copied := d.copyFrame(&buffer, copiedFrames.get)
+		f.snapshot = *copied
+		f.release = func() {
+			d.requeue(index, generation)
+			copiedFrames.put(copied.data)
+		}
+	default:
+		//the frame is copied and its buffer goes back to the driver right
+		//away, also when the consumer holds too many zero-copy frames
+		copied := d.copyFrame(&buffer, copiedFrames.get)
+		f.snapshot = *copied
+		f.dmabuf = nil
+		f.release = func() { copiedFrames.put(copied.data) }
+
+		if err := d.queueBuffer(index); err != nil {
+			return nil, err
+		}
+	}
+
+	f.meta = meta
+	runtime.SetFinalizer(f, finalizeFrame)
+
+	return f, nil
+}
+
+// dmabufPlanes locates the frame in exported or imported dma-bufs, nil when
+// the stream uses none.
+func (d *device) dmabufPlanes(buffer *C.struct_v4l2_buffer) []DMABufPlane {
+
+	mapped := d.buffers[buffer.index]
+
+	if mapped.planes[0].dmabuf < 0 {
+		return nil
+	}
+
+	if d.bufType != BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		return []DMABufPlane{{Fd: mapped.planes[0].dmabuf, Length: uint32(buffer.bytesused)}}
+	}
+
+	result := []DMABufPlane{}
+
+	for i, plane := range bufferPlanes(buffer) {
+		result = append(result, DMABufPlane{Fd: mapped.planes[i].dmabuf, Length: uint32(plane.bytesused), Offset: uint32(plane.data_offset)})
+	}
+
+	return result
+}
+
+// requeue hands a released buffer back to the driver, unless the stream the
+// buffer comes from has finished meanwhile.
+func (d *device) requeue(index uint32, generation uint64) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.streaming || d.generation != generation {
+		return
+	}
+
+	if err := d.queueBuffer(index); err != nil {
+		d.log(LEVEL_ERROR, "Cannot queue released buffer", errorFields(err, "index", index)...)
+		d.loadStats().failed()
+	}
+}
+
+// endLease queues the buffer of a released zero-copy frame again. When the stream
+// has finished meanwhile, the memory of the buffer has been left mapped for the
+// frame and is unmapped now.
+func (d *device) endLease(index uint32, generation uint64, planes []mappedPlane) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.streaming && d.generation == generation {
+		d.leased--
+		d.buffers[index].leased = false
+
+		if err := d.queueBuffer(index); err != nil {
+			d.log(LEVEL_ERROR, "Cannot queue released buffer", errorFields(err, "index", index)...)
+			d.loadStats().failed()
+		}
+		return
+	}
+
+	if err := unmapPlanes(planes); err != nil {
+		d.log(LEVEL_ERROR, "Cannot munmap memory of released buffer", errorFields(err, "index", index)...)
+	}
+}
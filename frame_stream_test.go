@@ -0,0 +1,122 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExportDMABuf(t *testing.T) {
+	dev, backend := testDevice(t)
+	defer dev.Close()
+
+	frames := make(chan Frame)
+	errs := make(chan error, 1)
+	stop := make(chan bool)
+
+	go dev.StreamFrames(testFrameSize(t), StreamOptions{Buffers: 2, ExportDMABuf: true}, frames, errs, stop)
+
+	fds := map[int]bool{}
+
+	for i := 0; i < 4; i++ {
+		f := <-frames
+		planes := f.DMABuf()
+
+		if len(planes) != 1 {
+			t.Fatalf("Frame %d has %d dma-buf planes, expected 1", f.Sequence(), len(planes))
+		}
+
+		plane := planes[0]
+
+		if plane.Length != 64 || plane.Offset != 0 {
+			t.Errorf("Frame %d is at %v, expected 64 bytes at offset 0", f.Sequence(), plane)
+		}
+
+		//the dma-buf holds the very frame that was copied
+		exported, err := syscall.Mmap(plane.Fd, 0, int(plane.Length), syscall.PROT_READ, syscall.MAP_SHARED)
+
+		if err != nil {
+			t.Fatalf("Cannot map dma-buf of frame %d: %v", f.Sequence(), err)
+		}
+
+		if !bytes.Equal(exported, f.Data()) {
+			t.Errorf("Dma-buf of frame %d holds %v, frame is %v", f.Sequence(), exported, f.Data())
+		}
+
+		syscall.Munmap(exported)
+
+		fds[plane.Fd] = true
+		f.Release()
+	}
+
+	close(stop)
+
+	for range frames {
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fds) != 2 {
+		t.Errorf("Frames were exported by %d dma-bufs, expected one per buffer", len(fds))
+	}
+
+	if n := backend.called("EXPBUF"); n != 2 {
+		t.Errorf("EXPBUF was issued %d times, expected once per buffer", n)
+	}
+
+	//the stream closes the exported fds when it finishes
+	for fd := range fds {
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0); errno != syscall.EBADF {
+			t.Errorf("Exported fd %d is still open", fd)
+		}
+	}
+
+	assertReleased(t, backend)
+}
+
+func TestCopiedFramesRequeueBuffers(t *testing.T) {
+	dev, backend := testDevice(t)
+	defer dev.Close()
+
+	frames := make(chan Frame)
+	errs := make(chan error, 1)
+	stop := make(chan bool)
+
+	go dev.StreamFrames(testFrameSize(t), StreamOptions{Buffers: 2}, frames, errs, stop)
+
+	//the consumer holds more copied frames than there are buffers
+	held := []Frame{}
+
+	for i := 0; i < 5; i++ {
+		select {
+		case f := <-frames:
+			held = append(held, f)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Stream stalled after %d held frames", len(held))
+		}
+	}
+
+	for i, f := range held {
+		if f.Data()[0] != byte(i) {
+			t.Errorf("Frame %d holds %d, it was overwritten", i, f.Data()[0])
+		}
+		f.Release()
+	}
+
+	close(stop)
+
+	for range frames {
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	assertReleased(t, backend)
+}
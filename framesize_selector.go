@@ -90,7 +90,7 @@ func (d discreteFrameSizeSelector) getPixelFormat() (PixelFormat, error) {
 func (d discreteFrameSizeSelector) getFormatByName(formats []PixelFormat) PixelFormat {
 
 	for _, value := range formats {
-		if value.Name() == d.pixFmtName {
+		if matchesFormatName(value, d.pixFmtName) {
 			return value
 		}
 	}
@@ -163,7 +163,7 @@ func (d discreteFrameSizeSelector) getWidth(frmSizes []DiscreteFrameSize) uint32
 	best_width := uint32(0)
 
 	for _, size := range frmSizes {
-		diff := math.Abs(float64(d.width - size.Width))
+		diff := math.Abs(float64(d.width) - float64(size.Width))
 		if diff < min_diff {
 			min_diff = diff
 			best_width = size.Width
@@ -179,14 +179,14 @@ func (d discreteFrameSizeSelector) getHeight(frmSizes []DiscreteFrameSize) uint3
 	}
 
 	min_diff := float64(100000)
-	best_width := uint32(0)
+	best_height := uint32(0)
 
 	for _, size := range frmSizes {
-		diff := math.Abs(float64(d.height - size.Height))
+		diff := math.Abs(float64(d.height) - float64(size.Height))
 		if diff < min_diff {
 			min_diff = diff
-			best_width = size.Width
+			best_height = size.Height
 		}
 	}
-	return best_width
+	return best_height
 }
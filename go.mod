@@ -1,3 +1,3 @@
 module github.com/jalasoft/go-webcam
 
-go 1.15
+go 1.16
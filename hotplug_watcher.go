@@ -0,0 +1,267 @@
+package webcam
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	//multicast group of the netlink socket the kernel sends uevents to
+	kernelUeventGroup = 1
+
+	//how long the watcher blocks in recvfrom before it checks the context
+	watchReceiveTimeoutMs = 250
+
+	ueventBufferSize = 64 * 1024
+)
+
+//---------------------------------------------------------------------------------------
+//WATCHING
+//---------------------------------------------------------------------------------------
+
+func watch(ctx context.Context, layout sysfsLayout) (<-chan DeviceEvent, error) {
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	addr := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: kernelUeventGroup}
+
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	timeout := syscall.NsecToTimeval(int64(watchReceiveTimeoutMs) * 1000 * 1000)
+
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	events := make(chan DeviceEvent)
+	go receiveUevents(ctx, fd, layout, events)
+
+	return events, nil
+}
+
+func receiveUevents(ctx context.Context, fd int, layout sysfsLayout, events chan DeviceEvent) {
+
+	defer close(events)
+	defer syscall.Close(fd)
+
+	buffer := make([]byte, ueventBufferSize)
+	identities := layout.knownIdentities()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		n, from, err := syscall.Recvfrom(fd, buffer, 0)
+
+		if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR {
+			continue
+		}
+
+		//the socket overran during a burst of uevents, e.g. a replugged USB hub;
+		//what changed meanwhile is read from sysfs instead
+		if err == syscall.ENOBUFS {
+			logRecord(LEVEL_WARN, "Uevents were lost, rescanning video devices", errorFields(err)...)
+
+			current := layout.knownIdentities()
+
+			for _, event := range diffIdentities(identities, current) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			identities = current
+			continue
+		}
+
+		if err != nil {
+			logRecord(LEVEL_ERROR, "Cannot receive uevent", errorFields(err)...)
+			return
+		}
+
+		//only messages coming from the kernel itself are trusted
+		if sender, ok := from.(*syscall.SockaddrNetlink); !ok || sender.Pid != 0 {
+			continue
+		}
+
+		event, ok := parseUevent(buffer[:n])
+
+		if !ok {
+			continue
+		}
+
+		layout.identify(&event, identities)
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+//IDENTITY
+//---------------------------------------------------------------------------------------
+
+// knownIdentities reads the identity of the video devices present when watching
+// starts, so that they can be identified once they are removed. They are kept
+// by the name of their node, e.g. video0.
+func (l sysfsLayout) knownIdentities() map[string]WebcamInfo {
+
+	result := map[string]WebcamInfo{}
+	dirs, err := filepath.Glob(filepath.Join(l.sys, "class", "video4linux", "*"))
+
+	if err != nil {
+		return result
+	}
+
+	for _, dir := range dirs {
+		info := WebcamInfo{Path: filepath.Join(l.dev, filepath.Base(dir))}
+		l.readIdentity(&info)
+		result[filepath.Base(dir)] = info
+	}
+
+	return result
+}
+
+// diffIdentities makes up the events of devices removed and added between two
+// scans, removals first, both ordered by node name. The events carry the path
+// and the identity of the devices only.
+func diffIdentities(known map[string]WebcamInfo, current map[string]WebcamInfo) []DeviceEvent {
+
+	result := []DeviceEvent{}
+
+	for _, change := range []struct {
+		eventType DeviceEventType
+		from      map[string]WebcamInfo
+		to        map[string]WebcamInfo
+	}{
+		{Removed, known, current},
+		{Added, current, known},
+	} {
+		names := []string{}
+
+		//a node replaced by another camera has been removed and added again
+		for name, info := range change.from {
+			if other, ok := change.to[name]; !ok || other != info {
+				names = append(names, name)
+			}
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			info := change.from[name]
+			result = append(result, DeviceEvent{Type: change.eventType, Path: info.Path, VendorID: info.VendorID, ProductID: info.ProductID, Serial: info.Serial})
+		}
+	}
+
+	return result
+}
+
+// identify fills in the identity of the device of an event, read from sysfs for
+// an added device and remembered from its addition for a removed one.
+func (l sysfsLayout) identify(event *DeviceEvent, identities map[string]WebcamInfo) {
+
+	var info WebcamInfo
+	name := filepath.Base(event.Path)
+
+	switch event.Type {
+	case Added:
+		info = WebcamInfo{Path: event.Path}
+		l.readIdentity(&info)
+		identities[name] = info
+	case Removed:
+		info = identities[name]
+		delete(identities, name)
+	}
+
+	event.VendorID = info.VendorID
+	event.ProductID = info.ProductID
+	event.Serial = info.Serial
+}
+
+//---------------------------------------------------------------------------------------
+//PARSING
+//---------------------------------------------------------------------------------------
+
+// parseUevent reads a kernel uevent message, e.g.
+//
+//	add@/devices/.../video4linux/video0\0ACTION=add\0SUBSYSTEM=video4linux\0DEVNAME=video0\0...
+//
+// and converts it to an event if it describes a video4linux device being added
+// or removed.
+func parseUevent(msg []byte) (DeviceEvent, bool) {
+
+	fields := bytes.Split(msg, []byte{0})
+
+	if len(fields) == 0 || !bytes.Contains(fields[0], []byte("@")) {
+		return DeviceEvent{}, false
+	}
+
+	env := map[string]string{}
+
+	for _, field := range fields[1:] {
+		pair := strings.SplitN(string(field), "=", 2)
+
+		if len(pair) == 2 {
+			env[pair[0]] = pair[1]
+		}
+	}
+
+	if env["SUBSYSTEM"] != "video4linux" || env["DEVNAME"] == "" {
+		return DeviceEvent{}, false
+	}
+
+	event := DeviceEvent{}
+
+	switch env["ACTION"] {
+	case "add":
+		event.Type = Added
+	case "remove":
+		event.Type = Removed
+	default:
+		return DeviceEvent{}, false
+	}
+
+	event.Path = devNamePath(env["DEVNAME"])
+	event.SysPath = filepath.Join("/sys", env["DEVPATH"])
+	event.Major = parseUeventNumber(env["MAJOR"])
+	event.Minor = parseUeventNumber(env["MINOR"])
+
+	return event, true
+}
+
+func devNamePath(devName string) string {
+	if filepath.IsAbs(devName) {
+		return devName
+	}
+	return filepath.Join("/dev", devName)
+}
+
+func parseUeventNumber(value string) uint32 {
+	number, err := strconv.ParseUint(value, 10, 32)
+
+	if err != nil {
+		return 0
+	}
+
+	return uint32(number)
+}
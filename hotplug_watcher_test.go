@@ -0,0 +1,151 @@
+package webcam
+
+import (
+	"strings"
+	"testing"
+)
+
+// uevent joins the fields of a kernel uevent message
+func uevent(fields ...string) []byte {
+	return []byte(strings.Join(fields, "\x00") + "\x00")
+}
+
+const ueventDevPath = "/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/video4linux/video2"
+
+func TestParseUevent(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      []byte
+		expected DeviceEvent
+		ok       bool
+	}{
+		{
+			name: "add",
+			msg: uevent("add@"+ueventDevPath, "ACTION=add", "DEVPATH="+ueventDevPath, "SUBSYSTEM=video4linux",
+				"MAJOR=81", "MINOR=2", "DEVNAME=video2", "SEQNUM=4711"),
+			expected: DeviceEvent{Type: Added, Path: "/dev/video2", SysPath: "/sys" + ueventDevPath, Major: 81, Minor: 2},
+			ok:       true,
+		},
+		{
+			name: "remove",
+			msg: uevent("remove@"+ueventDevPath, "ACTION=remove", "DEVPATH="+ueventDevPath, "SUBSYSTEM=video4linux",
+				"MAJOR=81", "MINOR=2", "DEVNAME=video2", "SEQNUM=4720"),
+			expected: DeviceEvent{Type: Removed, Path: "/dev/video2", SysPath: "/sys" + ueventDevPath, Major: 81, Minor: 2},
+			ok:       true,
+		},
+		{
+			name: "absolute devname",
+			msg: uevent("add@"+ueventDevPath, "ACTION=add", "DEVPATH="+ueventDevPath, "SUBSYSTEM=video4linux",
+				"MAJOR=81", "MINOR=2", "DEVNAME=/dev/video2"),
+			expected: DeviceEvent{Type: Added, Path: "/dev/video2", SysPath: "/sys" + ueventDevPath, Major: 81, Minor: 2},
+			ok:       true,
+		},
+		{
+			name: "usb interface",
+			msg: uevent("add@/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0", "ACTION=add",
+				"DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0", "SUBSYSTEM=usb", "DEVTYPE=usb_interface",
+				"PRODUCT=46d/85c/16", "INTERFACE=14/1/0", "SEQNUM=4705"),
+		},
+		{
+			name: "bind",
+			msg: uevent("bind@/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0", "ACTION=bind",
+				"DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0", "SUBSYSTEM=usb", "DRIVER=uvcvideo"),
+		},
+		{
+			name: "change",
+			msg: uevent("change@"+ueventDevPath, "ACTION=change", "DEVPATH="+ueventDevPath, "SUBSYSTEM=video4linux",
+				"MAJOR=81", "MINOR=2", "DEVNAME=video2"),
+		},
+		{
+			name: "no devname",
+			msg:  uevent("add@"+ueventDevPath, "ACTION=add", "DEVPATH="+ueventDevPath, "SUBSYSTEM=video4linux"),
+		},
+		{
+			name: "udev message",
+			msg:  append([]byte("libudev\x00\xfe\xed\xca\xfe"), uevent("ACTION=add", "SUBSYSTEM=video4linux", "DEVNAME=/dev/video2")...),
+		},
+		{
+			name: "empty",
+			msg:  []byte{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, ok := parseUevent(test.msg)
+
+			if ok != test.ok {
+				t.Fatalf("parseUevent returned ok=%v, expected %v", ok, test.ok)
+			}
+
+			if event != test.expected {
+				t.Errorf("parseUevent returned %+v, expected %+v", event, test.expected)
+			}
+		})
+	}
+}
+
+func TestIdentifyDeviceEvents(t *testing.T) {
+	layout := newFakeSysfs(t, fakeCamera{node: "video0", port: "1-1", vendor: 0x046d, product: 0x085c, serial: "A1"})
+	identities := layout.knownIdentities()
+
+	//video0 was present before watching started, video2 gets plugged in
+	other := newFakeSysfs(t, fakeCamera{node: "video2", port: "1-2", vendor: 0x046d, product: 0x0825, serial: "B2"})
+	layout.sys = other.sys
+
+	events := []DeviceEvent{
+		{Type: Added, Path: "/dev/video2"},
+		{Type: Removed, Path: "/dev/video2"},
+		{Type: Removed, Path: "/dev/video0"},
+		{Type: Removed, Path: "/dev/video4"},
+	}
+
+	expected := []DeviceEvent{
+		{Type: Added, Path: "/dev/video2", VendorID: 0x046d, ProductID: 0x0825, Serial: "B2"},
+		{Type: Removed, Path: "/dev/video2", VendorID: 0x046d, ProductID: 0x0825, Serial: "B2"},
+		{Type: Removed, Path: "/dev/video0", VendorID: 0x046d, ProductID: 0x085c, Serial: "A1"},
+		{Type: Removed, Path: "/dev/video4"},
+	}
+
+	for i, event := range events {
+		layout.identify(&event, identities)
+
+		if event != expected[i] {
+			t.Errorf("Event %d is %+v, expected %+v", i, event, expected[i])
+		}
+	}
+}
+
+func TestDiffIdentities(t *testing.T) {
+	a1 := WebcamInfo{Path: "/dev/video0", VendorID: 0x046d, ProductID: 0x085c, Serial: "A1"}
+	b2 := WebcamInfo{Path: "/dev/video2", VendorID: 0x046d, ProductID: 0x085c, Serial: "B2"}
+	c3 := WebcamInfo{Path: "/dev/video2", VendorID: 0x046d, ProductID: 0x0825, Serial: "C3"}
+	d4 := WebcamInfo{Path: "/dev/video4", VendorID: 0x046d, ProductID: 0x0825, Serial: "D4"}
+
+	//during the overrun video2 got replaced by another camera and video4 was
+	//plugged in, video0 stayed
+	known := map[string]WebcamInfo{"video0": a1, "video2": b2}
+	current := map[string]WebcamInfo{"video0": a1, "video2": c3, "video4": d4}
+
+	expected := []DeviceEvent{
+		{Type: Removed, Path: "/dev/video2", VendorID: 0x046d, ProductID: 0x085c, Serial: "B2"},
+		{Type: Added, Path: "/dev/video2", VendorID: 0x046d, ProductID: 0x0825, Serial: "C3"},
+		{Type: Added, Path: "/dev/video4", VendorID: 0x046d, ProductID: 0x0825, Serial: "D4"},
+	}
+
+	events := diffIdentities(known, current)
+
+	if len(events) != len(expected) {
+		t.Fatalf("Rescan made up %v, expected %v", events, expected)
+	}
+
+	for i, event := range events {
+		if event != expected[i] {
+			t.Errorf("Event %d is %+v, expected %+v", i, event, expected[i])
+		}
+	}
+
+	if events := diffIdentities(current, current); len(events) != 0 {
+		t.Errorf("Unchanged devices made up %v", events)
+	}
+}
@@ -5,7 +5,6 @@ import "C"
 import (
 	"encoding/binary"
 	"fmt"
-	"log"
 	"unsafe"
 )
 
@@ -127,9 +126,16 @@ func (c capability) String() string {
 
 func (d *device) QueryCapabilities() (Capabilities, error) {
 
-	log.Printf("Querying capabilities for file descriptor %d\n", d.file.Fd())
+	if err := d.lock(false); err != nil {
+		return capability{}, err
+	}
+
+	defer d.mu.Unlock()
+
+	d.log(LEVEL_DEBUG, "Querying capabilities")
 
 	cap, err := C.queryCapability(C.int(d.file.Fd()))
+	d.ioctlFailed("QUERYCAP", err)
 
 	defer C.free(unsafe.Pointer(cap))
 
@@ -139,14 +145,14 @@ func (d *device) QueryCapabilities() (Capabilities, error) {
 
 	result := capability{}
 
-	result.driver = readString((uintptr)(unsafe.Pointer(&cap.driver)), 16)
-	result.card = readString((uintptr) (unsafe.Pointer(&cap.card)), 32)
-	result.businfo = readString((uintptr) (unsafe.Pointer(&cap.bus_info)), 32)
+	result.driver = readString(unsafe.Pointer(&cap.driver), 16)
+	result.card = readString(unsafe.Pointer(&cap.card), 32)
+	result.businfo = readString(unsafe.Pointer(&cap.bus_info), 32)
 	result.version = binary.LittleEndian.Uint32(C.GoBytes(unsafe.Pointer(&cap.version), 4))
 	result.cap_mask = binary.LittleEndian.Uint32(C.GoBytes(unsafe.Pointer(&cap.capabilities), 4))
 	result.cap_values = convertCapabilities(result.cap_mask)
 
-	log.Printf("Capabilities for file descriptor %d successfully read.\n", d.file.Fd())
+	d.log(LEVEL_DEBUG, "Capabilities successfully read")
 
 	return result, nil
 }
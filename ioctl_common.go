@@ -2,11 +2,11 @@ package webcam
 
 import (
 	"C"
-	"unsafe"
 	"strings"
+	"unsafe"
 )
 
-func readString(ptr uintptr, len uint8) string {
-	original := string(C.GoBytes(unsafe.Pointer(ptr), C.int(len)))
+func readString(ptr unsafe.Pointer, len uint8) string {
+	original := string(C.GoBytes(ptr, C.int(len)))
 	return strings.TrimRight(original, "\u0000")
-}
\ No newline at end of file
+}
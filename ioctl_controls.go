@@ -0,0 +1,311 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	CID_BRIGHTNESS                  ControlID = C.V4L2_CID_BRIGHTNESS
+	CID_CONTRAST                    ControlID = C.V4L2_CID_CONTRAST
+	CID_SATURATION                  ControlID = C.V4L2_CID_SATURATION
+	CID_HUE                         ControlID = C.V4L2_CID_HUE
+	CID_AUTO_WHITE_BALANCE          ControlID = C.V4L2_CID_AUTO_WHITE_BALANCE
+	CID_RED_BALANCE                 ControlID = C.V4L2_CID_RED_BALANCE
+	CID_BLUE_BALANCE                ControlID = C.V4L2_CID_BLUE_BALANCE
+	CID_GAMMA                       ControlID = C.V4L2_CID_GAMMA
+	CID_EXPOSURE                    ControlID = C.V4L2_CID_EXPOSURE
+	CID_AUTOGAIN                    ControlID = C.V4L2_CID_AUTOGAIN
+	CID_GAIN                        ControlID = C.V4L2_CID_GAIN
+	CID_HFLIP                       ControlID = C.V4L2_CID_HFLIP
+	CID_VFLIP                       ControlID = C.V4L2_CID_VFLIP
+	CID_POWER_LINE_FREQUENCY        ControlID = C.V4L2_CID_POWER_LINE_FREQUENCY
+	CID_HUE_AUTO                    ControlID = C.V4L2_CID_HUE_AUTO
+	CID_WHITE_BALANCE_TEMPERATURE   ControlID = C.V4L2_CID_WHITE_BALANCE_TEMPERATURE
+	CID_SHARPNESS                   ControlID = C.V4L2_CID_SHARPNESS
+	CID_BACKLIGHT_COMPENSATION      ControlID = C.V4L2_CID_BACKLIGHT_COMPENSATION
+	CID_AUTOBRIGHTNESS              ControlID = C.V4L2_CID_AUTOBRIGHTNESS
+	CID_ROTATE                      ControlID = C.V4L2_CID_ROTATE
+	CID_EXPOSURE_AUTO               ControlID = C.V4L2_CID_EXPOSURE_AUTO
+	CID_EXPOSURE_ABSOLUTE           ControlID = C.V4L2_CID_EXPOSURE_ABSOLUTE
+	CID_EXPOSURE_AUTO_PRIORITY      ControlID = C.V4L2_CID_EXPOSURE_AUTO_PRIORITY
+	CID_PAN_RELATIVE                ControlID = C.V4L2_CID_PAN_RELATIVE
+	CID_TILT_RELATIVE               ControlID = C.V4L2_CID_TILT_RELATIVE
+	CID_PAN_RESET                   ControlID = C.V4L2_CID_PAN_RESET
+	CID_TILT_RESET                  ControlID = C.V4L2_CID_TILT_RESET
+	CID_PAN_ABSOLUTE                ControlID = C.V4L2_CID_PAN_ABSOLUTE
+	CID_TILT_ABSOLUTE               ControlID = C.V4L2_CID_TILT_ABSOLUTE
+	CID_FOCUS_ABSOLUTE              ControlID = C.V4L2_CID_FOCUS_ABSOLUTE
+	CID_FOCUS_RELATIVE              ControlID = C.V4L2_CID_FOCUS_RELATIVE
+	CID_FOCUS_AUTO                  ControlID = C.V4L2_CID_FOCUS_AUTO
+	CID_ZOOM_ABSOLUTE               ControlID = C.V4L2_CID_ZOOM_ABSOLUTE
+	CID_ZOOM_RELATIVE               ControlID = C.V4L2_CID_ZOOM_RELATIVE
+	CID_ZOOM_CONTINUOUS             ControlID = C.V4L2_CID_ZOOM_CONTINUOUS
+	CID_PRIVACY                     ControlID = C.V4L2_CID_PRIVACY
+	CID_IRIS_ABSOLUTE               ControlID = C.V4L2_CID_IRIS_ABSOLUTE
+	CID_IRIS_RELATIVE               ControlID = C.V4L2_CID_IRIS_RELATIVE
+	CID_AUTO_EXPOSURE_BIAS          ControlID = C.V4L2_CID_AUTO_EXPOSURE_BIAS
+	CID_AUTO_N_PRESET_WHITE_BALANCE ControlID = C.V4L2_CID_AUTO_N_PRESET_WHITE_BALANCE
+	CID_PAN_SPEED                   ControlID = C.V4L2_CID_PAN_SPEED
+	CID_TILT_SPEED                  ControlID = C.V4L2_CID_TILT_SPEED
+	CID_ANALOGUE_GAIN               ControlID = C.V4L2_CID_ANALOGUE_GAIN
+)
+
+var controlIDToString = map[ControlID]string{
+	CID_BRIGHTNESS:                  "V4L2_CID_BRIGHTNESS",
+	CID_CONTRAST:                    "V4L2_CID_CONTRAST",
+	CID_SATURATION:                  "V4L2_CID_SATURATION",
+	CID_HUE:                         "V4L2_CID_HUE",
+	CID_AUTO_WHITE_BALANCE:          "V4L2_CID_AUTO_WHITE_BALANCE",
+	CID_RED_BALANCE:                 "V4L2_CID_RED_BALANCE",
+	CID_BLUE_BALANCE:                "V4L2_CID_BLUE_BALANCE",
+	CID_GAMMA:                       "V4L2_CID_GAMMA",
+	CID_EXPOSURE:                    "V4L2_CID_EXPOSURE",
+	CID_AUTOGAIN:                    "V4L2_CID_AUTOGAIN",
+	CID_GAIN:                        "V4L2_CID_GAIN",
+	CID_HFLIP:                       "V4L2_CID_HFLIP",
+	CID_VFLIP:                       "V4L2_CID_VFLIP",
+	CID_POWER_LINE_FREQUENCY:        "V4L2_CID_POWER_LINE_FREQUENCY",
+	CID_HUE_AUTO:                    "V4L2_CID_HUE_AUTO",
+	CID_WHITE_BALANCE_TEMPERATURE:   "V4L2_CID_WHITE_BALANCE_TEMPERATURE",
+	CID_SHARPNESS:                   "V4L2_CID_SHARPNESS",
+	CID_BACKLIGHT_COMPENSATION:      "V4L2_CID_BACKLIGHT_COMPENSATION",
+	CID_AUTOBRIGHTNESS:              "V4L2_CID_AUTOBRIGHTNESS",
+	CID_ROTATE:                      "V4L2_CID_ROTATE",
+	CID_EXPOSURE_AUTO:               "V4L2_CID_EXPOSURE_AUTO",
+	CID_EXPOSURE_ABSOLUTE:           "V4L2_CID_EXPOSURE_ABSOLUTE",
+	CID_EXPOSURE_AUTO_PRIORITY:      "V4L2_CID_EXPOSURE_AUTO_PRIORITY",
+	CID_PAN_RELATIVE:                "V4L2_CID_PAN_RELATIVE",
+	CID_TILT_RELATIVE:               "V4L2_CID_TILT_RELATIVE",
+	CID_PAN_RESET:                   "V4L2_CID_PAN_RESET",
+	CID_TILT_RESET:                  "V4L2_CID_TILT_RESET",
+	CID_PAN_ABSOLUTE:                "V4L2_CID_PAN_ABSOLUTE",
+	CID_TILT_ABSOLUTE:               "V4L2_CID_TILT_ABSOLUTE",
+	CID_FOCUS_ABSOLUTE:              "V4L2_CID_FOCUS_ABSOLUTE",
+	CID_FOCUS_RELATIVE:              "V4L2_CID_FOCUS_RELATIVE",
+	CID_FOCUS_AUTO:                  "V4L2_CID_FOCUS_AUTO",
+	CID_ZOOM_ABSOLUTE:               "V4L2_CID_ZOOM_ABSOLUTE",
+	CID_ZOOM_RELATIVE:               "V4L2_CID_ZOOM_RELATIVE",
+	CID_ZOOM_CONTINUOUS:             "V4L2_CID_ZOOM_CONTINUOUS",
+	CID_PRIVACY:                     "V4L2_CID_PRIVACY",
+	CID_IRIS_ABSOLUTE:               "V4L2_CID_IRIS_ABSOLUTE",
+	CID_IRIS_RELATIVE:               "V4L2_CID_IRIS_RELATIVE",
+	CID_AUTO_EXPOSURE_BIAS:          "V4L2_CID_AUTO_EXPOSURE_BIAS",
+	CID_AUTO_N_PRESET_WHITE_BALANCE: "V4L2_CID_AUTO_N_PRESET_WHITE_BALANCE",
+	CID_PAN_SPEED:                   "V4L2_CID_PAN_SPEED",
+	CID_TILT_SPEED:                  "V4L2_CID_TILT_SPEED",
+	CID_ANALOGUE_GAIN:               "V4L2_CID_ANALOGUE_GAIN",
+}
+
+func (id ControlID) String() string {
+	if name, ok := controlIDToString[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("ControlID(0x%08x)", uint32(id))
+}
+
+const (
+	CTRL_TYPE_INTEGER      ControlType = C.V4L2_CTRL_TYPE_INTEGER
+	CTRL_TYPE_BOOLEAN      ControlType = C.V4L2_CTRL_TYPE_BOOLEAN
+	CTRL_TYPE_MENU         ControlType = C.V4L2_CTRL_TYPE_MENU
+	CTRL_TYPE_BUTTON       ControlType = C.V4L2_CTRL_TYPE_BUTTON
+	CTRL_TYPE_INTEGER64    ControlType = C.V4L2_CTRL_TYPE_INTEGER64
+	CTRL_TYPE_CTRL_CLASS   ControlType = C.V4L2_CTRL_TYPE_CTRL_CLASS
+	CTRL_TYPE_STRING       ControlType = C.V4L2_CTRL_TYPE_STRING
+	CTRL_TYPE_BITMASK      ControlType = C.V4L2_CTRL_TYPE_BITMASK
+	CTRL_TYPE_INTEGER_MENU ControlType = C.V4L2_CTRL_TYPE_INTEGER_MENU
+	CTRL_TYPE_U8           ControlType = C.V4L2_CTRL_TYPE_U8
+	CTRL_TYPE_U16          ControlType = C.V4L2_CTRL_TYPE_U16
+	CTRL_TYPE_U32          ControlType = C.V4L2_CTRL_TYPE_U32
+)
+
+var controlTypeToString = map[ControlType]string{
+	CTRL_TYPE_INTEGER:      "integer",
+	CTRL_TYPE_BOOLEAN:      "boolean",
+	CTRL_TYPE_MENU:         "menu",
+	CTRL_TYPE_BUTTON:       "button",
+	CTRL_TYPE_INTEGER64:    "integer64",
+	CTRL_TYPE_CTRL_CLASS:   "class",
+	CTRL_TYPE_STRING:       "string",
+	CTRL_TYPE_BITMASK:      "bitmask",
+	CTRL_TYPE_INTEGER_MENU: "integer menu",
+	CTRL_TYPE_U8:           "u8",
+	CTRL_TYPE_U16:          "u16",
+	CTRL_TYPE_U32:          "u32",
+}
+
+func (t ControlType) String() string {
+	if name, ok := controlTypeToString[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ControlType(%d)", uint32(t))
+}
+
+//-------------------------------------------------------------------------------------------------
+//CONTROL FLAGS
+//-------------------------------------------------------------------------------------------------
+
+func (c Control) Disabled() bool {
+	return c.Flags&C.V4L2_CTRL_FLAG_DISABLED != 0
+}
+
+func (c Control) ReadOnly() bool {
+	return c.Flags&C.V4L2_CTRL_FLAG_READ_ONLY != 0
+}
+
+func (c Control) WriteOnly() bool {
+	return c.Flags&C.V4L2_CTRL_FLAG_WRITE_ONLY != 0
+}
+
+func (c Control) Inactive() bool {
+	return c.Flags&C.V4L2_CTRL_FLAG_INACTIVE != 0
+}
+
+//-------------------------------------------------------------------------------------------------
+//QUERY CONTROLS
+//-------------------------------------------------------------------------------------------------
+
+func (d *device) QueryControls() ([]Control, error) {
+
+	if err := d.lock(false); err != nil {
+		return nil, err
+	}
+
+	defer d.mu.Unlock()
+
+	result := []Control{}
+	id := C.__u32(C.V4L2_CTRL_FLAG_NEXT_CTRL)
+
+	for {
+		var ctrl C.struct_v4l2_queryctrl
+
+		_, err := C.queryControl(C.int(d.file.Fd()), id, &ctrl)
+
+		if err == syscall.EINVAL {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		id = ctrl.id | C.V4L2_CTRL_FLAG_NEXT_CTRL
+
+		if ctrl._type == C.V4L2_CTRL_TYPE_CTRL_CLASS || ctrl.flags&C.V4L2_CTRL_FLAG_DISABLED != 0 {
+			continue
+		}
+
+		control, err := d.newControl(&ctrl)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, control)
+	}
+
+	return result, nil
+}
+
+func (d *device) newControl(ctrl *C.struct_v4l2_queryctrl) (Control, error) {
+
+	control := Control{}
+	control.ID = ControlID(ctrl.id)
+	control.Name = readString(unsafe.Pointer(&ctrl.name), 32)
+	control.Type = ControlType(ctrl._type)
+	control.Minimum = int64(ctrl.minimum)
+	control.Maximum = int64(ctrl.maximum)
+	control.Step = uint64(ctrl.step)
+	control.Default = int64(ctrl.default_value)
+	control.Flags = uint32(ctrl.flags)
+
+	menu, err := d.controlMenu(control)
+
+	if err != nil {
+		return Control{}, err
+	}
+
+	control.Menu = menu
+	return control, nil
+}
+
+// controlMenu queries the items of menu controls, other controls have none.
+func (d *device) controlMenu(control Control) ([]ControlMenuItem, error) {
+
+	if control.Type != CTRL_TYPE_MENU && control.Type != CTRL_TYPE_INTEGER_MENU {
+		return nil, nil
+	}
+
+	var menu []ControlMenuItem
+
+	for index := control.Minimum; index <= control.Maximum; index++ {
+		var item C.struct_v4l2_querymenu
+
+		_, err := C.queryMenu(C.int(d.file.Fd()), C.__u32(control.ID), C.__u32(index), &item)
+
+		//menus may have gaps, the missing items are reported as invalid
+		if err == syscall.EINVAL {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		menuItem := ControlMenuItem{Index: uint32(index)}
+
+		if control.Type == CTRL_TYPE_MENU {
+			menuItem.Name = readString(unsafe.Pointer(&item.anon0), 32)
+		} else {
+			menuItem.Value = int64(binary.LittleEndian.Uint64(C.GoBytes(unsafe.Pointer(&item.anon0), 8)))
+			menuItem.Name = fmt.Sprintf("%d", menuItem.Value)
+		}
+
+		menu = append(menu, menuItem)
+	}
+
+	return menu, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+//GET/SET CONTROL
+//-------------------------------------------------------------------------------------------------
+
+func (d *device) GetControl(id ControlID) (int32, error) {
+
+	if err := d.lock(false); err != nil {
+		return 0, err
+	}
+
+	defer d.mu.Unlock()
+
+	var value C.__s32
+
+	_, err := C.getControl(C.int(d.file.Fd()), C.__u32(id), &value)
+	d.ioctlFailed("G_CTRL", err)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(value), nil
+}
+
+func (d *device) SetControl(id ControlID, value int32) error {
+
+	if err := d.lock(false); err != nil {
+		return err
+	}
+
+	defer d.mu.Unlock()
+
+	_, err := C.setControl(C.int(d.file.Fd()), C.__u32(id), C.__s32(value))
+	d.ioctlFailed("S_CTRL", err)
+
+	return err
+}
@@ -0,0 +1,369 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	EVENT_EOS           EventType = C.V4L2_EVENT_EOS
+	EVENT_CTRL          EventType = C.V4L2_EVENT_CTRL
+	EVENT_FRAME_SYNC    EventType = C.V4L2_EVENT_FRAME_SYNC
+	EVENT_SOURCE_CHANGE EventType = C.V4L2_EVENT_SOURCE_CHANGE
+)
+
+var eventTypeToString = map[EventType]string{
+	EVENT_EOS:           "V4L2_EVENT_EOS",
+	EVENT_CTRL:          "V4L2_EVENT_CTRL",
+	EVENT_FRAME_SYNC:    "V4L2_EVENT_FRAME_SYNC",
+	EVENT_SOURCE_CHANGE: "V4L2_EVENT_SOURCE_CHANGE",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeToString[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventType(%d)", uint32(t))
+}
+
+const (
+	EVENT_CTRL_CH_VALUE      = C.V4L2_EVENT_CTRL_CH_VALUE
+	EVENT_CTRL_CH_FLAGS      = C.V4L2_EVENT_CTRL_CH_FLAGS
+	EVENT_CTRL_CH_RANGE      = C.V4L2_EVENT_CTRL_CH_RANGE
+	EVENT_SRC_CH_RESOLUTION  = C.V4L2_EVENT_SRC_CH_RESOLUTION
+	DEFAULT_EVENT_QUEUE_SIZE = 64
+)
+
+//-----------------------------------------------------------------------------
+//EVENT IMPLS
+//-----------------------------------------------------------------------------
+
+func (h EventHeader) Header() EventHeader {
+	return h
+}
+
+func (CtrlEvent) Type() EventType {
+	return EVENT_CTRL
+}
+
+func (e CtrlEvent) String() string {
+	return fmt.Sprintf("CtrlEvent[id=%v,changes=%d,value=%d]", e.ID, e.Changes, e.Value)
+}
+
+func (SourceChangeEvent) Type() EventType {
+	return EVENT_SOURCE_CHANGE
+}
+
+func (e SourceChangeEvent) String() string {
+	return fmt.Sprintf("SourceChangeEvent[changes=%d]", e.Changes)
+}
+
+func (EOSEvent) Type() EventType {
+	return EVENT_EOS
+}
+
+func (EOSEvent) String() string {
+	return "EOSEvent"
+}
+
+func (FrameSyncEvent) Type() EventType {
+	return EVENT_FRAME_SYNC
+}
+
+func (e FrameSyncEvent) String() string {
+	return fmt.Sprintf("FrameSyncEvent[frame_sequence=%d]", e.FrameSequence)
+}
+
+// newEvent converts a dequeued event, nil for types this module does not know.
+func newEvent(event *C.struct_v4l2_event) Event {
+
+	header := EventHeader{
+		Sequence:  uint32(event.sequence),
+		Timestamp: time.Duration(event.timestamp.tv_sec)*time.Second + time.Duration(event.timestamp.tv_nsec),
+	}
+
+	payload := unsafe.Pointer(&event.u[0])
+
+	switch EventType(event._type) {
+	case EVENT_CTRL:
+		ctrl := (*C.struct_v4l2_event_ctrl)(payload)
+		result := CtrlEvent{
+			EventHeader: header,
+			ID:          ControlID(event.id),
+			Changes:     uint32(ctrl.changes),
+			Flags:       uint32(ctrl.flags),
+			Minimum:     int32(ctrl.minimum),
+			Maximum:     int32(ctrl.maximum),
+			Step:        int32(ctrl.step),
+			Default:     int32(ctrl.default_value),
+		}
+
+		//the value is a union of a 32 and a 64 bit integer
+		if ControlType(ctrl._type) == CTRL_TYPE_INTEGER64 {
+			result.Value = *(*int64)(unsafe.Pointer(&ctrl.anon0[0]))
+		} else {
+			result.Value = int64(*(*int32)(unsafe.Pointer(&ctrl.anon0[0])))
+		}
+
+		return result
+	case EVENT_SOURCE_CHANGE:
+		change := (*C.struct_v4l2_event_src_change)(payload)
+		return SourceChangeEvent{EventHeader: header, Changes: uint32(change.changes)}
+	case EVENT_EOS:
+		return EOSEvent{EventHeader: header}
+	case EVENT_FRAME_SYNC:
+		sync := (*C.struct_v4l2_event_frame_sync)(payload)
+		return FrameSyncEvent{EventHeader: header, FrameSequence: uint32(sync.frame_sequence)}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+//SUBSCRIBING
+//-----------------------------------------------------------------------------
+
+// eventSubscriber receives the events of the types it subscribed to.
+type eventSubscriber struct {
+	types  map[EventType]bool
+	events chan Event
+}
+
+func (d *device) SubscribeEvents(types ...EventType) (<-chan Event, error) {
+
+	if len(types) == 0 {
+		return nil, errors.New("No event type to subscribe to has been given.")
+	}
+
+	if err := d.lock(false); err != nil {
+		return nil, err
+	}
+
+	defer d.mu.Unlock()
+
+	subscriber := &eventSubscriber{types: map[EventType]bool{}, events: make(chan Event, DEFAULT_EVENT_QUEUE_SIZE)}
+
+	for _, t := range types {
+		subscriber.types[t] = true
+
+		if err := d.subscribeEvent(t); err != nil {
+			return nil, combineErrors(fmt.Errorf("Cannot subscribe to %v: %w", t, err), d.rollbackSubscription(subscriber))
+		}
+	}
+
+	d.subscribers = append(d.subscribers, subscriber)
+
+	if d.stopEvents == nil {
+		d.stopEvents = make(chan struct{})
+		d.eventsDone = make(chan struct{})
+		go d.pumpEvents(d.stopEvents, d.eventsDone)
+	}
+
+	return subscriber.events, nil
+}
+
+// subscribeEvent subscribes to an event type. Control events are subscribed per
+// control, so they are subscribed for every control of the device.
+func (d *device) subscribeEvent(t EventType) error {
+	return d.eachEventSource(t, func(id C.__u32) error {
+		_, err := C.subscribeEvent(C.int(d.file.Fd()), C.__u32(t), id)
+		d.ioctlFailed("SUBSCRIBE_EVENT", err)
+		return err
+	})
+}
+
+// rollbackSubscription unsubscribes the types of a subscriber that failed to
+// subscribe, except those other subscribers receive. A control event type is
+// unsubscribed for all the controls, the driver ignores those not subscribed.
+func (d *device) rollbackSubscription(subscriber *eventSubscriber) error {
+
+	errs := []error{}
+
+	for t := range subscriber.types {
+		if d.isSubscribed(t) {
+			continue
+		}
+
+		err := d.eachEventSource(t, func(id C.__u32) error {
+			_, err := C.unsubscribeEvent(C.int(d.file.Fd()), C.__u32(t), id)
+			d.ioctlFailed("UNSUBSCRIBE_EVENT", err)
+			return err
+		})
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Cannot unsubscribe from %v: %w", t, err))
+		}
+	}
+
+	return combineErrors(errs...)
+}
+
+// isSubscribed tells whether a subscriber receives events of the type.
+func (d *device) isSubscribed(t EventType) bool {
+	for _, subscriber := range d.subscribers {
+		if subscriber.types[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// eachEventSource calls the function for every source of events of the type, that
+// is for the id of every control for control events and for the id 0 otherwise.
+func (d *device) eachEventSource(t EventType, f func(id C.__u32) error) error {
+
+	if t != EVENT_CTRL {
+		return f(0)
+	}
+
+	id := C.__u32(C.V4L2_CTRL_FLAG_NEXT_CTRL)
+
+	for {
+		var ctrl C.struct_v4l2_queryctrl
+
+		_, err := C.queryControl(C.int(d.file.Fd()), id, &ctrl)
+
+		if err == syscall.EINVAL {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		id = ctrl.id | C.V4L2_CTRL_FLAG_NEXT_CTRL
+
+		if ctrl._type == C.V4L2_CTRL_TYPE_CTRL_CLASS {
+			continue
+		}
+
+		if err := f(ctrl.id); err != nil {
+			return err
+		}
+	}
+}
+
+// unsubscribeEvents stops the event pump, unsubscribes from all events and closes
+// the channels of subscribers. It is called by Close() with the device locked.
+func (d *device) unsubscribeEvents() error {
+
+	if d.stopEvents != nil {
+		done := d.eventsDone
+		close(d.stopEvents)
+		d.stopEvents = nil
+
+		d.mu.Unlock()
+		<-done
+		d.mu.Lock()
+	}
+
+	if len(d.subscribers) == 0 {
+		return nil
+	}
+
+	_, err := C.unsubscribeEvents(C.int(d.file.Fd()))
+	d.ioctlFailed("UNSUBSCRIBE_EVENT", err)
+
+	for _, subscriber := range d.subscribers {
+		close(subscriber.events)
+	}
+
+	d.subscribers = nil
+	return err
+}
+
+//-----------------------------------------------------------------------------
+//DISPATCHING
+//-----------------------------------------------------------------------------
+
+// pumpEvents dispatches events while no stream is running, a running stream
+// dispatches them from its own poll loop.
+func (d *device) pumpEvents(stop chan struct{}, done chan struct{}) {
+
+	defer close(done)
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		d.mu.Lock()
+		streamDone := d.streamDone
+		d.mu.Unlock()
+
+		if streamDone != nil {
+			select {
+			case <-stop:
+				return
+			case <-streamDone:
+			}
+			continue
+		}
+
+		revents, err := d.poll(C.POLLPRI, streamPollTimeout)
+
+		if err == nil && revents&(C.POLLERR|C.POLLHUP|C.POLLNVAL) != 0 {
+			err = errors.New("Device reports an error.")
+		}
+
+		if err != nil {
+			d.log(LEVEL_ERROR, "Cannot wait for events", errorFields(err)...)
+			return
+		}
+
+		if revents&C.POLLPRI != 0 {
+			d.mu.Lock()
+			d.dispatchEvents()
+			d.mu.Unlock()
+		}
+	}
+}
+
+// dispatchEvents hands all pending events to their subscribers, events of a
+// subscriber that does not keep up are dropped. The device must be locked.
+func (d *device) dispatchEvents() {
+	for {
+		var event C.struct_v4l2_event
+
+		_, err := C.dequeueEvent(C.int(d.file.Fd()), &event)
+
+		if err == syscall.ENOENT {
+			return
+		}
+
+		if err != nil {
+			d.ioctlFailed("DQEVENT", err)
+			return
+		}
+
+		if e := newEvent(&event); e != nil {
+			d.deliverEvent(e)
+		}
+
+		if event.pending == 0 {
+			return
+		}
+	}
+}
+
+func (d *device) deliverEvent(e Event) {
+	for _, subscriber := range d.subscribers {
+		if !subscriber.types[e.Type()] {
+			continue
+		}
+
+		select {
+		case subscriber.events <- e:
+		default:
+			d.log(LEVEL_WARN, "Subscriber does not keep up, event dropped", "event", e.Type())
+		}
+	}
+}
@@ -0,0 +1,86 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewEvent(t *testing.T) {
+	header := EventHeader{Sequence: 7, Timestamp: 12*time.Second + 345*time.Nanosecond}
+
+	tests := []struct {
+		name     string
+		event    Event
+		ctrlType ControlType
+	}{
+		{
+			name: "ctrl",
+			event: CtrlEvent{EventHeader: header, ID: CID_BRIGHTNESS, Changes: EVENT_CTRL_CH_VALUE | EVENT_CTRL_CH_RANGE,
+				Value: -42, Flags: 0x10, Minimum: -64, Maximum: 64, Step: 2, Default: 0},
+			ctrlType: CTRL_TYPE_INTEGER,
+		},
+		{
+			name:     "ctrl of 64 bits",
+			event:    CtrlEvent{EventHeader: header, ID: CID_FOCUS_ABSOLUTE, Changes: EVENT_CTRL_CH_VALUE, Value: 1 << 40},
+			ctrlType: CTRL_TYPE_INTEGER64,
+		},
+		{
+			name:  "source change",
+			event: SourceChangeEvent{EventHeader: header, Changes: EVENT_SRC_CH_RESOLUTION},
+		},
+		{
+			name:  "frame sync",
+			event: FrameSyncEvent{EventHeader: header, FrameSequence: 99},
+		},
+		{
+			name:  "eos",
+			event: EOSEvent{EventHeader: header},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := newEvent(fakeEvent(test.event, test.ctrlType))
+
+			if event != test.event {
+				t.Errorf("Event is %+v, expected %+v", event, test.event)
+			}
+		})
+	}
+}
+
+func TestCloseRefusesUseWhileUnsubscribing(t *testing.T) {
+	dev, _ := testDevice(t)
+
+	//stands in for the event pump, which finishes only after Close unlocked
+	//the device, another goroutine gets to the device meanwhile
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	result := make(chan error, 1)
+
+	dev.stopEvents = stop
+	dev.eventsDone = done
+
+	go func() {
+		<-stop
+		err := dev.lock(false)
+
+		if err == nil {
+			dev.mu.Unlock()
+		}
+
+		result <- err
+		close(done)
+	}()
+
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-result; err != ErrDeviceClosed {
+		t.Errorf("Device being closed was locked with %v, expected %v", err, ErrDeviceClosed)
+	}
+}
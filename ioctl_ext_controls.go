@@ -0,0 +1,313 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	CTRL_CLASS_USER         ControlClass = C.V4L2_CTRL_CLASS_USER
+	CTRL_CLASS_CODEC        ControlClass = C.V4L2_CTRL_CLASS_CODEC
+	CTRL_CLASS_CAMERA       ControlClass = C.V4L2_CTRL_CLASS_CAMERA
+	CTRL_CLASS_FLASH        ControlClass = C.V4L2_CTRL_CLASS_FLASH
+	CTRL_CLASS_JPEG         ControlClass = C.V4L2_CTRL_CLASS_JPEG
+	CTRL_CLASS_IMAGE_SOURCE ControlClass = C.V4L2_CTRL_CLASS_IMAGE_SOURCE
+	CTRL_CLASS_IMAGE_PROC   ControlClass = C.V4L2_CTRL_CLASS_IMAGE_PROC
+)
+
+var controlClassToString = map[ControlClass]string{
+	CTRL_CLASS_USER:         "V4L2_CTRL_CLASS_USER",
+	CTRL_CLASS_CODEC:        "V4L2_CTRL_CLASS_CODEC",
+	CTRL_CLASS_CAMERA:       "V4L2_CTRL_CLASS_CAMERA",
+	CTRL_CLASS_FLASH:        "V4L2_CTRL_CLASS_FLASH",
+	CTRL_CLASS_JPEG:         "V4L2_CTRL_CLASS_JPEG",
+	CTRL_CLASS_IMAGE_SOURCE: "V4L2_CTRL_CLASS_IMAGE_SOURCE",
+	CTRL_CLASS_IMAGE_PROC:   "V4L2_CTRL_CLASS_IMAGE_PROC",
+}
+
+func (c ControlClass) String() string {
+	if name, ok := controlClassToString[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("ControlClass(0x%08x)", uint32(c))
+}
+
+// Class of the control, encoded in the upper bits of its ID.
+func (id ControlID) Class() ControlClass {
+	return ControlClass(id & 0x0fff0000)
+}
+
+// HasPayload tells whether the value of the control is passed in ControlValue.String
+// (string controls) or ControlValue.Payload (arrays and compound controls).
+func (c ExtControl) HasPayload() bool {
+	return c.Flags&C.V4L2_CTRL_FLAG_HAS_PAYLOAD != 0
+}
+
+func (e *ExtControlsError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("Extended controls failed before any control was processed: %v", e.Err)
+	}
+	return fmt.Sprintf("Control %v at index %d failed: %v", e.ID, e.Index, e.Err)
+}
+
+func (e *ExtControlsError) Unwrap() error {
+	return e.Err
+}
+
+//-------------------------------------------------------------------------------------------------
+//QUERY EXTENDED CONTROLS
+//-------------------------------------------------------------------------------------------------
+
+func (d *device) QueryExtControls(class ControlClass) ([]ExtControl, error) {
+
+	if err := d.lock(false); err != nil {
+		return nil, err
+	}
+
+	defer d.mu.Unlock()
+
+	result := []ExtControl{}
+	id := C.__u32(class) | C.V4L2_CTRL_FLAG_NEXT_CTRL | C.V4L2_CTRL_FLAG_NEXT_COMPOUND
+
+	for {
+		var ctrl C.struct_v4l2_query_ext_ctrl
+
+		err := d.backend.queryExtControl(int(d.file.Fd()), uint32(id), &ctrl)
+
+		if err == syscall.EINVAL {
+			break
+		}
+
+		if err != nil {
+			d.ioctlFailed("QUERY_EXT_CTRL", err)
+			return nil, err
+		}
+
+		id = ctrl.id | C.V4L2_CTRL_FLAG_NEXT_CTRL | C.V4L2_CTRL_FLAG_NEXT_COMPOUND
+
+		//controls are enumerated class by class
+		if class != 0 && ControlID(ctrl.id).Class() != class {
+			break
+		}
+
+		if ctrl._type == C.V4L2_CTRL_TYPE_CTRL_CLASS || ctrl.flags&C.V4L2_CTRL_FLAG_DISABLED != 0 {
+			continue
+		}
+
+		control := newExtControl(&ctrl)
+
+		if control.Menu, err = d.controlMenu(control.Control); err != nil {
+			return nil, err
+		}
+
+		result = append(result, control)
+	}
+
+	return result, nil
+}
+
+func newExtControl(ctrl *C.struct_v4l2_query_ext_ctrl) ExtControl {
+
+	control := ExtControl{}
+	control.ID = ControlID(ctrl.id)
+	control.Name = readString(unsafe.Pointer(&ctrl.name), 32)
+	control.Type = ControlType(ctrl._type)
+	control.Minimum = int64(ctrl.minimum)
+	control.Maximum = int64(ctrl.maximum)
+	control.Step = uint64(ctrl.step)
+	control.Default = int64(ctrl.default_value)
+	control.Flags = uint32(ctrl.flags)
+	control.Elems = uint32(ctrl.elems)
+	control.ElemSize = uint32(ctrl.elem_size)
+
+	for i := 0; i < int(ctrl.nr_of_dims); i++ {
+		control.Dims = append(control.Dims, uint32(ctrl.dims[i]))
+	}
+
+	return control
+}
+
+//-------------------------------------------------------------------------------------------------
+//GET/SET/TRY EXTENDED CONTROLS
+//-------------------------------------------------------------------------------------------------
+
+// operations of C.extControls
+const (
+	extGet = iota
+	extSet
+	extTry
+)
+
+var extOpToString = []string{"G_EXT_CTRLS", "S_EXT_CTRLS", "TRY_EXT_CTRLS"}
+
+func (d *device) GetExtControls(ids ...ControlID) ([]ControlValue, error) {
+
+	values := make([]ControlValue, len(ids))
+
+	for i, id := range ids {
+		values[i].ID = id
+	}
+
+	return d.extControls(extGet, values)
+}
+
+func (d *device) SetExtControls(values ...ControlValue) error {
+	_, err := d.extControls(extSet, values)
+	return err
+}
+
+func (d *device) TryExtControls(values ...ControlValue) ([]ControlValue, error) {
+	return d.extControls(extTry, values)
+}
+
+// extControls passes all the values in a single call, so that the driver applies
+// them atomically, and returns the values the driver left in the request.
+func (d *device) extControls(op int, values []ControlValue) ([]ControlValue, error) {
+
+	if len(values) == 0 {
+		return nil, errors.New("No control has been given.")
+	}
+
+	if err := d.lock(false); err != nil {
+		return nil, err
+	}
+
+	defer d.mu.Unlock()
+
+	request, err := d.newExtRequest(values, op != extGet)
+	defer request.free()
+
+	if err != nil {
+		return nil, err
+	}
+
+	errorIndex, err := d.backend.extControls(int(d.file.Fd()), op, uint32(len(values)), request.controls)
+
+	if err != nil {
+		d.ioctlFailed(extOpToString[op], err)
+		return nil, newExtControlsError(values, int(errorIndex), err)
+	}
+
+	return request.read(values), nil
+}
+
+func newExtControlsError(values []ControlValue, index int, err error) error {
+	//an index equal to the count means that the request failed as a whole
+	if index < 0 || index >= len(values) {
+		return &ExtControlsError{Index: -1, Err: err}
+	}
+	return &ExtControlsError{Index: index, ID: values[index].ID, Err: err}
+}
+
+// extRequest holds the controls of an extended controls call and their payloads
+// in C memory, as the driver reads and writes them.
+type extRequest struct {
+	controls *C.struct_v4l2_ext_control
+	queries  []C.struct_v4l2_query_ext_ctrl
+	payloads []unsafe.Pointer
+}
+
+// newExtRequest fills the request with the values, written tells whether their
+// values are to be passed to the driver or just their IDs.
+func (d *device) newExtRequest(values []ControlValue, written bool) (*extRequest, error) {
+
+	request := &extRequest{
+		controls: C.newExtControls(C.__u32(len(values))),
+		queries:  make([]C.struct_v4l2_query_ext_ctrl, len(values)),
+		payloads: make([]unsafe.Pointer, len(values)),
+	}
+
+	for i, value := range values {
+		query := &request.queries[i]
+
+		if err := d.backend.queryExtControl(int(d.file.Fd()), uint32(value.ID), query); err != nil {
+			d.ioctlFailed("QUERY_EXT_CTRL", err)
+			return request, &ExtControlsError{Index: i, ID: value.ID, Err: err}
+		}
+
+		if query.flags&C.V4L2_CTRL_FLAG_HAS_PAYLOAD == 0 {
+			C.setExtValue(request.controls, C.__u32(i), C.__u32(value.ID), C.__s64(value.Value), is64(query))
+			continue
+		}
+
+		size := int(query.elem_size * query.elems)
+		data := value.Payload
+
+		if ControlType(query._type) == CTRL_TYPE_STRING {
+			data = append([]byte(value.String), 0)
+		}
+
+		if written && len(data) > size {
+			return request, &ExtControlsError{Index: i, ID: value.ID, Err: fmt.Errorf("Value of %d bytes exceeds the %d bytes of the control.", len(data), size)}
+		}
+
+		payload := C.calloc(1, C.size_t(size))
+		request.payloads[i] = payload
+
+		if written {
+			copy((*[1 << 30]byte)(payload)[:size:size], data)
+
+			//strings are passed up to their terminating zero, arrays and
+			//compound values always in full, shorter ones padded by zeros
+			if ControlType(query._type) == CTRL_TYPE_STRING {
+				size = len(data)
+			}
+		}
+
+		C.setExtPayload(request.controls, C.__u32(i), C.__u32(value.ID), payload, C.__u32(size))
+	}
+
+	return request, nil
+}
+
+// read returns the values as the driver left them in the request.
+func (r *extRequest) read(values []ControlValue) []ControlValue {
+
+	result := make([]ControlValue, len(values))
+
+	for i, value := range values {
+		query := &r.queries[i]
+		result[i] = ControlValue{ID: value.ID}
+
+		if r.payloads[i] == nil {
+			result[i].Value = int64(C.extValue(r.controls, C.__u32(i), is64(query)))
+			continue
+		}
+
+		size := int(C.extSize(r.controls, C.__u32(i)))
+		data := C.GoBytes(r.payloads[i], C.int(size))
+
+		if ControlType(query._type) == CTRL_TYPE_STRING {
+			if end := bytes.IndexByte(data, 0); end >= 0 {
+				data = data[:end]
+			}
+			result[i].String = string(data)
+		} else {
+			result[i].Payload = data
+		}
+	}
+
+	return result
+}
+
+func (r *extRequest) free() {
+	for _, payload := range r.payloads {
+		if payload != nil {
+			C.free(payload)
+		}
+	}
+	C.free(unsafe.Pointer(r.controls))
+}
+
+func is64(query *C.struct_v4l2_query_ext_ctrl) C.int {
+	if ControlType(query._type) == CTRL_TYPE_INTEGER64 {
+		return 1
+	}
+	return 0
+}
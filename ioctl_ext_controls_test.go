@@ -0,0 +1,235 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// extended controls of the camera class the fake offers besides the brightness
+const (
+	fakeInteger64 ControlID = 0x009a09a0 + iota
+	fakeString
+	fakeArray
+	fakeCompound
+)
+
+func testExtControlsDevice(t *testing.T) (*device, *fakeBackend) {
+	dev, backend := testDevice(t)
+
+	backend.addExtControl(ExtControl{Control: Control{ID: CID_BRIGHTNESS, Name: "Brightness", Type: CTRL_TYPE_INTEGER, Minimum: -128, Maximum: 127, Step: 1}, ElemSize: 4})
+	backend.addExtControl(ExtControl{Control: Control{ID: fakeInteger64, Name: "Integer 64", Type: CTRL_TYPE_INTEGER64, Minimum: -1 << 50, Maximum: 1 << 50, Step: 1}, ElemSize: 8})
+	backend.addExtControl(ExtControl{Control: Control{ID: fakeString, Name: "String", Type: CTRL_TYPE_STRING, Maximum: 7, Step: 1}, ElemSize: 8})
+	backend.addExtControl(ExtControl{Control: Control{ID: fakeArray, Name: "Array", Type: CTRL_TYPE_U16, Maximum: 0xffff, Step: 1}, Elems: 4, ElemSize: 2, Dims: []uint32{2, 2}})
+	backend.addExtControl(ExtControl{Control: Control{ID: fakeCompound, Name: "Compound", Type: ControlType(0x0110)}, ElemSize: 12})
+
+	return dev, backend
+}
+
+func assertExtControlsError(t *testing.T, err error, index int, id ControlID, cause error) {
+	t.Helper()
+
+	var extErr *ExtControlsError
+
+	if !errors.As(err, &extErr) {
+		t.Fatalf("Got %v, expected an *ExtControlsError", err)
+	}
+
+	if extErr.Index != index || extErr.ID != id {
+		t.Errorf("Error is at index %d of %v, expected index %d of %v", extErr.Index, extErr.ID, index, id)
+	}
+
+	if cause != nil && !errors.Is(err, cause) {
+		t.Errorf("Error %v is not caused by %v", err, cause)
+	}
+}
+
+func TestNewExtControlsError(t *testing.T) {
+	values := []ControlValue{{ID: CID_BRIGHTNESS}, {ID: fakeInteger64}, {ID: fakeString}}
+
+	for _, c := range []struct {
+		index    int
+		expected int
+		id       ControlID
+	}{
+		{0, 0, CID_BRIGHTNESS},
+		{2, 2, fakeString},
+		//the count means that no control has been processed
+		{3, -1, 0},
+		{7, -1, 0},
+		{-1, -1, 0},
+	} {
+		assertExtControlsError(t, newExtControlsError(values, c.index, syscall.EBUSY), c.expected, c.id, syscall.EBUSY)
+	}
+}
+
+func TestQueryExtControls(t *testing.T) {
+	dev, _ := testExtControlsDevice(t)
+	defer dev.Close()
+
+	all, err := dev.QueryExtControls(0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 5 {
+		t.Fatalf("Got %d controls, expected 5", len(all))
+	}
+
+	camera, err := dev.QueryExtControls(CTRL_CLASS_CAMERA)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(camera) != 4 || camera[0].ID != fakeInteger64 {
+		t.Fatalf("Got controls %v of the camera class, expected the 4 of them", camera)
+	}
+
+	array := camera[2]
+
+	if array.Name != "Array" || array.Elems != 4 || array.ElemSize != 2 || len(array.Dims) != 2 || array.Dims[0] != 2 || array.Dims[1] != 2 {
+		t.Errorf("Array control is reported as %+v", array)
+	}
+
+	for _, control := range camera {
+		if control.HasPayload() != (control.ID != fakeInteger64) {
+			t.Errorf("Control %v has a payload: %v", control.Name, control.HasPayload())
+		}
+	}
+}
+
+func TestExtControlsValues(t *testing.T) {
+	dev, backend := testExtControlsDevice(t)
+	defer dev.Close()
+
+	//the 64-bit value does not fit in 32 bits
+	large := int64(1)<<40 + 5
+
+	if err := dev.SetExtControls(ControlValue{ID: CID_BRIGHTNESS, Value: -5}, ControlValue{ID: fakeInteger64, Value: -large}); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := backend.extControl(fakeInteger64).value; value != -large {
+		t.Errorf("Driver got %d, expected %d", value, -large)
+	}
+
+	if err := dev.SetExtControls(ControlValue{ID: fakeInteger64, Value: large}); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := dev.GetExtControls(CID_BRIGHTNESS, fakeInteger64)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values[0].Value != -5 || values[1].Value != large {
+		t.Errorf("Got %v, expected -5 and %d", values, large)
+	}
+}
+
+func TestExtControlsPayloads(t *testing.T) {
+	dev, backend := testExtControlsDevice(t)
+	defer dev.Close()
+
+	compound := bytes.Repeat([]byte{7}, 12)
+
+	err := dev.SetExtControls(
+		ControlValue{ID: fakeString, String: "abc"},
+		ControlValue{ID: fakeArray, Payload: []byte{1, 2, 3}},
+		ControlValue{ID: fakeCompound, Payload: compound},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//strings are passed up to their terminating zero, arrays and compound values
+	//in full
+	for _, c := range []struct {
+		id      ControlID
+		passed  uint32
+		payload []byte
+	}{
+		{fakeString, 4, []byte{'a', 'b', 'c', 0, 0, 0, 0, 0}},
+		{fakeArray, 8, []byte{1, 2, 3, 0, 0, 0, 0, 0}},
+		{fakeCompound, 12, compound},
+	} {
+		control := backend.extControl(c.id)
+
+		if control.passed != c.passed || !bytes.Equal(control.payload, c.payload) {
+			t.Errorf("Driver got %d bytes %v of %v, expected %d bytes %v", control.passed, control.payload, control.Name, c.passed, c.payload)
+		}
+	}
+
+	values, err := dev.GetExtControls(fakeString, fakeArray, fakeCompound)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values[0].String != "abc" || !bytes.Equal(values[1].Payload, []byte{1, 2, 3, 0, 0, 0, 0, 0}) || !bytes.Equal(values[2].Payload, compound) {
+		t.Errorf("Got %v", values)
+	}
+
+	//a try does not change the value
+	if _, err := dev.TryExtControls(ControlValue{ID: fakeString, String: "abcdef"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if control := backend.extControl(fakeString); control.passed != 7 || string(control.payload[:3]) != "abc" {
+		t.Errorf("Try passed %d bytes and left %q, expected 7 bytes and abc", control.passed, control.payload)
+	}
+
+	//the string and its terminating zero do not fit in 8 bytes
+	err = dev.SetExtControls(ControlValue{ID: CID_BRIGHTNESS}, ControlValue{ID: fakeString, String: "abcdefgh"})
+	assertExtControlsError(t, err, 1, fakeString, nil)
+
+	if backend.called("S_EXT_CTRLS") != 1 {
+		t.Errorf("Too long a string was passed to the driver")
+	}
+}
+
+func TestExtControlsErrorIndex(t *testing.T) {
+	dev, backend := testExtControlsDevice(t)
+	defer dev.Close()
+
+	unknown := ControlID(0x009a09ff)
+
+	//the control is unknown before the request is made
+	_, err := dev.GetExtControls(CID_BRIGHTNESS, unknown)
+	assertExtControlsError(t, err, 1, unknown, syscall.EINVAL)
+
+	//an invalid value fails a set as a whole, but a try at its index
+	err = dev.SetExtControls(ControlValue{ID: CID_BRIGHTNESS, Value: 1}, ControlValue{ID: fakeInteger64, Value: 1 << 60})
+	assertExtControlsError(t, err, -1, 0, syscall.ERANGE)
+
+	if value := backend.extControl(CID_BRIGHTNESS).value; value != 0 {
+		t.Errorf("Brightness was set to %d by a failed request", value)
+	}
+
+	_, err = dev.TryExtControls(ControlValue{ID: CID_BRIGHTNESS, Value: 1}, ControlValue{ID: fakeInteger64, Value: 1 << 60})
+	assertExtControlsError(t, err, 1, fakeInteger64, syscall.ERANGE)
+
+	//a control failing to be set is reported by its index
+	backend.failExtControl(fakeInteger64, syscall.EIO)
+
+	err = dev.SetExtControls(ControlValue{ID: CID_BRIGHTNESS, Value: 1}, ControlValue{ID: fakeInteger64, Value: 1})
+	assertExtControlsError(t, err, 1, fakeInteger64, syscall.EIO)
+
+	backend.failExtControl(fakeInteger64, nil)
+	backend.fail("S_EXT_CTRLS", syscall.EBUSY)
+
+	err = dev.SetExtControls(ControlValue{ID: CID_BRIGHTNESS, Value: 1})
+	assertExtControlsError(t, err, -1, 0, syscall.EBUSY)
+
+	if n := dev.Totals().IoctlErrors["S_EXT_CTRLS"]; n != 3 {
+		t.Errorf("Counted %d failed S_EXT_CTRLS, expected 3", n)
+	}
+}
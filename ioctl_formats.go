@@ -4,163 +4,190 @@ package webcam
 import "C"
 
 import (
-	"encoding/binary"
 	"fmt"
+	"syscall"
 	"unsafe"
 )
 
-var formatToString = map[uint32]string{
-
-	C.V4L2_PIX_FMT_RGB332:   "V4L2_PIX_FMT_RGB332",
-	C.V4L2_PIX_FMT_RGB444:   "V4L2_PIX_FMT_RGB444",
-	C.V4L2_PIX_FMT_ARGB444:  "V4L2_PIX_FMT_ARGB444",
-	C.V4L2_PIX_FMT_XRGB444:  "V4L2_PIX_FMT_XRGB444",
-	C.V4L2_PIX_FMT_RGB555:   "V4L2_PIX_FMT_RGB555",
-	C.V4L2_PIX_FMT_ARGB555:  "V4L2_PIX_FMT_ARGB555",
-	C.V4L2_PIX_FMT_XRGB555:  "V4L2_PIX_FMT_XRGB555",
-	C.V4L2_PIX_FMT_RGB565:   "V4L2_PIX_FMT_RGB565",
-	C.V4L2_PIX_FMT_RGB555X:  "V4L2_PIX_FMT_RGB555X",
-	C.V4L2_PIX_FMT_ARGB555X: "V4L2_PIX_FMT_ARGB555X",
-	C.V4L2_PIX_FMT_XRGB555X: "V4L2_PIX_FMT_XRGB555X",
-	C.V4L2_PIX_FMT_RGB565X:  "V4L2_PIX_FMT_RGB565X",
-	C.V4L2_PIX_FMT_BGR666:   "V4L2_PIX_FMT_BGR666",
-	C.V4L2_PIX_FMT_BGR24:    "V4L2_PIX_FMT_BGR24",
-	C.V4L2_PIX_FMT_RGB24:    "V4L2_PIX_FMT_RGB24",
-	C.V4L2_PIX_FMT_BGR32:    "V4L2_PIX_FMT_BGR32",
-	C.V4L2_PIX_FMT_ABGR32:   "V4L2_PIX_FMT_ABGR32",
-	C.V4L2_PIX_FMT_XBGR32:   "V4L2_PIX_FMT_XBGR32",
-	C.V4L2_PIX_FMT_RGB32:    "V4L2_PIX_FMT_RGB32",
-	C.V4L2_PIX_FMT_ARGB32:   "V4L2_PIX_FMT_ARGB32",
-	C.V4L2_PIX_FMT_XRGB32:   "V4L2_PIX_FMT_XRGB32",
-	C.V4L2_PIX_FMT_GREY:     "V4L2_PIX_FMT_GREY",
-	C.V4L2_PIX_FMT_Y4:       "V4L2_PIX_FMT_Y4",
-	C.V4L2_PIX_FMT_Y6:       "V4L2_PIX_FMT_Y6",
-	C.V4L2_PIX_FMT_Y10:      "V4L2_PIX_FMT_Y10",
-	C.V4L2_PIX_FMT_Y12:      "V4L2_PIX_FMT_Y12",
-	C.V4L2_PIX_FMT_Y16:      "V4L2_PIX_FMT_Y16",
-	C.V4L2_PIX_FMT_Y16_BE:   "V4L2_PIX_FMT_Y16_BE",
-
-	C.V4L2_PIX_FMT_Y10BPACK: "V4L2_PIX_FMT_Y10BPACK",
-
-	C.V4L2_PIX_FMT_PAL8: "V4L2_PIX_FMT_PAL8",
-
-	C.V4L2_PIX_FMT_UV8: "V4L2_PIX_FMT_UV8",
-
-	C.V4L2_PIX_FMT_YUYV:   "V4L2_PIX_FMT_YUYV",
-	C.V4L2_PIX_FMT_YYUV:   "V4L2_PIX_FMT_YYUV",
-	C.V4L2_PIX_FMT_YVYU:   "V4L2_PIX_FMT_YVYU",
-	C.V4L2_PIX_FMT_UYVY:   "V4L2_PIX_FMT_UYVY",
-	C.V4L2_PIX_FMT_VYUY:   "V4L2_PIX_FMT_VYUY",
-	C.V4L2_PIX_FMT_Y41P:   "V4L2_PIX_FMT_Y41P",
-	C.V4L2_PIX_FMT_YUV444: "V4L2_PIX_FMT_YUV444",
-	C.V4L2_PIX_FMT_YUV555: "V4L2_PIX_FMT_YUV555",
-	C.V4L2_PIX_FMT_YUV565: "V4L2_PIX_FMT_YUV565",
-	C.V4L2_PIX_FMT_YUV32:  "V4L2_PIX_FMT_YUV32",
-	C.V4L2_PIX_FMT_HI240:  "V4L2_PIX_FMT_HI240",
-	C.V4L2_PIX_FMT_HM12:   "V4L2_PIX_FMT_HM12",
-	C.V4L2_PIX_FMT_M420:   "V4L2_PIX_FMT_M420",
-
-	C.V4L2_PIX_FMT_NV12: "V4L2_PIX_FMT_NV12",
-	C.V4L2_PIX_FMT_NV21: "V4L2_PIX_FMT_NV21",
-	C.V4L2_PIX_FMT_NV16: "V4L2_PIX_FMT_NV16",
-	C.V4L2_PIX_FMT_NV61: "V4L2_PIX_FMT_NV61",
-	C.V4L2_PIX_FMT_NV24: "V4L2_PIX_FMT_NV24",
-	C.V4L2_PIX_FMT_NV42: "V4L2_PIX_FMT_NV42",
-
-	C.V4L2_PIX_FMT_NV12M:        "V4L2_PIX_FMT_NV12M",
-	C.V4L2_PIX_FMT_NV21M:        "V4L2_PIX_FMT_NV21M",
-	C.V4L2_PIX_FMT_NV16M:        "V4L2_PIX_FMT_NV16M",
-	C.V4L2_PIX_FMT_NV61M:        "V4L2_PIX_FMT_NV61M",
-	C.V4L2_PIX_FMT_NV12MT:       "V4L2_PIX_FMT_NV12MT",
-	C.V4L2_PIX_FMT_NV12MT_16X16: "V4L2_PIX_FMT_NV12MT_16X16",
-
-	C.V4L2_PIX_FMT_YUV410:  "V4L2_PIX_FMT_YUV410",
-	C.V4L2_PIX_FMT_YVU410:  "V4L2_PIX_FMT_YVU410",
-	C.V4L2_PIX_FMT_YUV411P: "V4L2_PIX_FMT_YUV411P",
-	C.V4L2_PIX_FMT_YUV420:  "V4L2_PIX_FMT_YUV420",
-	C.V4L2_PIX_FMT_YVU420:  "V4L2_PIX_FMT_YVU420",
-	C.V4L2_PIX_FMT_YUV422P: "V4L2_PIX_FMT_YUV422P",
-
-	C.V4L2_PIX_FMT_YUV420M: "V4L2_PIX_FMT_YUV420M",
-	C.V4L2_PIX_FMT_YVU420M: "V4L2_PIX_FMT_YVU420M",
-	C.V4L2_PIX_FMT_YUV422M: "V4L2_PIX_FMT_YUV422M",
-	C.V4L2_PIX_FMT_YVU422M: "V4L2_PIX_FMT_YVU422M",
-	C.V4L2_PIX_FMT_YUV444M: "V4L2_PIX_FMT_YUV444M",
-	C.V4L2_PIX_FMT_YVU444M: "V4L2_PIX_FMT_YVU444M",
-
-	C.V4L2_PIX_FMT_SBGGR8:   "V4L2_PIX_FMT_SBGGR8",
-	C.V4L2_PIX_FMT_SGBRG8:   "V4L2_PIX_FMT_SGBRG8",
-	C.V4L2_PIX_FMT_SGRBG8:   "V4L2_PIX_FMT_SGRBG8",
-	C.V4L2_PIX_FMT_SRGGB8:   "V4L2_PIX_FMT_SRGGB8",
-	C.V4L2_PIX_FMT_SBGGR10:  "V4L2_PIX_FMT_SBGGR10",
-	C.V4L2_PIX_FMT_SGBRG10:  "V4L2_PIX_FMT_SGBRG10",
-	C.V4L2_PIX_FMT_SGRBG10:  "V4L2_PIX_FMT_SGRBG10",
-	C.V4L2_PIX_FMT_SRGGB10:  "V4L2_PIX_FMT_SRGGB10",
-	C.V4L2_PIX_FMT_SBGGR10P: "V4L2_PIX_FMT_SBGGR10P",
-	C.V4L2_PIX_FMT_SGBRG10P: "V4L2_PIX_FMT_SGBRG10P",
-	C.V4L2_PIX_FMT_SGRBG10P: "V4L2_PIX_FMT_SGRBG10P",
-	C.V4L2_PIX_FMT_SRGGB10P: "V4L2_PIX_FMT_SRGGB10P",
-
-	C.V4L2_PIX_FMT_SBGGR10ALAW8: "V4L2_PIX_FMT_SBGGR10ALAW8",
-	C.V4L2_PIX_FMT_SGBRG10ALAW8: "V4L2_PIX_FMT_SGBRG10ALAW8",
-	C.V4L2_PIX_FMT_SGRBG10ALAW8: "V4L2_PIX_FMT_SGRBG10ALAW8",
-	C.V4L2_PIX_FMT_SRGGB10ALAW8: "V4L2_PIX_FMT_SRGGB10ALAW8",
-
-	C.V4L2_PIX_FMT_SBGGR10DPCM8: "V4L2_PIX_FMT_SBGGR10DPCM8",
-	C.V4L2_PIX_FMT_SGBRG10DPCM8: "V4L2_PIX_FMT_SGBRG10DPCM8",
-	C.V4L2_PIX_FMT_SGRBG10DPCM8: "V4L2_PIX_FMT_SGRBG10DPCM8",
-	C.V4L2_PIX_FMT_SRGGB10DPCM8: "V4L2_PIX_FMT_SRGGB10DPCM8",
-	C.V4L2_PIX_FMT_SBGGR12:      "V4L2_PIX_FMT_SBGGR12",
-	C.V4L2_PIX_FMT_SGBRG12:      "V4L2_PIX_FMT_SGBRG12",
-	C.V4L2_PIX_FMT_SGRBG12:      "V4L2_PIX_FMT_SGRBG12",
-	C.V4L2_PIX_FMT_SRGGB12:      "V4L2_PIX_FMT_SRGGB12",
-	C.V4L2_PIX_FMT_SBGGR16:      "V4L2_PIX_FMT_SBGGR16",
-
-	C.V4L2_PIX_FMT_MJPEG:       "V4L2_PIX_FMT_MJPEG",
-	C.V4L2_PIX_FMT_JPEG:        "V4L2_PIX_FMT_JPEG",
-	C.V4L2_PIX_FMT_DV:          "V4L2_PIX_FMT_DV",
-	C.V4L2_PIX_FMT_MPEG:        "V4L2_PIX_FMT_MPEG",
-	C.V4L2_PIX_FMT_H264:        "V4L2_PIX_FMT_H264",
-	C.V4L2_PIX_FMT_H264_NO_SC:  "V4L2_PIX_FMT_H264_NO_SC",
-	C.V4L2_PIX_FMT_H264_MVC:    "V4L2_PIX_FMT_H264_MVC",
-	C.V4L2_PIX_FMT_H263:        "V4L2_PIX_FMT_H263",
-	C.V4L2_PIX_FMT_MPEG1:       "V4L2_PIX_FMT_MPEG1",
-	C.V4L2_PIX_FMT_MPEG2:       "V4L2_PIX_FMT_MPEG2",
-	C.V4L2_PIX_FMT_MPEG4:       "V4L2_PIX_FMT_MPEG4",
-	C.V4L2_PIX_FMT_XVID:        "V4L2_PIX_FMT_XVID",
-	C.V4L2_PIX_FMT_VC1_ANNEX_G: "V4L2_PIX_FMT_VC1_ANNEX_G",
-	C.V4L2_PIX_FMT_VC1_ANNEX_L: "V4L2_PIX_FMT_VC1_ANNEX_L",
-	C.V4L2_PIX_FMT_VP8:         "V4L2_PIX_FMT_VP8",
-
-	C.V4L2_PIX_FMT_CPIA1:        "V4L2_PIX_FMT_CPIA1",
-	C.V4L2_PIX_FMT_WNVA:         "V4L2_PIX_FMT_WNVA",
-	C.V4L2_PIX_FMT_SN9C10X:      "V4L2_PIX_FMT_SN9C10X",
-	C.V4L2_PIX_FMT_SN9C20X_I420: "V4L2_PIX_FMT_SN9C20X_I420",
-	C.V4L2_PIX_FMT_PWC1:         "V4L2_PIX_FMT_PWC1",
-	C.V4L2_PIX_FMT_PWC2:         "V4L2_PIX_FMT_PWC2",
-	C.V4L2_PIX_FMT_ET61X251:     "V4L2_PIX_FMT_ET61X251",
-	C.V4L2_PIX_FMT_SPCA501:      "V4L2_PIX_FMT_SPCA501",
-	C.V4L2_PIX_FMT_SPCA505:      "V4L2_PIX_FMT_SPCA505",
-	C.V4L2_PIX_FMT_SPCA508:      "V4L2_PIX_FMT_SPCA508",
-	C.V4L2_PIX_FMT_SPCA561:      "V4L2_PIX_FMT_SPCA561",
-	C.V4L2_PIX_FMT_PAC207:       "V4L2_PIX_FMT_PAC207",
-	C.V4L2_PIX_FMT_MR97310A:     "V4L2_PIX_FMT_MR97310A",
-	C.V4L2_PIX_FMT_JL2005BCD:    "V4L2_PIX_FMT_JL2005BCD",
-	C.V4L2_PIX_FMT_SN9C2028:     "V4L2_PIX_FMT_SN9C2028",
-	C.V4L2_PIX_FMT_SQ905C:       "V4L2_PIX_FMT_SQ905C",
-	C.V4L2_PIX_FMT_PJPG:         "V4L2_PIX_FMT_PJPG",
-	C.V4L2_PIX_FMT_OV511:        "V4L2_PIX_FMT_OV511",
-	C.V4L2_PIX_FMT_OV518:        "V4L2_PIX_FMT_OV518",
-	C.V4L2_PIX_FMT_STV0680:      "V4L2_PIX_FMT_STV0680",
-	C.V4L2_PIX_FMT_TM6000:       "V4L2_PIX_FMT_TM6000",
-	C.V4L2_PIX_FMT_CIT_YYVYUY:   "V4L2_PIX_FMT_CIT_YYVYUY",
-	C.V4L2_PIX_FMT_KONICA420:    "V4L2_PIX_FMT_KONICA420",
-	C.V4L2_PIX_FMT_JPGL:         "V4L2_PIX_FMT_JPGL",
-	C.V4L2_PIX_FMT_SE401:        "V4L2_PIX_FMT_SE401",
-	C.V4L2_PIX_FMT_S5C_UYVY_JPG: "V4L2_PIX_FMT_S5C_UYVY_JPG",
-	C.V4L2_PIX_FMT_Y8I:          "V4L2_PIX_FMT_Y8I",
-	C.V4L2_PIX_FMT_Y12I:         "V4L2_PIX_FMT_Y12I",
-	C.V4L2_PIX_FMT_Z16:          "V4L2_PIX_FMT_Z16",
+const (
+	BUF_TYPE_VIDEO_CAPTURE        BufferType = C.V4L2_BUF_TYPE_VIDEO_CAPTURE
+	BUF_TYPE_VIDEO_CAPTURE_MPLANE BufferType = C.V4L2_BUF_TYPE_VIDEO_CAPTURE_MPLANE
+	BUF_TYPE_VIDEO_OUTPUT         BufferType = C.V4L2_BUF_TYPE_VIDEO_OUTPUT
+	BUF_TYPE_VIDEO_OUTPUT_MPLANE  BufferType = C.V4L2_BUF_TYPE_VIDEO_OUTPUT_MPLANE
+	BUF_TYPE_VIDEO_OVERLAY        BufferType = C.V4L2_BUF_TYPE_VIDEO_OVERLAY
+	BUF_TYPE_META_CAPTURE         BufferType = C.V4L2_BUF_TYPE_META_CAPTURE
+	BUF_TYPE_META_OUTPUT          BufferType = C.V4L2_BUF_TYPE_META_OUTPUT
+)
+
+var bufferTypeToString = map[BufferType]string{
+	BUF_TYPE_VIDEO_CAPTURE:        "V4L2_BUF_TYPE_VIDEO_CAPTURE",
+	BUF_TYPE_VIDEO_CAPTURE_MPLANE: "V4L2_BUF_TYPE_VIDEO_CAPTURE_MPLANE",
+	BUF_TYPE_VIDEO_OUTPUT:         "V4L2_BUF_TYPE_VIDEO_OUTPUT",
+	BUF_TYPE_VIDEO_OUTPUT_MPLANE:  "V4L2_BUF_TYPE_VIDEO_OUTPUT_MPLANE",
+	BUF_TYPE_VIDEO_OVERLAY:        "V4L2_BUF_TYPE_VIDEO_OVERLAY",
+	BUF_TYPE_META_CAPTURE:         "V4L2_BUF_TYPE_META_CAPTURE",
+	BUF_TYPE_META_OUTPUT:          "V4L2_BUF_TYPE_META_OUTPUT",
+}
+
+func (t BufferType) String() string {
+	if name, ok := bufferTypeToString[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("BufferType(%d)", uint32(t))
+}
+
+// knownFormats are registered on init, more may be added with RegisterFormat.
+var knownFormats = []FormatInfo{
+	{FourCC: C.V4L2_PIX_FMT_RGB332, Name: "V4L2_PIX_FMT_RGB332", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_RGB444, Name: "V4L2_PIX_FMT_RGB444", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_ARGB444, Name: "V4L2_PIX_FMT_ARGB444", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_XRGB444, Name: "V4L2_PIX_FMT_XRGB444", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_RGB555, Name: "V4L2_PIX_FMT_RGB555", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_ARGB555, Name: "V4L2_PIX_FMT_ARGB555", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_XRGB555, Name: "V4L2_PIX_FMT_XRGB555", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_RGB565, Name: "V4L2_PIX_FMT_RGB565", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_RGB555X, Name: "V4L2_PIX_FMT_RGB555X", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_ARGB555X, Name: "V4L2_PIX_FMT_ARGB555X", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_XRGB555X, Name: "V4L2_PIX_FMT_XRGB555X", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_RGB565X, Name: "V4L2_PIX_FMT_RGB565X", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_BGR666, Name: "V4L2_PIX_FMT_BGR666", BitsPerPixel: 32, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_BGR24, Name: "V4L2_PIX_FMT_BGR24", BitsPerPixel: 24, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_RGB24, Name: "V4L2_PIX_FMT_RGB24", BitsPerPixel: 24, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_BGR32, Name: "V4L2_PIX_FMT_BGR32", BitsPerPixel: 32, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_ABGR32, Name: "V4L2_PIX_FMT_ABGR32", BitsPerPixel: 32, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_XBGR32, Name: "V4L2_PIX_FMT_XBGR32", BitsPerPixel: 32, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_RGB32, Name: "V4L2_PIX_FMT_RGB32", BitsPerPixel: 32, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_ARGB32, Name: "V4L2_PIX_FMT_ARGB32", BitsPerPixel: 32, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_XRGB32, Name: "V4L2_PIX_FMT_XRGB32", BitsPerPixel: 32, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_GREY, Name: "V4L2_PIX_FMT_GREY", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Y4, Name: "V4L2_PIX_FMT_Y4", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Y6, Name: "V4L2_PIX_FMT_Y6", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Y10, Name: "V4L2_PIX_FMT_Y10", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Y12, Name: "V4L2_PIX_FMT_Y12", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Y16, Name: "V4L2_PIX_FMT_Y16", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Y16_BE, Name: "V4L2_PIX_FMT_Y16_BE", BitsPerPixel: 16, Planes: 1},
+
+	{FourCC: C.V4L2_PIX_FMT_Y10BPACK, Name: "V4L2_PIX_FMT_Y10BPACK", BitsPerPixel: 10, Planes: 1},
+
+	{FourCC: C.V4L2_PIX_FMT_PAL8, Name: "V4L2_PIX_FMT_PAL8", BitsPerPixel: 8, Planes: 1},
+
+	{FourCC: C.V4L2_PIX_FMT_UV8, Name: "V4L2_PIX_FMT_UV8", BitsPerPixel: 8, Planes: 1},
+
+	{FourCC: C.V4L2_PIX_FMT_YUYV, Name: "V4L2_PIX_FMT_YUYV", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_YYUV, Name: "V4L2_PIX_FMT_YYUV", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_YVYU, Name: "V4L2_PIX_FMT_YVYU", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_UYVY, Name: "V4L2_PIX_FMT_UYVY", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_VYUY, Name: "V4L2_PIX_FMT_VYUY", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_Y41P, Name: "V4L2_PIX_FMT_Y41P", BitsPerPixel: 12, Planes: 1, Subsampling: "4:1:1"},
+	{FourCC: C.V4L2_PIX_FMT_YUV444, Name: "V4L2_PIX_FMT_YUV444", BitsPerPixel: 16, Planes: 1, Subsampling: "4:4:4"},
+	{FourCC: C.V4L2_PIX_FMT_YUV555, Name: "V4L2_PIX_FMT_YUV555", BitsPerPixel: 16, Planes: 1, Subsampling: "4:4:4"},
+	{FourCC: C.V4L2_PIX_FMT_YUV565, Name: "V4L2_PIX_FMT_YUV565", BitsPerPixel: 16, Planes: 1, Subsampling: "4:4:4"},
+	{FourCC: C.V4L2_PIX_FMT_YUV32, Name: "V4L2_PIX_FMT_YUV32", BitsPerPixel: 32, Planes: 1, Subsampling: "4:4:4"},
+	{FourCC: C.V4L2_PIX_FMT_HI240, Name: "V4L2_PIX_FMT_HI240", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_HM12, Name: "V4L2_PIX_FMT_HM12", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_M420, Name: "V4L2_PIX_FMT_M420", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+
+	{FourCC: C.V4L2_PIX_FMT_NV12, Name: "V4L2_PIX_FMT_NV12", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_NV21, Name: "V4L2_PIX_FMT_NV21", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_NV16, Name: "V4L2_PIX_FMT_NV16", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_NV61, Name: "V4L2_PIX_FMT_NV61", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_NV24, Name: "V4L2_PIX_FMT_NV24", BitsPerPixel: 24, Planes: 1, Subsampling: "4:4:4"},
+	{FourCC: C.V4L2_PIX_FMT_NV42, Name: "V4L2_PIX_FMT_NV42", BitsPerPixel: 24, Planes: 1, Subsampling: "4:4:4"},
+
+	{FourCC: C.V4L2_PIX_FMT_NV12M, Name: "V4L2_PIX_FMT_NV12M", BitsPerPixel: 12, Planes: 2, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_NV21M, Name: "V4L2_PIX_FMT_NV21M", BitsPerPixel: 12, Planes: 2, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_NV16M, Name: "V4L2_PIX_FMT_NV16M", BitsPerPixel: 16, Planes: 2, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_NV61M, Name: "V4L2_PIX_FMT_NV61M", BitsPerPixel: 16, Planes: 2, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_NV12MT, Name: "V4L2_PIX_FMT_NV12MT", BitsPerPixel: 12, Planes: 2, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_NV12MT_16X16, Name: "V4L2_PIX_FMT_NV12MT_16X16", BitsPerPixel: 12, Planes: 2, Subsampling: "4:2:0"},
+
+	{FourCC: C.V4L2_PIX_FMT_YUV410, Name: "V4L2_PIX_FMT_YUV410", BitsPerPixel: 9, Planes: 1, Subsampling: "4:1:0"},
+	{FourCC: C.V4L2_PIX_FMT_YVU410, Name: "V4L2_PIX_FMT_YVU410", BitsPerPixel: 9, Planes: 1, Subsampling: "4:1:0"},
+	{FourCC: C.V4L2_PIX_FMT_YUV411P, Name: "V4L2_PIX_FMT_YUV411P", BitsPerPixel: 12, Planes: 1, Subsampling: "4:1:1"},
+	{FourCC: C.V4L2_PIX_FMT_YUV420, Name: "V4L2_PIX_FMT_YUV420", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_YVU420, Name: "V4L2_PIX_FMT_YVU420", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_YUV422P, Name: "V4L2_PIX_FMT_YUV422P", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+
+	{FourCC: C.V4L2_PIX_FMT_YUV420M, Name: "V4L2_PIX_FMT_YUV420M", BitsPerPixel: 12, Planes: 3, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_YVU420M, Name: "V4L2_PIX_FMT_YVU420M", BitsPerPixel: 12, Planes: 3, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_YUV422M, Name: "V4L2_PIX_FMT_YUV422M", BitsPerPixel: 16, Planes: 3, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_YVU422M, Name: "V4L2_PIX_FMT_YVU422M", BitsPerPixel: 16, Planes: 3, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_YUV444M, Name: "V4L2_PIX_FMT_YUV444M", BitsPerPixel: 24, Planes: 3, Subsampling: "4:4:4"},
+	{FourCC: C.V4L2_PIX_FMT_YVU444M, Name: "V4L2_PIX_FMT_YVU444M", BitsPerPixel: 24, Planes: 3, Subsampling: "4:4:4"},
+
+	{FourCC: C.V4L2_PIX_FMT_SBGGR8, Name: "V4L2_PIX_FMT_SBGGR8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGBRG8, Name: "V4L2_PIX_FMT_SGBRG8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGRBG8, Name: "V4L2_PIX_FMT_SGRBG8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SRGGB8, Name: "V4L2_PIX_FMT_SRGGB8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SBGGR10, Name: "V4L2_PIX_FMT_SBGGR10", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGBRG10, Name: "V4L2_PIX_FMT_SGBRG10", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGRBG10, Name: "V4L2_PIX_FMT_SGRBG10", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SRGGB10, Name: "V4L2_PIX_FMT_SRGGB10", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SBGGR10P, Name: "V4L2_PIX_FMT_SBGGR10P", BitsPerPixel: 10, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGBRG10P, Name: "V4L2_PIX_FMT_SGBRG10P", BitsPerPixel: 10, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGRBG10P, Name: "V4L2_PIX_FMT_SGRBG10P", BitsPerPixel: 10, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SRGGB10P, Name: "V4L2_PIX_FMT_SRGGB10P", BitsPerPixel: 10, Planes: 1},
+
+	{FourCC: C.V4L2_PIX_FMT_SBGGR10ALAW8, Name: "V4L2_PIX_FMT_SBGGR10ALAW8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGBRG10ALAW8, Name: "V4L2_PIX_FMT_SGBRG10ALAW8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGRBG10ALAW8, Name: "V4L2_PIX_FMT_SGRBG10ALAW8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SRGGB10ALAW8, Name: "V4L2_PIX_FMT_SRGGB10ALAW8", BitsPerPixel: 8, Planes: 1},
+
+	{FourCC: C.V4L2_PIX_FMT_SBGGR10DPCM8, Name: "V4L2_PIX_FMT_SBGGR10DPCM8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGBRG10DPCM8, Name: "V4L2_PIX_FMT_SGBRG10DPCM8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGRBG10DPCM8, Name: "V4L2_PIX_FMT_SGRBG10DPCM8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SRGGB10DPCM8, Name: "V4L2_PIX_FMT_SRGGB10DPCM8", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SBGGR12, Name: "V4L2_PIX_FMT_SBGGR12", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGBRG12, Name: "V4L2_PIX_FMT_SGBRG12", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SGRBG12, Name: "V4L2_PIX_FMT_SGRBG12", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SRGGB12, Name: "V4L2_PIX_FMT_SRGGB12", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SBGGR16, Name: "V4L2_PIX_FMT_SBGGR16", BitsPerPixel: 16, Planes: 1},
+
+	{FourCC: C.V4L2_PIX_FMT_MJPEG, Name: "V4L2_PIX_FMT_MJPEG", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_JPEG, Name: "V4L2_PIX_FMT_JPEG", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_DV, Name: "V4L2_PIX_FMT_DV", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_MPEG, Name: "V4L2_PIX_FMT_MPEG", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_H264, Name: "V4L2_PIX_FMT_H264", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_H264_NO_SC, Name: "V4L2_PIX_FMT_H264_NO_SC", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_H264_MVC, Name: "V4L2_PIX_FMT_H264_MVC", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_H263, Name: "V4L2_PIX_FMT_H263", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_MPEG1, Name: "V4L2_PIX_FMT_MPEG1", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_MPEG2, Name: "V4L2_PIX_FMT_MPEG2", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_MPEG4, Name: "V4L2_PIX_FMT_MPEG4", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_XVID, Name: "V4L2_PIX_FMT_XVID", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_VC1_ANNEX_G, Name: "V4L2_PIX_FMT_VC1_ANNEX_G", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_VC1_ANNEX_L, Name: "V4L2_PIX_FMT_VC1_ANNEX_L", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_VP8, Name: "V4L2_PIX_FMT_VP8", Compressed: true, Planes: 1},
+
+	{FourCC: C.V4L2_PIX_FMT_CPIA1, Name: "V4L2_PIX_FMT_CPIA1", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_WNVA, Name: "V4L2_PIX_FMT_WNVA", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SN9C10X, Name: "V4L2_PIX_FMT_SN9C10X", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SN9C20X_I420, Name: "V4L2_PIX_FMT_SN9C20X_I420", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_PWC1, Name: "V4L2_PIX_FMT_PWC1", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_PWC2, Name: "V4L2_PIX_FMT_PWC2", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_ET61X251, Name: "V4L2_PIX_FMT_ET61X251", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SPCA501, Name: "V4L2_PIX_FMT_SPCA501", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_SPCA505, Name: "V4L2_PIX_FMT_SPCA505", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_SPCA508, Name: "V4L2_PIX_FMT_SPCA508", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_SPCA561, Name: "V4L2_PIX_FMT_SPCA561", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_PAC207, Name: "V4L2_PIX_FMT_PAC207", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_MR97310A, Name: "V4L2_PIX_FMT_MR97310A", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_JL2005BCD, Name: "V4L2_PIX_FMT_JL2005BCD", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SN9C2028, Name: "V4L2_PIX_FMT_SN9C2028", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SQ905C, Name: "V4L2_PIX_FMT_SQ905C", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_PJPG, Name: "V4L2_PIX_FMT_PJPG", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_OV511, Name: "V4L2_PIX_FMT_OV511", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_OV518, Name: "V4L2_PIX_FMT_OV518", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_STV0680, Name: "V4L2_PIX_FMT_STV0680", BitsPerPixel: 8, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_TM6000, Name: "V4L2_PIX_FMT_TM6000", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_CIT_YYVYUY, Name: "V4L2_PIX_FMT_CIT_YYVYUY", BitsPerPixel: 16, Planes: 1, Subsampling: "4:2:2"},
+	{FourCC: C.V4L2_PIX_FMT_KONICA420, Name: "V4L2_PIX_FMT_KONICA420", BitsPerPixel: 12, Planes: 1, Subsampling: "4:2:0"},
+	{FourCC: C.V4L2_PIX_FMT_JPGL, Name: "V4L2_PIX_FMT_JPGL", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_SE401, Name: "V4L2_PIX_FMT_SE401", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_S5C_UYVY_JPG, Name: "V4L2_PIX_FMT_S5C_UYVY_JPG", Compressed: true, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Y8I, Name: "V4L2_PIX_FMT_Y8I", BitsPerPixel: 16, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Y12I, Name: "V4L2_PIX_FMT_Y12I", BitsPerPixel: 24, Planes: 1},
+	{FourCC: C.V4L2_PIX_FMT_Z16, Name: "V4L2_PIX_FMT_Z16", BitsPerPixel: 16, Planes: 1},
 }
 
 //-------------------------------------------------------------------------------------------------
@@ -168,9 +195,15 @@ var formatToString = map[uint32]string{
 //-------------------------------------------------------------------------------------------------
 
 type pixelFormat struct {
-	name  string
-	desc  string
-	value uint32
+	name    string
+	desc    string
+	value   FourCC
+	flags   uint32
+	bufType BufferType
+}
+
+func newPixelFormat(code FourCC, desc string) pixelFormat {
+	return pixelFormat{name: formatName(code), desc: desc, value: code, bufType: BUF_TYPE_VIDEO_CAPTURE}
 }
 
 func (p pixelFormat) Name() string {
@@ -181,47 +214,163 @@ func (p pixelFormat) Description() string {
 	return p.desc
 }
 
+func (p pixelFormat) FourCC() FourCC {
+	return p.value
+}
+
+// Compressed prefers the flag reported by the device, formats not enumerated
+// from a device fall back to the registered metadata.
+func (p pixelFormat) Compressed() bool {
+	if p.flags&C.V4L2_FMT_FLAG_COMPRESSED != 0 {
+		return true
+	}
+
+	info, ok := lookupFormat(p.value)
+	return ok && info.Compressed
+}
+
+func (p pixelFormat) Emulated() bool {
+	return p.flags&C.V4L2_FMT_FLAG_EMULATED != 0
+}
+
+func (p pixelFormat) BufferType() BufferType {
+	return p.bufType
+}
+
 func (p pixelFormat) String() string {
-	return fmt.Sprintf("PixelFormat[%s - %s, %d]", p.name, p.desc, p.value)
+	return fmt.Sprintf("PixelFormat[%s - %s, %v]", p.name, p.desc, p.value)
 }
 
 //-------------------------------------------------------------------------------------------------
 //QUERY FORMAT
 //-------------------------------------------------------------------------------------------------
 
+// QueryFormats lists formats of the buffer type the device captures with.
 func (d *device) QueryFormats() ([]PixelFormat, error) {
+	return d.QueryFormatsOf(d.bufType)
+}
 
-	result := []PixelFormat{}
-
-	desc, err := C.queryFormats(C.int(d.file.Fd()), nil)
+func (d *device) QueryFormatsOf(bufType BufferType) ([]PixelFormat, error) {
 
-	if err != nil {
+	if err := d.lock(false); err != nil {
 		return nil, err
 	}
 
-	formatCode := binary.LittleEndian.Uint32(C.GoBytes(unsafe.Pointer(&desc.pixelformat), 4))
-	name := formatToString[formatCode]
-	description := readString((uintptr)(unsafe.Pointer(&desc.description)), 32)
+	defer d.mu.Unlock()
+
+	return d.queryFormats(bufType)
+}
 
-	result = append(result, pixelFormat{name: name, desc: description, value: formatCode})
+// queryFormats enumerates formats until the driver answers EINVAL. EINVAL for
+// the very first index means the buffer type is not supported at all.
+func (d *device) queryFormats(bufType BufferType) ([]PixelFormat, error) {
 
-	for {
-		desc, err = C.queryFormats(C.int(d.file.Fd()), desc)
+	result := []PixelFormat{}
 
-		if desc == nil {
+	for index := 0; ; index++ {
+		var desc C.struct_v4l2_fmtdesc
+
+		err := d.backend.enumFormat(int(d.file.Fd()), bufType, uint32(index), &desc)
+
+		if err == syscall.EINVAL && index == 0 {
+			return nil, fmt.Errorf("Cannot enumerate formats of %v: %w", bufType, ErrUnsupportedBufferType)
+		}
+
+		if err == syscall.EINVAL {
 			break
 		}
 
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Cannot enumerate format %d of %v: %w", index, bufType, err)
 		}
 
-		formatCode = binary.LittleEndian.Uint32(C.GoBytes(unsafe.Pointer(&desc.pixelformat), 4))
-		name = formatToString[formatCode]
-		description = readString((uintptr)(unsafe.Pointer(&desc.description)), 32)
+		format := newPixelFormat(FourCC(desc.pixelformat), readString(unsafe.Pointer(&desc.description), 32))
+		format.flags = uint32(desc.flags)
+		format.bufType = bufType
 
-		result = append(result, pixelFormat{name: name, desc: description, value: formatCode})
+		result = append(result, format)
 	}
 
 	return result, nil
 }
+
+//-------------------------------------------------------------------------------------------------
+//CURRENT FORMAT
+//-------------------------------------------------------------------------------------------------
+
+func (d *device) CurrentFrameSize() (DiscreteFrameSize, error) {
+
+	if err := d.lock(false); err != nil {
+		return DiscreteFrameSize{}, err
+	}
+
+	defer d.mu.Unlock()
+
+	var format C.struct_v4l2_format
+
+	err := d.backend.getFormat(int(d.file.Fd()), d.bufType, &format)
+	d.ioctlFailed("G_FMT", err)
+
+	if err != nil {
+		return DiscreteFrameSize{}, err
+	}
+
+	layout := newFrameLayout(d.bufType, &format)
+
+	formats, err := d.queryFormats(d.bufType)
+
+	if err != nil {
+		return DiscreteFrameSize{}, err
+	}
+
+	pixFmt := newPixelFormat(layout.format, "")
+	pixFmt.bufType = d.bufType
+
+	var result PixelFormat = pixFmt
+
+	for _, f := range formats {
+		if f.FourCC() == layout.format {
+			result = f
+		}
+	}
+
+	return DiscreteFrameSize{PixelFormat: result, Width: layout.width, Height: layout.height}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+//FRAME LAYOUT
+//-------------------------------------------------------------------------------------------------
+
+// frameLayout is the geometry of frames the driver agreed on, with the length
+// of a line and the size of the image in bytes for every plane.
+type frameLayout struct {
+	format  FourCC
+	width   uint32
+	height  uint32
+	strides []uint32
+	sizes   []uint32
+}
+
+func newFrameLayout(bufType BufferType, format *C.struct_v4l2_format) frameLayout {
+
+	if bufType != BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		pix := (*C.struct_v4l2_pix_format)(unsafe.Pointer(&format.fmt))
+		return frameLayout{
+			format:  FourCC(pix.pixelformat),
+			width:   uint32(pix.width),
+			height:  uint32(pix.height),
+			strides: []uint32{uint32(pix.bytesperline)},
+			sizes:   []uint32{uint32(pix.sizeimage)},
+		}
+	}
+
+	pix := (*C.struct_v4l2_pix_format_mplane)(unsafe.Pointer(&format.fmt))
+	layout := frameLayout{format: FourCC(pix.pixelformat), width: uint32(pix.width), height: uint32(pix.height)}
+
+	for i := 0; i < int(pix.num_planes) && i < C.VIDEO_MAX_PLANES; i++ {
+		layout.strides = append(layout.strides, uint32(pix.plane_fmt[i].bytesperline))
+		layout.sizes = append(layout.sizes, uint32(pix.plane_fmt[i].sizeimage))
+	}
+
+	return layout
+}
@@ -0,0 +1,146 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+//---------------------------------------------------------------------------------------------------
+//FRAME INTERVALS
+//---------------------------------------------------------------------------------------------------
+
+type frameIntervals struct {
+	discrete []Fraction
+	stepwise []StepwiseFrameInterval
+}
+
+func (f frameIntervals) Discrete() []Fraction {
+	return f.discrete
+}
+
+func (f frameIntervals) Stepwise() []StepwiseFrameInterval {
+	return f.stepwise
+}
+
+//---------------------------------------------------------------------------------------------------
+//QUERY FRAME INTERVALS
+//---------------------------------------------------------------------------------------------------
+
+func (d *device) QueryFrameIntervals(frameSize DiscreteFrameSize) (FrameIntervals, error) {
+
+	if err := d.lock(false); err != nil {
+		return nil, err
+	}
+
+	defer d.mu.Unlock()
+
+	discrete := []Fraction{}
+	stepwise := []StepwiseFrameInterval{}
+
+	for index := 0; ; index++ {
+		var info C.struct_v4l2_frmivalenum
+
+		_, err := C.queryFrameInterval(C.int(d.file.Fd()), C.__u32(index), C.__u32(frameSize.PixelFormat.FourCC()), C.__u32(frameSize.Width), C.__u32(frameSize.Height), &info)
+
+		if err == syscall.EINVAL {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if info._type == C.V4L2_FRMIVAL_TYPE_DISCRETE {
+			discrete = append(discrete, newFraction((*C.struct_v4l2_fract)(unsafe.Pointer(&info.anon0))))
+			continue
+		}
+
+		//stepwise and continuous intervals are described by a single entry
+		ptr := (*C.struct_v4l2_frmival_stepwise)(unsafe.Pointer(&info.anon0))
+		stepwise = append(stepwise, StepwiseFrameInterval{Min: newFraction(&ptr.min), Max: newFraction(&ptr.max), Step: newFraction(&ptr.step)})
+		break
+	}
+
+	return frameIntervals{discrete: discrete, stepwise: stepwise}, nil
+}
+
+func newFraction(fract *C.struct_v4l2_fract) Fraction {
+	return Fraction{Numerator: uint32(fract.numerator), Denominator: uint32(fract.denominator)}
+}
+
+//---------------------------------------------------------------------------------------------------
+//GET/SET FRAME INTERVAL
+//---------------------------------------------------------------------------------------------------
+
+func (d *device) FrameInterval() (Fraction, error) {
+
+	if err := d.lock(false); err != nil {
+		return Fraction{}, err
+	}
+
+	defer d.mu.Unlock()
+
+	var capture C.struct_v4l2_captureparm
+
+	err := d.backend.getFrameInterval(int(d.file.Fd()), d.bufType, &capture)
+	d.ioctlFailed("G_PARM", err)
+
+	if err != nil {
+		return Fraction{}, err
+	}
+
+	return newFraction(&capture.timeperframe), nil
+}
+
+// SetFrameInterval sets the interval between frames and returns the one the
+// driver actually chose. The interval is kept and applied again whenever the
+// frame size of the device changes.
+func (d *device) SetFrameInterval(interval Fraction) (Fraction, error) {
+
+	if err := d.lock(true); err != nil {
+		return Fraction{}, err
+	}
+
+	defer d.mu.Unlock()
+
+	actual, err := d.applyFrameInterval(interval)
+
+	if err != nil {
+		return Fraction{}, err
+	}
+
+	d.frameInterval = &interval
+
+	return actual, nil
+}
+
+func (d *device) applyFrameInterval(interval Fraction) (Fraction, error) {
+
+	var capture C.struct_v4l2_captureparm
+
+	err := d.backend.getFrameInterval(int(d.file.Fd()), d.bufType, &capture)
+	d.ioctlFailed("G_PARM", err)
+
+	if err != nil {
+		return Fraction{}, err
+	}
+
+	if capture.capability&C.V4L2_CAP_TIMEPERFRAME == 0 {
+		return Fraction{}, errors.New("Device does not support setting of frame interval.")
+	}
+
+	fract := C.struct_v4l2_fract{numerator: C.__u32(interval.Numerator), denominator: C.__u32(interval.Denominator)}
+
+	err = d.backend.setFrameInterval(int(d.file.Fd()), d.bufType, &fract)
+	d.ioctlFailed("S_PARM", err)
+
+	if err != nil {
+		return Fraction{}, err
+	}
+
+	return newFraction(&fract), nil
+}
@@ -32,7 +32,11 @@ func (f frameSizes) Stepwise() []StepwiseFrameSize {
 
 func (d *device) QueryFrameSizes(f PixelFormat) (FrameSizes, error) {
 
-	raw := f.(pixelFormat)
+	if err := d.lock(false); err != nil {
+		return nil, err
+	}
+
+	defer d.mu.Unlock()
 
 	discrete := []DiscreteFrameSize{}
 	stepwise := []StepwiseFrameSize{}
@@ -41,7 +45,7 @@ func (d *device) QueryFrameSizes(f PixelFormat) (FrameSizes, error) {
 	var err error
 
 	for {
-		info, err = C.queryFramesizes(C.int(d.file.Fd()), C.uint(raw.value), info)
+		info, err = C.queryFramesizes(C.int(d.file.Fd()), C.uint(f.FourCC()), info)
 
 		if err == syscall.EINVAL {
 			break
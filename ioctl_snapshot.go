@@ -3,8 +3,8 @@ package webcam
 // #include "v4l2-binding.h"
 import "C"
 import (
-	"encoding/binary"
-	"log"
+	"fmt"
+	"syscall"
 	"unsafe"
 )
 
@@ -13,221 +13,685 @@ import (
 //-----------------------------------------------------------------------------
 
 type snapshot struct {
-	data []byte
+	data    []byte
+	planes  [][]byte
+	strides []uint32
+	//data has been drawn from the pool of copied frames
+	pooled bool
+	meta   frameMeta
 }
 
+// Data of a snapshot viewing several planes in place is joined on first use.
 func (s *snapshot) Data() []byte {
+	if s.data == nil && len(s.planes) > 0 {
+		for _, plane := range s.planes {
+			s.data = append(s.data, plane...)
+		}
+	}
 	return s.data
 }
 
+func (s *snapshot) Planes() [][]byte {
+	if s.planes == nil {
+		return [][]byte{s.data}
+	}
+	return s.planes
+}
+
+func (s *snapshot) Strides() []uint32 {
+	return s.strides
+}
+
+func (s *snapshot) Release() {
+	if s.pooled && s.data != nil {
+		copiedFrames.put(s.data)
+	}
+
+	s.data = nil
+	s.planes = nil
+	s.pooled = false
+}
+
 //------------------------------------------------------------------------------
 //TAKE SNAPSHOT
 //------------------------------------------------------------------------------
 
+// TakeSnapshot captures a single frame as a short stream, so that the device
+// can be queried and closed while the snapshot waits for the frame.
 func (d *device) TakeSnapshot(frameSize *DiscreteFrameSize) (Snapshot, error) {
 
-	err := setFrameSize(d, frameSize)
+	var snap *snapshot
+
+	err := d.runStream(frameSize, d.snapshotOptions(), func(stats *streamStats, closing chan struct{}) error {
+		var err error
+		snap, err = d.captureFrame(stats, closing)
+		return err
+	})
 
 	if err != nil {
+		if snap != nil {
+			snap.Release()
+		}
 		return nil, err
 	}
 
-	_, err = C.requestBuffer(C.int(d.file.Fd()))
+	return snap, nil
+}
 
-	if err != nil {
-		return nil, err
-	}
+func (d *device) StreamSnapshots(framesize *DiscreteFrameSize, snapChan chan Snapshot, errChan chan error, stop chan bool) {
 
-	var requestedBuffer *C.struct_v4l2_buffer
+	defer close(snapChan)
+	defer close(errChan)
 
-	requestedBuffer, err = C.queryBuffer(C.int(d.file.Fd()))
+	err := d.runStream(framesize, d.snapshotOptions(), func(stats *streamStats, closing chan struct{}) error {
+		return d.stream(stats, snapChan, stop, closing)
+	})
 
 	if err != nil {
-		return nil, err
+		errChan <- err
 	}
+}
+
+// runStream starts capturing and runs the loop of a stream with the device
+// unlocked, so that the device can be queried meanwhile. Capturing is torn down
+// once the loop returns.
+func (d *device) runStream(framesize *DiscreteFrameSize, options StreamOptions, loop func(stats *streamStats, closing chan struct{}) error) error {
 
-	defer C.free(unsafe.Pointer(requestedBuffer))
+	if err := d.lock(true); err != nil {
+		return err
+	}
 
-	mappedMemoryPtr, err := mmap(d, requestedBuffer)
+	err := d.startCapture(framesize, options)
+	d.streamErr = err
 
 	if err != nil {
-		return nil, err
+		d.mu.Unlock()
+		return err
 	}
 
-	defer func() {
-		err = munmap(mappedMemoryPtr, requestedBuffer)
+	closing := make(chan struct{})
+	done := make(chan struct{})
+	stats := newStreamStats(&d.totals, len(d.buffers), options.StatsWindow)
+
+	d.state = stateStreaming
+	d.closing = closing
+	d.streamDone = done
+	d.stats.Store(stats)
+	d.mu.Unlock()
+
+	finished := make(chan struct{})
+	emitted := make(chan struct{})
+
+	if options.Stats != nil {
+		go func() {
+			emitStats(stats, options.StatsInterval, options.Stats, finished)
+			close(emitted)
+		}()
+	} else {
+		close(emitted)
+	}
+
+	//----STREAMING------
+	err = loop(stats, closing)
+	//-------------------
+
+	stats.finish(err)
+	close(finished)
+	<-emitted
+
+	d.mu.Lock()
+	err = combineErrors(err, d.stopCapture())
+	d.streamErr = err
+	d.state = stateConfigured
+	d.closing = nil
+	d.streamDone = nil
+	close(done)
+	d.mu.Unlock()
+
+	return err
+}
+
+// stream delivers frames until it is stopped either by the caller or by Close().
+// The device is locked only for the ioctls, not while waiting for a frame, so that
+// other goroutines may query the device in the meantime.
+func (d *device) stream(stats *streamStats, snapChan chan Snapshot, stop chan bool, closing chan struct{}) error {
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-closing:
+			return nil
+		default:
+		}
+
+		ready, err := d.waitForFrame(streamPollTimeout, true)
+
+		if err != nil {
+			return err
+		}
+
+		if !ready {
+			continue
+		}
+
+		d.mu.Lock()
+		snap, err := d.dequeueFrame()
+
+		if err == nil {
+			stats.received(snap.meta, d.queued)
+		}
+		d.mu.Unlock()
 
 		if err != nil {
-			log.Printf("Cannot munma memory region: %v\n", err)
+			return err
 		}
-	}()
 
-	var buffer *C.struct_v4l2_buffer
+		meta := snap.meta
+
+		select {
+		case snapChan <- snap:
+			stats.delivered(meta)
+		case <-stop:
+			return nil
+		case <-closing:
+			return nil
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+//CAPTURING LIFECYCLE
+//------------------------------------------------------------------------------
+
+// mappedBuffer holds the memory of every plane of a buffer, a single-planar
+// buffer has just one.
+type mappedBuffer struct {
+	planes []mappedPlane
+	//viewed by a zero-copy frame, which unmaps the buffer itself if it is
+	//released after the stream finished
+	leased bool
+}
 
-	buffer, err = C.newBuffer()
+type mappedPlane struct {
+	//memory of the plane as seen by this process, nil if it could not be mapped
+	data   []byte
+	length uint32
+	unmap  func([]byte) error
+	//file descriptor of an exported or imported dma-buf, -1 if there is none;
+	//exported ones are closed with the stream, imported ones belong to the caller
+	dmabuf   int
+	exported bool
+}
+
+// snapshotOptions must be called with the device unlocked. Snapshots are taken
+// with a single buffer, which is copied and queued again right away, or by
+// read() when SetSnapshotReadIO asked for it.
+func (d *device) snapshotOptions() StreamOptions {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return StreamOptions{Buffers: 1, ReadIO: d.snapshotReadIO}
+}
+
+// SetSnapshotReadIO makes TakeSnapshot and StreamSnapshots read frames by read()
+// even if the device is able to stream. It takes effect with the next snapshot.
+func (d *device) SetSnapshotReadIO(readIO bool) error {
+
+	if err := d.lock(false); err != nil {
+		return err
+	}
+
+	defer d.mu.Unlock()
+
+	if readIO && !d.canRead {
+		return errCannotRead
+	}
+
+	d.snapshotReadIO = readIO
+	return nil
+}
+
+// startCapture must be called with the device locked. It configures the frame
+// size, requests, maps and queues the buffers and turns streaming on. Whatever
+// has been acquired is released again when any step fails.
+func (d *device) startCapture(frameSize *DiscreteFrameSize, options StreamOptions) error {
+
+	layout, err := setFrameSize(d, frameSize)
 
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	d.state = stateConfigured
+	d.layout = layout
+
+	if d.frameInterval != nil {
+		if _, err := d.applyFrameInterval(*d.frameInterval); err != nil {
+			return err
+		}
+	}
+
+	if options.ReadIO || !d.canStream {
+		return d.startReading()
 	}
 
-	defer C.free(unsafe.Pointer(buffer))
+	if d.bufType == BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		d.planes = C.newPlanes()
+	}
 
-	_, err = C.streamOn(C.int(d.file.Fd()))
+	granted, err := d.requestBuffers(options)
 
 	if err != nil {
-		return nil, err
+		return combineErrors(err, d.stopCapture())
 	}
 
-	_, err = C.queueBuffer(C.int(d.file.Fd()), buffer)
+	for index := uint32(0); index < granted; index++ {
+		if err := d.prepareBuffer(index, options); err != nil {
+			return combineErrors(err, d.stopCapture())
+		}
+	}
+
+	d.generation++
+	d.streaming = true
+	err = d.backend.streamOn(int(d.file.Fd()), d.bufType)
+	d.ioctlFailed("STREAMON", err)
 
 	if err != nil {
-		return nil, err
+		return combineErrors(err, d.stopCapture())
+	}
+
+	return nil
+}
+
+// prepareBuffer maps, allocates or imports the memory of a requested buffer
+// (depending on the memory of the stream) and queues the buffer.
+func (d *device) prepareBuffer(index uint32, options StreamOptions) error {
+
+	var buffer mappedBuffer
+	var err error
+
+	switch d.memory {
+	case MEMORY_USERPTR:
+		buffer, err = d.allocateBuffer()
+	case MEMORY_DMABUF:
+		buffer, err = d.importBuffer(options.DMABufFds[index])
+	default:
+		buffer, err = d.mapBuffer(index)
 	}
 
-	_, err = C.dequeueBuffer(C.int(d.file.Fd()), buffer)
+	d.buffers = append(d.buffers, buffer)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	bytes := copyBytes(mappedMemoryPtr, requestedBuffer)
+	if options.ExportDMABuf && d.memory == MEMORY_MMAP {
+		if err := d.exportBuffer(index); err != nil {
+			return err
+		}
+	}
+
+	return d.queueBuffer(index)
+}
+
+func (d *device) mapBuffer(index uint32) (mappedBuffer, error) {
 
-	_, err = C.streamOff(C.int(d.file.Fd()))
+	requestedBuffer := d.newCaptureBuffer(index)
+	err := d.backend.queryBuffer(int(d.file.Fd()), &requestedBuffer)
+	d.ioctlFailed("QUERYBUF", err)
 
 	if err != nil {
-		return nil, err
+		return mappedBuffer{}, err
 	}
 
-	return &snapshot{bytes}, nil
+	return d.mmapBuffer(&requestedBuffer)
 }
 
-func (d *device) StreamSnapshots(framesize *DiscreteFrameSize, snapChan chan Snapshot, errChan chan error, stop chan bool) {
+// exportBuffer exports every plane of a mapped buffer as a dma-buf.
+func (d *device) exportBuffer(index uint32) error {
 
-	defer close(snapChan)
-	defer close(errChan)
+	planes := d.buffers[index].planes
 
-	err := setFrameSize(d, framesize)
+	for i := range planes {
+		fd, err := d.backend.exportBuffer(int(d.file.Fd()), d.bufType, index, uint32(i))
+		d.ioctlFailed("EXPBUF", err)
 
-	if err != nil {
-		errChan <- err
-		return
+		if err != nil {
+			return fmt.Errorf("Cannot export plane %d of buffer %d: %w", i, index, err)
+		}
+
+		planes[i].dmabuf = fd
+		planes[i].exported = true
+	}
+
+	return nil
+}
+
+// how long a stream waits for a frame in milliseconds before it checks whether it
+// has been asked to stop
+const streamPollTimeout = 200
+
+// captureFrame waits for a frame and returns its copy. Like a stream it waits
+// with the device unlocked and gives up once the device is being closed.
+func (d *device) captureFrame(stats *streamStats, closing chan struct{}) (*snapshot, error) {
+	for {
+		select {
+		case <-closing:
+			return nil, ErrDeviceClosed
+		default:
+		}
+
+		ready, err := d.waitForFrame(streamPollTimeout, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ready {
+			continue
+		}
+
+		d.mu.Lock()
+		snap, err := d.dequeueFrame()
+
+		if err == nil {
+			stats.received(snap.meta, d.queued)
+			stats.delivered(snap.meta)
+		}
+		d.mu.Unlock()
+
+		return snap, err
 	}
+}
 
-	_, err = C.requestBuffer(C.int(d.file.Fd()))
+// waitForFrame polls the device for a frame. Streams wait with the device
+// unlocked and dispatch events that became pending meanwhile, waiting with the
+// device locked leaves them to the event pump.
+func (d *device) waitForFrame(timeout int, dispatch bool) (bool, error) {
+
+	events := C.short(C.POLLIN)
+
+	if dispatch {
+		events |= C.POLLPRI
+	}
+
+	revents, err := d.poll(events, timeout)
 
 	if err != nil {
-		errChan <- err
-		return
+		return false, err
+	}
+
+	if revents&C.POLLPRI != 0 {
+		d.mu.Lock()
+		d.dispatchEvents()
+		d.mu.Unlock()
 	}
 
-	var requestedBuffer *C.struct_v4l2_buffer
+	//errors are reported by dequeueing
+	return revents&^C.POLLPRI != 0, nil
+}
+
+// poll waits for the events on the device, an interrupted wait returns no event.
+func (d *device) poll(events C.short, timeout int) (C.short, error) {
 
-	requestedBuffer, err = C.queryBuffer(C.int(d.file.Fd()))
+	revents, err := d.backend.poll(int(d.file.Fd()), events, timeout)
 
 	if err != nil {
-		errChan <- err
-		return
+		d.ioctlFailed("poll", err)
+		if err == syscall.EINTR {
+			return 0, nil
+		}
+		return 0, err
 	}
 
-	defer C.free(unsafe.Pointer(requestedBuffer))
+	return revents, nil
+}
 
-	mappedMemoryPtr, err := mmap(d, requestedBuffer)
+// dequeueFrame takes a filled buffer from the driver, copies its content and
+// hands the buffer back to the driver.
+func (d *device) dequeueFrame() (*snapshot, error) {
+
+	if d.reading {
+		return d.readFrame()
+	}
+
+	buffer := d.newCaptureBuffer(0)
+
+	err := d.backend.dequeueBuffer(int(d.file.Fd()), &buffer)
+	d.ioctlFailed("DQBUF", err)
 
 	if err != nil {
-		errChan <- err
-		return
+		return nil, err
 	}
 
-	defer func() {
-		err = munmap(mappedMemoryPtr, requestedBuffer)
+	d.queued--
+	snap := d.copyFrame(&buffer, copiedFrames.get)
+	snap.pooled = true
+	snap.meta = d.newFrameMeta(&buffer)
 
-		if err != nil {
-			log.Printf("Cannot munmap memory region: %v\n", err)
+	if err := d.queueBuffer(uint32(buffer.index)); err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// copyFrame copies the planes of a dequeued buffer one after another into the
+// data of the snapshot, allocated by alloc with zero length.
+func (d *device) copyFrame(buffer *C.struct_v4l2_buffer, alloc func(size int) []byte) *snapshot {
+
+	views := d.viewPlanes(buffer)
+	size := 0
+
+	for _, view := range views {
+		size += len(view)
+	}
+
+	snap := &snapshot{data: alloc(size), strides: d.layout.strides}
+
+	if d.bufType == BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		snap.planes = make([][]byte, len(views))
+	}
+
+	for i, view := range views {
+		start := len(snap.data)
+		snap.data = append(snap.data, view...)
+
+		if snap.planes != nil {
+			snap.planes[i] = snap.data[start:len(snap.data):len(snap.data)]
 		}
-	}()
+	}
+
+	return snap
+}
 
-	var buffer *C.struct_v4l2_buffer
+// viewFrame makes a snapshot of a dequeued buffer that views its memory in place,
+// so it is valid only until the buffer is queued again.
+func (d *device) viewFrame(buffer *C.struct_v4l2_buffer) *snapshot {
 
-	buffer, err = C.newBuffer()
+	views := d.viewPlanes(buffer)
 
-	if err != nil {
-		errChan <- err
-		return
+	if d.bufType != BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		return &snapshot{data: views[0], strides: d.layout.strides}
 	}
 
-	defer C.free(unsafe.Pointer(buffer))
+	return &snapshot{planes: views, strides: d.layout.strides}
+}
 
-	_, err = C.streamOn(C.int(d.file.Fd()))
+// viewPlanes returns the payload of every plane of a dequeued buffer.
+func (d *device) viewPlanes(buffer *C.struct_v4l2_buffer) [][]byte {
 
-	if err != nil {
-		errChan <- err
-		return
+	mapped := d.buffers[buffer.index]
+
+	if d.bufType != BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		return [][]byte{payload(mapped.planes[0], uint32(buffer.bytesused), 0)}
 	}
 
-	//----STREAMING------
-loop:
-	for {
-		select {
-		case <-stop:
-			break loop
+	planes := bufferPlanes(buffer)
+	views := make([][]byte, len(planes))
 
-		default:
-			_, err = C.queueBuffer(C.int(d.file.Fd()), buffer)
+	for i, plane := range planes {
+		views[i] = payload(mapped.planes[i], uint32(plane.bytesused), uint32(plane.data_offset))
+	}
 
-			if err != nil {
-				errChan <- err
-				return
-			}
+	return views
+}
 
-			_, err = C.dequeueBuffer(C.int(d.file.Fd()), buffer)
+// newCaptureBuffer describes a buffer of the device, the planes of multi-planar
+// buffers are filled in by the driver into the scratch array of the device.
+func (d *device) newCaptureBuffer(index uint32) C.struct_v4l2_buffer {
+	var buffer C.struct_v4l2_buffer
+	C.initBuffer(&buffer, C.__u32(d.bufType), C.__u32(d.memory), C.__u32(index), d.planes)
+	return buffer
+}
+
+func bufferPlanes(buffer *C.struct_v4l2_buffer) []C.struct_v4l2_plane {
+	planes := *(**C.struct_v4l2_plane)(unsafe.Pointer(&buffer.m))
+	count := int(buffer.length)
+	return (*[C.VIDEO_MAX_PLANES]C.struct_v4l2_plane)(unsafe.Pointer(planes))[:count:count]
+}
+
+// stopCapture turns streaming off, unmaps all mapped buffers and releases the
+// requested ones. It is safe to call it in any state, every step is attempted
+// and all the errors are reported together.
+func (d *device) stopCapture() error {
 
-			if err != nil {
-				errChan <- err
-				return
+	var errs []error
+
+	d.reading = false
+
+	//STREAMOFF takes back buffers queued before streaming was turned on as well
+	if d.streaming || d.requested {
+		if err := d.backend.streamOff(int(d.file.Fd()), d.bufType); err != nil {
+			d.ioctlFailed("STREAMOFF", err)
+			errs = append(errs, err)
+		}
+		d.streaming = false
+	}
+
+	for _, buffer := range d.buffers {
+		for _, plane := range buffer.planes {
+			if plane.exported {
+				if err := syscall.Close(plane.dmabuf); err != nil {
+					errs = append(errs, err)
+				}
 			}
+		}
 
-			bytes := copyBytes(mappedMemoryPtr, requestedBuffer)
-			snapChan <- &snapshot{bytes}
+		if buffer.leased {
+			continue
+		}
+
+		if err := unmapPlanes(buffer.planes); err != nil {
+			d.log(LEVEL_ERROR, "Cannot munmap memory region", errorFields(err)...)
+			errs = append(errs, err)
+		}
+	}
+	d.buffers = nil
+	d.queued = 0
+	d.leased = 0
+
+	if d.requested {
+		if _, err := d.backend.requestBuffers(int(d.file.Fd()), d.bufType, d.memory, 0); err != nil {
+			d.ioctlFailed("REQBUFS", err)
+			errs = append(errs, err)
 		}
+		d.requested = false
 	}
 
-	//-------------------
+	if d.planes != nil {
+		C.free(unsafe.Pointer(d.planes))
+		d.planes = nil
+	}
+
+	return combineErrors(errs...)
+}
 
-	_, err = C.streamOff(C.int(d.file.Fd()))
+// setFrameSize negotiates the format with the driver and returns the layout of
+// frames the driver chose.
+func setFrameSize(d *device, frameSize *DiscreteFrameSize) (frameLayout, error) {
+
+	var format C.struct_v4l2_format
+
+	err := d.backend.setFormat(int(d.file.Fd()), d.bufType, frameSize, &format)
+	d.ioctlFailed("S_FMT", err)
 
 	if err != nil {
-		errChan <- err
+		return frameLayout{}, err
 	}
+
+	return newFrameLayout(d.bufType, &format), nil
 }
 
-func setFrameSize(d *device, frameSize *DiscreteFrameSize) error {
+// mmapBuffer maps every plane of the buffer. Planes mapped before a failure are
+// returned as well, so that they get unmapped.
+func (d *device) mmapBuffer(buffer *C.struct_v4l2_buffer) (mappedBuffer, error) {
 
-	raw := frameSize.PixelFormat.(pixelFormat)
-	_, err := C.setDiscreteFrameSize(C.int(d.file.Fd()), C.uint(raw.value), C.uint(frameSize.Width), C.uint(frameSize.Height))
+	if d.bufType != BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		offset := *(*C.__u32)(unsafe.Pointer(&buffer.m))
+		plane, err := d.mmap(uint32(buffer.length), uint32(offset))
 
-	return err
+		if err != nil {
+			return mappedBuffer{}, err
+		}
+
+		return mappedBuffer{planes: []mappedPlane{plane}}, nil
+	}
+
+	result := mappedBuffer{}
+
+	for _, p := range bufferPlanes(buffer) {
+		offset := *(*C.__u32)(unsafe.Pointer(&p.m))
+		plane, err := d.mmap(uint32(p.length), uint32(offset))
+
+		if err != nil {
+			return result, err
+		}
+
+		result.planes = append(result.planes, plane)
+	}
+
+	return result, nil
 }
 
-func mmap(d *device, req_buffer *C.struct_v4l2_buffer) (uintptr, error) {
+func (d *device) mmap(length uint32, offset uint32) (mappedPlane, error) {
 
-	ptr, err := C.mmap2(C.int(d.file.Fd()), req_buffer)
+	data, err := d.backend.mmap(int(d.file.Fd()), length, offset)
 
 	if err != nil {
-		return 0, err
+		return mappedPlane{}, err
 	}
 
-	var p uintptr = (uintptr)(unsafe.Pointer(ptr))
-
-	return p, nil
+	return mappedPlane{data: data, length: length, unmap: d.backend.munmap, dmabuf: -1}, nil
 }
 
-func munmap(memPtr uintptr, req_buffer *C.struct_v4l2_buffer) error {
-	length := binary.LittleEndian.Uint32(C.GoBytes(unsafe.Pointer(&req_buffer.length), 4))
-	_, err := C.munmap2(unsafe.Pointer(memPtr), C.uint(length))
+func unmapPlanes(planes []mappedPlane) error {
 
-	return err
+	var errs []error
+
+	for _, plane := range planes {
+		if plane.data == nil || plane.unmap == nil {
+			continue
+		}
+
+		if err := plane.unmap(plane.data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return combineErrors(errs...)
 }
 
-func copyBytes(memPtr uintptr, req_buffer *C.struct_v4l2_buffer) []byte {
-	return C.GoBytes(unsafe.Pointer(memPtr), C.int(req_buffer.length))
+// payload is the part of a plane the driver filled, an unmapped plane has none.
+func payload(plane mappedPlane, used uint32, offset uint32) []byte {
+
+	if used == 0 || used > uint32(len(plane.data)) {
+		used = uint32(len(plane.data))
+	}
+
+	if offset >= used {
+		return []byte{}
+	}
+
+	return plane.data[offset:used:used]
 }
@@ -0,0 +1,220 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testDevice(t testing.TB) (*device, *fakeBackend) {
+	code, err := ParseFourCC("YUYV")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := newFakeBackend(code)
+	dev, err := newFakeDevice(backend)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dev, backend
+}
+
+// assertReleased checks that capturing has been torn down completely.
+func assertReleased(t *testing.T, backend *fakeBackend) {
+	t.Helper()
+
+	if backend.called("STREAMOFF") == 0 {
+		t.Errorf("STREAMOFF was not issued")
+	}
+
+	if n := backend.liveMappings(); n != 0 {
+		t.Errorf("%d buffers are still mapped", n)
+	}
+
+	if backend.called("REQBUFS(0)") == 0 {
+		t.Errorf("REQBUFS(0) was not issued")
+	}
+}
+
+func TestTakeSnapshotReleasesCapture(t *testing.T) {
+	dev, backend := testDevice(t)
+	defer dev.Close()
+
+	snap, err := dev.TakeSnapshot(testFrameSize(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snap.Data()) != 64 {
+		t.Errorf("Snapshot has %d bytes, expected 64", len(snap.Data()))
+	}
+
+	snap.Release()
+	assertReleased(t, backend)
+}
+
+func TestCloseReleasesRunningStream(t *testing.T) {
+	dev, backend := testDevice(t)
+
+	snaps := make(chan Snapshot)
+	errs := make(chan error, 1)
+
+	go dev.StreamSnapshots(testFrameSize(t), snaps, errs, make(chan bool))
+
+	(<-snaps).Release()
+
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for range snaps {
+	}
+
+	if err := <-errs; err != nil {
+		t.Errorf("Stream failed: %v", err)
+	}
+
+	assertReleased(t, backend)
+
+	if err := dev.Close(); err != ErrDeviceClosed {
+		t.Errorf("Second close returned %v, expected %v", err, ErrDeviceClosed)
+	}
+}
+
+func TestFailedStartReleasesCapture(t *testing.T) {
+	for _, op := range []string{"REQBUFS", "QUERYBUF", "mmap", "QBUF", "STREAMON", "DQBUF"} {
+		t.Run(op, func(t *testing.T) {
+			dev, backend := testDevice(t)
+			defer dev.Close()
+
+			backend.fail(op, syscall.EIO)
+
+			if _, err := dev.TakeSnapshot(testFrameSize(t)); !errors.Is(err, syscall.EIO) {
+				t.Fatalf("TakeSnapshot returned %v, expected %v", err, syscall.EIO)
+			}
+
+			assertReleased(t, backend)
+		})
+	}
+}
+
+func TestFailedExportReleasesCapture(t *testing.T) {
+	dev, backend := testDevice(t)
+	defer dev.Close()
+
+	backend.fail("EXPBUF", syscall.EIO)
+
+	frames := make(chan Frame)
+	errs := make(chan error, 1)
+
+	go dev.StreamFrames(testFrameSize(t), StreamOptions{ExportDMABuf: true}, frames, errs, make(chan bool))
+
+	for range frames {
+		t.Error("Stream delivered a frame")
+	}
+
+	if err := <-errs; !errors.Is(err, syscall.EIO) {
+		t.Errorf("Stream failed with %v, expected %v", err, syscall.EIO)
+	}
+
+	assertReleased(t, backend)
+}
+
+func TestStopCaptureCombinesErrors(t *testing.T) {
+	dev, backend := testDevice(t)
+	defer dev.Close()
+
+	backend.fail("STREAMON", syscall.EIO)
+	backend.fail("STREAMOFF", syscall.ENODEV)
+	backend.fail("munmap", syscall.EINVAL)
+	backend.fail("REQBUFS(0)", syscall.EBUSY)
+
+	_, err := dev.TakeSnapshot(testFrameSize(t))
+
+	for _, expected := range []error{syscall.EIO, syscall.ENODEV, syscall.EINVAL, syscall.EBUSY} {
+		if !errors.Is(err, expected) {
+			t.Errorf("Error %v does not contain %v", err, expected)
+		}
+	}
+
+	if _, ok := err.(multiError); !ok {
+		t.Errorf("Error %v is not combined", err)
+	}
+
+	//every step is attempted although the previous ones failed
+	if backend.called("munmap") == 0 || backend.called("REQBUFS(0)") == 0 {
+		t.Errorf("Teardown stopped at the first failure")
+	}
+}
+
+func TestCloseWaitsForStream(t *testing.T) {
+	dev, backend := testDevice(t)
+
+	frames := make(chan Frame)
+	errs := make(chan error, 1)
+
+	go dev.StreamFrames(testFrameSize(t), StreamOptions{}, frames, errs, make(chan bool))
+
+	//the consumer keeps the frame until after Close
+	f := <-frames
+	closed := make(chan error, 1)
+
+	go func() { closed <- dev.Close() }()
+
+	for range frames {
+	}
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not finish")
+	}
+
+	f.Release()
+	<-errs
+
+	assertReleased(t, backend)
+}
+
+func TestSnapshotReadIO(t *testing.T) {
+	dev, backend := testDevice(t)
+	defer dev.Close()
+
+	if err := dev.SetSnapshotReadIO(true); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := dev.TakeSnapshot(testFrameSize(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap.Release()
+
+	if backend.called("read") == 0 {
+		t.Errorf("Snapshot was not read by read()")
+	}
+
+	if n := backend.called("REQBUFS"); n != 0 {
+		t.Errorf("Snapshot requested buffers %d times, expected none", n)
+	}
+
+	dev.canRead = false
+
+	if err := dev.SetSnapshotReadIO(true); err != errCannotRead {
+		t.Errorf("SetSnapshotReadIO returned %v, expected %v", err, errCannotRead)
+	}
+}
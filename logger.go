@@ -0,0 +1,159 @@
+package webcam
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	LEVEL_DEBUG Level = -4
+	LEVEL_INFO  Level = 0
+	LEVEL_WARN  Level = 4
+	LEVEL_ERROR Level = 8
+)
+
+var levelToString = map[Level]string{
+	LEVEL_DEBUG: "DEBUG",
+	LEVEL_INFO:  "INFO",
+	LEVEL_WARN:  "WARN",
+	LEVEL_ERROR: "ERROR",
+}
+
+func (l Level) String() string {
+	if name, ok := levelToString[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+func (f LoggerFunc) Log(level Level, msg string, fields ...interface{}) {
+	f(level, msg, fields...)
+}
+
+//-----------------------------------------------------------------------------
+//STANDARD LOGGER
+//-----------------------------------------------------------------------------
+
+type stdLogger struct {
+	logger *log.Logger
+	min    Level
+}
+
+func newStdLogger(logger *log.Logger, min Level) Logger {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return stdLogger{logger: logger, min: min}
+}
+
+// Log prints the record as a single line, e.g.
+// "WARN Cannot queue released buffer path=/dev/video0 index=2 error=..."
+func (l stdLogger) Log(level Level, msg string, fields ...interface{}) {
+	if level < l.min {
+		return
+	}
+
+	line := strings.Builder{}
+	line.WriteString(level.String())
+	line.WriteString(" ")
+	line.WriteString(msg)
+
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			fmt.Fprintf(&line, " %v", fields[i])
+			break
+		}
+		fmt.Fprintf(&line, " %v=%v", fields[i], fields[i+1])
+	}
+
+	l.logger.Println(line.String())
+}
+
+//-----------------------------------------------------------------------------
+//GLOBAL AND PER DEVICE LOGGERS
+//-----------------------------------------------------------------------------
+
+type nopLogger struct{}
+
+func (nopLogger) Log(level Level, msg string, fields ...interface{}) {}
+
+var globalLogger = struct {
+	sync.RWMutex
+	logger Logger
+}{logger: nopLogger{}}
+
+func setLogger(logger Logger) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+
+	globalLogger.Lock()
+	globalLogger.logger = logger
+	globalLogger.Unlock()
+}
+
+func currentLogger() Logger {
+	globalLogger.RLock()
+	defer globalLogger.RUnlock()
+
+	return globalLogger.logger
+}
+
+// logRecord logs through the global logger, for code that has no device at hand.
+func logRecord(level Level, msg string, fields ...interface{}) {
+	currentLogger().Log(level, msg, fields...)
+}
+
+// deviceLogger is kept in an atomic.Value, which needs a single concrete type.
+type deviceLogger struct {
+	Logger
+}
+
+// SetLogger sets the logger of the device, nil goes back to the global one. It
+// does not lock the device, so that records can be logged while it is locked.
+func (d *device) SetLogger(logger Logger) {
+	d.logger.Store(deviceLogger{logger})
+}
+
+// log logs a record of the device, fields are prefixed by the path and file
+// descriptor of the device.
+func (d *device) log(level Level, msg string, fields ...interface{}) {
+
+	logger := currentLogger()
+
+	if own, ok := d.logger.Load().(deviceLogger); ok && own.Logger != nil {
+		logger = own.Logger
+	}
+
+	if _, silent := logger.(nopLogger); silent {
+		return
+	}
+
+	logger.Log(level, msg, append([]interface{}{"path", d.info.Path, "fd", d.file.Fd()}, fields...)...)
+}
+
+// ioctlFailed counts a failed ioctl and logs it with its errno.
+func (d *device) ioctlFailed(op string, err error) {
+	if err == nil || err == syscall.EINTR {
+		return
+	}
+
+	d.totals.ioctlFailed(op, err)
+	d.log(LEVEL_DEBUG, "Ioctl failed", errorFields(err, "ioctl", op)...)
+}
+
+// errorFields appends the error and its errno, if it has one, to the fields.
+func errorFields(err error, fields ...interface{}) []interface{} {
+
+	var errno syscall.Errno
+
+	if errors.As(err, &errno) {
+		fields = append(fields, "errno", int(errno))
+	}
+
+	return append(fields, "error", err)
+}
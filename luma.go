@@ -0,0 +1,284 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"fmt"
+	"image"
+)
+
+//-------------------------------------------------------------------------------------
+//LUMA OF A FRAME
+//-------------------------------------------------------------------------------------
+
+// packed formats whose luma is every other byte, by the offset of the first luma byte
+var packedLumaOffsets = map[FourCC]int{
+	C.V4L2_PIX_FMT_YUYV: 0,
+	C.V4L2_PIX_FMT_YVYU: 0,
+	C.V4L2_PIX_FMT_UYVY: 1,
+	C.V4L2_PIX_FMT_VYUY: 1,
+}
+
+// lumaPlane views the luma samples of a frame in place, the sample of a pixel
+// is pix[y*stride+x*step].
+type lumaPlane struct {
+	pix    []byte
+	stride int
+	step   int
+	width  int
+	height int
+}
+
+func (l lumaPlane) at(x int, y int) int {
+	return int(l.pix[y*l.stride+x*l.step])
+}
+
+// newLumaPlane finds the luma of a snapshot of a GREY, packed 4:2:2 (YUYV, UYVY,
+// ...) or 4:2:0 (NV12, YUV420, ...) format.
+func newLumaPlane(snap Snapshot, frameSize DiscreteFrameSize) (lumaPlane, error) {
+
+	if frameSize.PixelFormat == nil {
+		return lumaPlane{}, fmt.Errorf("Frame size %dx%d has no pixel format.", frameSize.Width, frameSize.Height)
+	}
+
+	code := frameSize.PixelFormat.FourCC()
+	luma := lumaPlane{width: int(frameSize.Width), height: int(frameSize.Height), step: 1}
+
+	stride := 0
+
+	if strides := snap.Strides(); len(strides) > 0 {
+		stride = int(strides[0])
+	}
+
+	if offset, ok := packedLumaOffsets[code]; ok {
+		luma.pix = snap.Data()
+		luma.step = 2
+
+		if offset < len(luma.pix) {
+			luma.pix = luma.pix[offset:]
+		}
+
+		luma.stride = 2 * luma.width
+	} else if code == C.V4L2_PIX_FMT_GREY {
+		luma.pix = snap.Data()
+		luma.stride = luma.width
+	} else if layout, ok := yuv420Layouts[code]; ok {
+		planes, strides := splitPlanes(snap, layout, luma.width, luma.height)
+
+		if len(planes) == 0 {
+			return lumaPlane{}, fmt.Errorf("Snapshot does not contain planes of %v.", code)
+		}
+
+		luma.pix = planes[0]
+		luma.stride = strides[0]
+	} else {
+		return lumaPlane{}, fmt.Errorf("Luma of pixel format %v cannot be read.", code)
+	}
+
+	if stride > 0 {
+		luma.stride = stride
+	}
+
+	if luma.width == 0 || luma.height == 0 || len(luma.pix) < (luma.height-1)*luma.stride+(luma.width-1)*luma.step+1 {
+		return lumaPlane{}, fmt.Errorf("Luma plane of %v is too short for %dx%d.", code, luma.width, luma.height)
+	}
+
+	return luma, nil
+}
+
+// region returns the ROI clipped to the frame, the whole frame for an empty ROI.
+func (l lumaPlane) region(roi image.Rectangle) image.Rectangle {
+	frame := image.Rect(0, 0, l.width, l.height)
+
+	if roi.Empty() {
+		return frame
+	}
+
+	return roi.Intersect(frame)
+}
+
+//-------------------------------------------------------------------------------------
+//CHROMA OF A FRAME
+//-------------------------------------------------------------------------------------
+
+// packed 4:2:2 formats by the offsets of Cb and Cr within a pair of pixels
+var packedChromaOffsets = map[FourCC][2]int{
+	C.V4L2_PIX_FMT_YUYV: {1, 3},
+	C.V4L2_PIX_FMT_YVYU: {3, 1},
+	C.V4L2_PIX_FMT_UYVY: {0, 2},
+	C.V4L2_PIX_FMT_VYUY: {2, 0},
+}
+
+// chromaPlane views the chroma samples of a frame in place, the samples of a
+// pixel are at (y>>yShift)*stride+(x>>1)*step of cb and cr.
+type chromaPlane struct {
+	cb     []byte
+	cr     []byte
+	stride int
+	step   int
+	yShift uint
+}
+
+func (c chromaPlane) at(x int, y int) (int, int) {
+	i := (y>>c.yShift)*c.stride + (x>>1)*c.step
+	return int(c.cb[i]), int(c.cr[i])
+}
+
+// newChromaPlane finds the chroma of a snapshot of a packed 4:2:2 or a 4:2:0 format.
+func newChromaPlane(snap Snapshot, frameSize DiscreteFrameSize) (chromaPlane, error) {
+
+	if frameSize.PixelFormat == nil {
+		return chromaPlane{}, fmt.Errorf("Frame size %dx%d has no pixel format.", frameSize.Width, frameSize.Height)
+	}
+
+	code := frameSize.PixelFormat.FourCC()
+	width := int(frameSize.Width)
+	height := int(frameSize.Height)
+	chroma := chromaPlane{}
+
+	if offsets, ok := packedChromaOffsets[code]; ok {
+		data := snap.Data()
+		chroma.stride = 2 * width
+		chroma.step = 4
+
+		if strides := snap.Strides(); len(strides) > 0 && strides[0] > 0 {
+			chroma.stride = int(strides[0])
+		}
+
+		chroma.cb = sliceAt(data, offsets[0])[1]
+		chroma.cr = sliceAt(data, offsets[1])[1]
+	} else if layout, ok := yuv420Layouts[code]; ok {
+		planes, strides := splitPlanes(snap, layout, width, height)
+		chroma.yShift = 1
+
+		if layout.interleaved {
+			if len(planes) < 2 {
+				return chromaPlane{}, fmt.Errorf("Snapshot does not contain the chroma plane of %v.", code)
+			}
+			chroma.cb = planes[1]
+			chroma.cr = sliceAt(planes[1], 1)[1]
+			chroma.stride = strides[1]
+			chroma.step = 2
+		} else {
+			if len(planes) < 3 {
+				return chromaPlane{}, fmt.Errorf("Snapshot does not contain the chroma planes of %v.", code)
+			}
+			chroma.cb = planes[1]
+			chroma.cr = planes[2]
+			chroma.stride = strides[1]
+			chroma.step = 1
+		}
+
+		if layout.swapped {
+			chroma.cb, chroma.cr = chroma.cr, chroma.cb
+		}
+	} else {
+		return chromaPlane{}, fmt.Errorf("Chroma of pixel format %v cannot be read.", code)
+	}
+
+	last := ((height-1)>>chroma.yShift)*chroma.stride + ((width-1)>>1)*chroma.step
+
+	if width == 0 || height == 0 || last >= len(chroma.cb) || last >= len(chroma.cr) {
+		return chromaPlane{}, fmt.Errorf("Chroma of %v is too short for %dx%d.", code, width, height)
+	}
+
+	return chroma, nil
+}
+
+//-------------------------------------------------------------------------------------
+//PLANE VIEW
+//-------------------------------------------------------------------------------------
+
+type planeView struct {
+	luma      lumaPlane
+	chroma    chromaPlane
+	hasChroma bool
+}
+
+func newPlaneView(snap Snapshot, frameSize DiscreteFrameSize) (PlaneView, error) {
+
+	luma, err := newLumaPlane(snap, frameSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	view := planeView{luma: luma}
+
+	if frameSize.PixelFormat.FourCC() == C.V4L2_PIX_FMT_GREY {
+		return view, nil
+	}
+
+	if view.chroma, err = newChromaPlane(snap, frameSize); err != nil {
+		return nil, err
+	}
+
+	view.hasChroma = true
+	return view, nil
+}
+
+func (v planeView) Width() int {
+	return v.luma.width
+}
+
+func (v planeView) Height() int {
+	return v.luma.height
+}
+
+func (v planeView) Y(x int, y int) uint8 {
+	return uint8(v.luma.at(x, y))
+}
+
+func (v planeView) HasChroma() bool {
+	return v.hasChroma
+}
+
+func (v planeView) CbCr(x int, y int) (uint8, uint8) {
+	if !v.hasChroma {
+		return 128, 128
+	}
+
+	cb, cr := v.chroma.at(x, y)
+	return uint8(cb), uint8(cr)
+}
+
+func (v planeView) ChromaBlock() (int, int) {
+	return 2, 1 << v.chroma.yShift
+}
+
+//-------------------------------------------------------------------------------------
+//SHARPNESS
+//-------------------------------------------------------------------------------------
+
+// sharpness is the variance of the Laplacian of the luma over the region, pixels
+// on the border of the frame are left out as they lack neighbours.
+func sharpness(snap Snapshot, frameSize DiscreteFrameSize, roi image.Rectangle) (float64, error) {
+
+	luma, err := newLumaPlane(snap, frameSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	region := luma.region(roi).Intersect(image.Rect(1, 1, luma.width-1, luma.height-1))
+
+	if region.Empty() {
+		return 0, fmt.Errorf("Region %v leaves no pixel of the %dx%d frame to measure.", roi, luma.width, luma.height)
+	}
+
+	var sum, squares int64
+
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			laplacian := int64(4*luma.at(x, y) - luma.at(x-1, y) - luma.at(x+1, y) - luma.at(x, y-1) - luma.at(x, y+1))
+			sum += laplacian
+			squares += laplacian * laplacian
+		}
+	}
+
+	count := float64(region.Dx() * region.Dy())
+	mean := float64(sum) / count
+
+	return float64(squares)/count - mean*mean, nil
+}
@@ -0,0 +1,245 @@
+// Package metrics exposes statistics of webcams in the Prometheus text format,
+// without depending on the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jalasoft/go-webcam"
+)
+
+// CONTENT_TYPE is the content type of the Prometheus text exposition format.
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+//-----------------------------------------------------------------------------
+//EXPORTER
+//-----------------------------------------------------------------------------
+
+// Exporter collects the statistics of the webcams added to it on every scrape.
+// Every metric is labelled by the path, card and bus info of its webcam. A
+// webcam is reported as down once it is closed or its last stream failed, as
+// lost webcams do, until it is removed. Scrapes issue no ioctls. Exporter is
+// safe for concurrent use and is an http.Handler.
+type Exporter struct {
+	mu   sync.Mutex
+	cams map[string]webcam.Webcam
+}
+
+func NewExporter() *Exporter {
+	return &Exporter{cams: map[string]webcam.Webcam{}}
+}
+
+// Add exports the webcam, replacing a webcam added before with the same path.
+func (e *Exporter) Add(cam webcam.Webcam) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cams[cam.Info().Path] = cam
+}
+
+func (e *Exporter) Remove(cam webcam.Webcam) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cams[cam.Info().Path] == cam {
+		delete(e.cams, cam.Info().Path)
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+
+	if err := e.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Write collects the metrics of all the webcams and writes them in the text format.
+func (e *Exporter) Write(w io.Writer) error {
+	samples := e.collect()
+	out := bufio.NewWriter(w)
+
+	for _, family := range families {
+		fmt.Fprintf(out, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(out, "# TYPE %s %s\n", family.name, family.kind)
+
+		for _, s := range samples {
+			if s.family == family.name {
+				fmt.Fprintf(out, "%s%s %s\n", s.name, formatLabels(s.labels), s.value)
+			}
+		}
+	}
+
+	return out.Flush()
+}
+
+//-----------------------------------------------------------------------------
+//METRIC FAMILIES
+//-----------------------------------------------------------------------------
+
+type family struct {
+	name string
+	kind string
+	help string
+}
+
+var families = []family{
+	{"webcam_up", "gauge", "Whether the webcam answers queries."},
+	{"webcam_streaming", "gauge", "Whether the webcam is streaming."},
+	{"webcam_streams_total", "counter", "Streams started."},
+	{"webcam_frames_total", "counter", "Frames delivered to consumers."},
+	{"webcam_frame_bytes_total", "counter", "Bytes of frames delivered to consumers."},
+	{"webcam_dropped_frames_total", "counter", "Frames dropped by the driver or by the stream for a busy consumer."},
+	{"webcam_stream_errors_total", "counter", "Errors of streams."},
+	{"webcam_ioctl_errors_total", "counter", "Failed ioctls by request."},
+	{"webcam_fps", "gauge", "Frames per second delivered by the running stream."},
+	{"webcam_bytes_per_second", "gauge", "Bytes per second delivered by the running stream."},
+	{"webcam_latency_seconds", "gauge", "Mean time from capture to delivery of frames of the running stream."},
+	{"webcam_queued_buffers", "gauge", "Buffers owned by the driver."},
+	{"webcam_frame_size_bytes", "histogram", "Payload of delivered frames."},
+}
+
+//-----------------------------------------------------------------------------
+//COLLECTING
+//-----------------------------------------------------------------------------
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	family string
+	name   string
+	labels []label
+	value  string
+}
+
+func (e *Exporter) collect() []sample {
+	e.mu.Lock()
+	paths := make([]string, 0, len(e.cams))
+
+	for path := range e.cams {
+		paths = append(paths, path)
+	}
+
+	cams := make([]webcam.Webcam, 0, len(paths))
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		cams = append(cams, e.cams[path])
+	}
+	e.mu.Unlock()
+
+	samples := []sample{}
+
+	for _, cam := range cams {
+		samples = append(samples, collectWebcam(cam)...)
+	}
+
+	return samples
+}
+
+func collectWebcam(cam webcam.Webcam) []sample {
+
+	info := cam.Info()
+	labels := []label{{"path", info.Path}, {"card", info.Card}, {"bus_info", info.BusInfo}}
+
+	err := cam.Err()
+	stats := cam.Stats()
+	totals := cam.Totals()
+
+	result := []sample{}
+
+	add := func(name string, value string, extra ...label) {
+		result = append(result, sample{family: name, name: name, labels: append(append([]label{}, labels...), extra...), value: value})
+	}
+
+	add("webcam_up", boolValue(err == nil))
+	add("webcam_streaming", boolValue(stats.Running))
+	add("webcam_streams_total", uintValue(totals.Streams))
+	add("webcam_frames_total", uintValue(totals.Frames))
+	add("webcam_frame_bytes_total", uintValue(totals.Bytes))
+	add("webcam_dropped_frames_total", uintValue(totals.DroppedByDriver), label{"by", "driver"})
+	add("webcam_dropped_frames_total", uintValue(totals.DroppedByConsumer), label{"by", "consumer"})
+	add("webcam_stream_errors_total", uintValue(totals.Errors))
+
+	ops := make([]string, 0, len(totals.IoctlErrors))
+
+	for op := range totals.IoctlErrors {
+		ops = append(ops, op)
+	}
+
+	sort.Strings(ops)
+
+	for _, op := range ops {
+		add("webcam_ioctl_errors_total", uintValue(totals.IoctlErrors[op]), label{"op", op})
+	}
+
+	//rates of a finished stream are stale
+	if !stats.Running {
+		stats = webcam.StreamStats{}
+	}
+
+	add("webcam_fps", floatValue(stats.FPS))
+	add("webcam_bytes_per_second", floatValue(stats.BytesPerSecond))
+	add("webcam_latency_seconds", floatValue(stats.Latency.Seconds()))
+	add("webcam_queued_buffers", fmt.Sprint(stats.Queued))
+
+	//buckets of the histogram are cumulative
+	const histogram = "webcam_frame_size_bytes"
+	var count uint64
+
+	for i, bound := range webcam.FRAME_SIZE_BUCKETS {
+		count += totals.FrameSizes[i]
+		result = append(result, sample{family: histogram, name: histogram + "_bucket", labels: append(append([]label{}, labels...), label{"le", fmt.Sprint(bound)}), value: uintValue(count)})
+	}
+
+	count += totals.FrameSizes[len(webcam.FRAME_SIZE_BUCKETS)]
+	result = append(result, sample{family: histogram, name: histogram + "_bucket", labels: append(append([]label{}, labels...), label{"le", "+Inf"}), value: uintValue(count)})
+	result = append(result, sample{family: histogram, name: histogram + "_sum", labels: labels, value: uintValue(totals.Bytes)})
+	result = append(result, sample{family: histogram, name: histogram + "_count", labels: labels, value: uintValue(count)})
+
+	return result
+}
+
+//-----------------------------------------------------------------------------
+//TEXT FORMAT
+//-----------------------------------------------------------------------------
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(labels))
+
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf(`%s="%s"`, l.name, labelEscaper.Replace(l.value))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func uintValue(v uint64) string {
+	return fmt.Sprint(v)
+}
+
+func floatValue(v float64) string {
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jalasoft/go-webcam"
+)
+
+// fakeWebcam reports fixed statistics, calling anything else panics.
+type fakeWebcam struct {
+	webcam.Webcam
+
+	info   webcam.WebcamInfo
+	err    error
+	stats  webcam.StreamStats
+	totals webcam.StreamTotals
+}
+
+func (c *fakeWebcam) Info() webcam.WebcamInfo     { return c.info }
+func (c *fakeWebcam) Err() error                  { return c.err }
+func (c *fakeWebcam) Stats() webcam.StreamStats   { return c.stats }
+func (c *fakeWebcam) Totals() webcam.StreamTotals { return c.totals }
+
+func newFakeWebcam(path string) *fakeWebcam {
+	return &fakeWebcam{
+		info:   webcam.WebcamInfo{Path: path, Card: "Camera", BusInfo: "usb-1"},
+		totals: webcam.StreamTotals{FrameSizes: make([]uint64, len(webcam.FRAME_SIZE_BUCKETS)+1)},
+	}
+}
+
+func export(t *testing.T, cams ...webcam.Webcam) string {
+	t.Helper()
+
+	e := NewExporter()
+
+	for _, cam := range cams {
+		e.Add(cam)
+	}
+
+	out := bytes.Buffer{}
+
+	if err := e.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.String()
+}
+
+func assertLines(t *testing.T, text string, expected ...string) {
+	t.Helper()
+
+	lines := map[string]bool{}
+	for _, line := range strings.Split(text, "\n") {
+		lines[line] = true
+	}
+
+	for _, line := range expected {
+		if !lines[line] {
+			t.Errorf("Missing line %q in:\n%s", line, text)
+		}
+	}
+}
+
+func TestWriteDescribesFamilies(t *testing.T) {
+	text := export(t, newFakeWebcam("/dev/video0"))
+	lines := strings.Split(text, "\n")
+
+	//every family starts with its HELP and TYPE, followed by its samples only
+	for _, family := range families {
+		index := -1
+
+		for i, line := range lines {
+			if line == "# HELP "+family.name+" "+family.help {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 || index+1 >= len(lines) || lines[index+1] != "# TYPE "+family.name+" "+family.kind {
+			t.Errorf("Family %s is not described by HELP and TYPE", family.name)
+			continue
+		}
+
+		for _, line := range lines[index+2:] {
+			if line == "" || strings.HasPrefix(line, "#") {
+				break
+			}
+
+			if !strings.HasPrefix(line, family.name) {
+				t.Errorf("Sample %q is listed under family %s", line, family.name)
+			}
+		}
+	}
+
+	assertLines(t, text,
+		"# HELP webcam_up Whether the webcam answers queries.",
+		"# TYPE webcam_up gauge",
+		"# TYPE webcam_frames_total counter",
+		"# TYPE webcam_frame_size_bytes histogram",
+	)
+}
+
+func TestWriteEscapesLabels(t *testing.T) {
+	cam := newFakeWebcam("/dev/video0")
+	cam.info.Card = "Cam \"A\"\\B\nC"
+
+	assertLines(t, export(t, cam), `webcam_up{path="/dev/video0",card="Cam \"A\"\\B\nC",bus_info="usb-1"} 1`)
+}
+
+func TestWriteSamples(t *testing.T) {
+	running := newFakeWebcam("/dev/video0")
+	running.stats = webcam.StreamStats{Running: true, FPS: 30, BytesPerSecond: 1500, Latency: 20 * time.Millisecond, Queued: 3}
+	running.totals.Streams = 2
+	running.totals.Frames = 10
+	running.totals.DroppedByDriver = 4
+	running.totals.DroppedByConsumer = 1
+	running.totals.IoctlErrors = map[string]uint64{"DQBUF": 5}
+
+	lost := newFakeWebcam("/dev/video1")
+	lost.err = syscall.ENODEV
+	lost.stats = webcam.StreamStats{FPS: 30, Queued: 3}
+
+	text := export(t, running, lost)
+	labels := `path="/dev/video0",card="Camera",bus_info="usb-1"`
+	lostLabels := `path="/dev/video1",card="Camera",bus_info="usb-1"`
+
+	assertLines(t, text,
+		"webcam_up{"+labels+"} 1",
+		"webcam_streaming{"+labels+"} 1",
+		"webcam_streams_total{"+labels+"} 2",
+		"webcam_frames_total{"+labels+"} 10",
+		"webcam_dropped_frames_total{"+labels+`,by="driver"} 4`,
+		"webcam_dropped_frames_total{"+labels+`,by="consumer"} 1`,
+		"webcam_ioctl_errors_total{"+labels+`,op="DQBUF"} 5`,
+		"webcam_fps{"+labels+"} 30",
+		"webcam_latency_seconds{"+labels+"} 0.02",
+		"webcam_queued_buffers{"+labels+"} 3",
+		//rates of a stream that is not running are not reported
+		"webcam_up{"+lostLabels+"} 0",
+		"webcam_fps{"+lostLabels+"} 0",
+		"webcam_queued_buffers{"+lostLabels+"} 0",
+	)
+}
+
+func TestWriteCumulativeHistogram(t *testing.T) {
+	cam := newFakeWebcam("/dev/video0")
+	cam.totals.Bytes = 123456
+	cam.totals.FrameSizes = []uint64{1, 2, 0, 3, 0, 0, 4}
+
+	labels := `path="/dev/video0",card="Camera",bus_info="usb-1"`
+
+	assertLines(t, export(t, cam),
+		"webcam_frame_size_bytes_bucket{"+labels+`,le="16384"} 1`,
+		"webcam_frame_size_bytes_bucket{"+labels+`,le="65536"} 3`,
+		"webcam_frame_size_bytes_bucket{"+labels+`,le="262144"} 3`,
+		"webcam_frame_size_bytes_bucket{"+labels+`,le="1048576"} 6`,
+		"webcam_frame_size_bytes_bucket{"+labels+`,le="4194304"} 6`,
+		"webcam_frame_size_bytes_bucket{"+labels+`,le="16777216"} 6`,
+		"webcam_frame_size_bytes_bucket{"+labels+`,le="+Inf"} 10`,
+		"webcam_frame_size_bytes_sum{"+labels+"} 123456",
+		"webcam_frame_size_bytes_count{"+labels+"} 10",
+	)
+}
+
+func TestServeHTTP(t *testing.T) {
+	e := NewExporter()
+	cam := newFakeWebcam("/dev/video0")
+	e.Add(cam)
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != CONTENT_TYPE {
+		t.Errorf("Content type is %q", contentType)
+	}
+
+	assertLines(t, recorder.Body.String(), `webcam_up{path="/dev/video0",card="Camera",bus_info="usb-1"} 1`)
+
+	//a removed webcam is not reported anymore
+	e.Remove(cam)
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if strings.Contains(recorder.Body.String(), "/dev/video0") {
+		t.Errorf("Removed webcam is still reported")
+	}
+}
@@ -0,0 +1,32 @@
+package webcam
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestCombinedErrorsAreFound(t *testing.T) {
+	err := combineErrors(syscall.EIO, nil, combineErrors(&os.PathError{Op: "open", Path: "/dev/video0", Err: syscall.ENODEV}, syscall.EBUSY))
+
+	for _, expected := range []error{syscall.EIO, syscall.ENODEV, syscall.EBUSY} {
+		if !errors.Is(err, expected) {
+			t.Errorf("Error %v does not contain %v", err, expected)
+		}
+	}
+
+	if errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Error %v contains %v", err, syscall.EINVAL)
+	}
+
+	var pathErr *os.PathError
+
+	if !errors.As(err, &pathErr) || pathErr.Path != "/dev/video0" {
+		t.Errorf("Error %v does not contain the path error", err)
+	}
+
+	if m, ok := err.(multiError); !ok || len(m) != 3 {
+		t.Errorf("Error %v is not flattened into three errors", err)
+	}
+}
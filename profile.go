@@ -0,0 +1,540 @@
+package webcam
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// controls switching automatic modes, they are applied before any other control
+// so that manual values are not refused by a driver still in an automatic mode
+var autoControls = map[ControlID]bool{
+	CID_EXPOSURE_AUTO:               true,
+	CID_EXPOSURE_AUTO_PRIORITY:      true,
+	CID_AUTO_WHITE_BALANCE:          true,
+	CID_AUTO_N_PRESET_WHITE_BALANCE: true,
+	CID_AUTOGAIN:                    true,
+	CID_AUTOBRIGHTNESS:              true,
+	CID_HUE_AUTO:                    true,
+	CID_FOCUS_AUTO:                  true,
+}
+
+func loadProfile(path string) (Profile, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return Profile{}, err
+	}
+
+	profile := Profile{}
+
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return Profile{}, fmt.Errorf("Cannot read profile %s: %v", path, err)
+	}
+
+	return profile, nil
+}
+
+//--------------------------------------------------------------------------------------
+//PROFILE REPORT
+//--------------------------------------------------------------------------------------
+
+func (r ProfileReport) Rejected() []ProfileFieldReport {
+	result := []ProfileFieldReport{}
+	for _, f := range r.Fields {
+		if f.Status == Rejected {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func (r *ProfileReport) add(field string, requested string, applied string, status ProfileStatus, reason string) {
+	r.Fields = append(r.Fields, ProfileFieldReport{Field: field, Requested: requested, Applied: applied, Status: status, Reason: reason})
+}
+
+//--------------------------------------------------------------------------------------
+//APPLYING PROFILE
+//--------------------------------------------------------------------------------------
+
+func (d *device) ApplyProfile(p Profile) (ProfileReport, error) {
+
+	report := ProfileReport{Fields: []ProfileFieldReport{}}
+
+	if p.PixelFormat != "" || p.Width != 0 || p.Height != 0 || p.FrameRate != 0 {
+		if err := d.applyProfileFormat(p, &report); err != nil {
+			return report, err
+		}
+	}
+
+	if err := d.applyProfileControls(p, &report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+func (d *device) applyProfileFormat(p Profile, report *ProfileReport) error {
+
+	current, err := d.CurrentFrameSize()
+
+	if err != nil {
+		return err
+	}
+
+	format := current.PixelFormat
+
+	if p.PixelFormat != "" {
+		formats, err := d.QueryFormats()
+
+		if err != nil {
+			return err
+		}
+
+		format = findFormatByName(formats, p.PixelFormat)
+
+		if format == nil {
+			rejectFormatFields(p, report, "pixel format is not supported")
+			return nil
+		}
+	}
+
+	sizes, err := d.QueryFrameSizes(format)
+
+	if err != nil {
+		return err
+	}
+
+	width, height := p.Width, p.Height
+
+	if width == 0 && height == 0 && format.Name() == current.PixelFormat.Name() {
+		width, height = current.Width, current.Height
+	}
+
+	frameSize, status, ok := fitFrameSize(sizes, width, height)
+
+	if !ok {
+		rejectFormatFields(p, report, "pixel format has no frame sizes")
+		return nil
+	}
+
+	frameSize.PixelFormat = format
+
+	if err := d.configure(frameSize); err != nil {
+		if err != ErrBusyStreaming {
+			return err
+		}
+
+		rejectFormatFields(p, report, err.Error())
+		return nil
+	}
+
+	if p.PixelFormat != "" {
+		report.add("pixel_format", p.PixelFormat, format.Name(), Applied, "")
+	}
+
+	if p.Width != 0 || p.Height != 0 {
+		report.add("size", sizeString(p.Width, p.Height), sizeString(frameSize.Width, frameSize.Height), status, "")
+	}
+
+	if p.FrameRate != 0 {
+		return d.applyProfileFrameRate(frameSize, p.FrameRate, report)
+	}
+
+	return nil
+}
+
+func rejectFormatFields(p Profile, report *ProfileReport, reason string) {
+	if p.PixelFormat != "" {
+		report.add("pixel_format", p.PixelFormat, "", Rejected, reason)
+	}
+
+	if p.Width != 0 || p.Height != 0 {
+		report.add("size", sizeString(p.Width, p.Height), "", Rejected, reason)
+	}
+
+	if p.FrameRate != 0 {
+		report.add("frame_rate", fpsString(p.FrameRate), "", Rejected, reason)
+	}
+}
+
+func (d *device) applyProfileFrameRate(frameSize DiscreteFrameSize, fps float64, report *ProfileReport) error {
+
+	intervals, err := d.QueryFrameIntervals(frameSize)
+
+	if err != nil {
+		return err
+	}
+
+	interval, ok := fitFrameInterval(intervals, fps)
+
+	if !ok {
+		report.add("frame_rate", fpsString(fps), "", Rejected, "frame rate is not positive")
+		return nil
+	}
+
+	actual, err := d.SetFrameInterval(interval)
+
+	if err != nil {
+		report.add("frame_rate", fpsString(fps), "", Rejected, err.Error())
+		return nil
+	}
+
+	status := Applied
+	if math.Abs(actual.FPS()-fps) > 0.01 {
+		status = Clamped
+	}
+
+	report.add("frame_rate", fpsString(fps), fpsString(actual.FPS()), status, "")
+	return nil
+}
+
+// configure sets the frame size without capturing anything.
+func (d *device) configure(frameSize DiscreteFrameSize) error {
+
+	if err := d.lock(true); err != nil {
+		return err
+	}
+
+	defer d.mu.Unlock()
+
+	layout, err := setFrameSize(d, &frameSize)
+
+	if err != nil {
+		return err
+	}
+
+	d.state = stateConfigured
+	d.layout = layout
+	return nil
+}
+
+func (d *device) applyProfileControls(p Profile, report *ProfileReport) error {
+
+	if len(p.Controls) == 0 {
+		return nil
+	}
+
+	controls, err := d.QueryControls()
+
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(p.Controls))
+	for name := range p.Controls {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		autoI := isAutoControl(controls, names[i])
+		autoJ := isAutoControl(controls, names[j])
+
+		if autoI != autoJ {
+			return autoI
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		requested := p.Controls[name]
+		field := "control:" + name
+
+		control, ok := findControlByName(controls, name)
+
+		if !ok {
+			report.add(field, fmt.Sprint(requested), "", Rejected, "unknown control")
+			continue
+		}
+
+		if control.ReadOnly() {
+			report.add(field, fmt.Sprint(requested), "", Rejected, "control is read-only")
+			continue
+		}
+
+		value, status, reason := fitControlValue(control, requested)
+
+		if status == Rejected {
+			report.add(field, fmt.Sprint(requested), "", Rejected, reason)
+			continue
+		}
+
+		if err := d.SetControl(control.ID, value); err != nil {
+			if err == ErrDeviceClosed {
+				return err
+			}
+
+			report.add(field, fmt.Sprint(requested), "", Rejected, err.Error())
+			continue
+		}
+
+		report.add(field, fmt.Sprint(requested), fmt.Sprint(value), status, "")
+	}
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------------
+//CAPTURING PROFILE
+//--------------------------------------------------------------------------------------
+
+func (d *device) CaptureProfile() (Profile, error) {
+
+	current, err := d.CurrentFrameSize()
+
+	if err != nil {
+		return Profile{}, err
+	}
+
+	profile := Profile{
+		PixelFormat: current.PixelFormat.Name(),
+		Width:       current.Width,
+		Height:      current.Height,
+	}
+
+	if interval, err := d.FrameInterval(); err == nil && interval.Numerator != 0 {
+		profile.FrameRate = interval.FPS()
+	}
+
+	controls, err := d.QueryControls()
+
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if profile.Controls, err = captureControls(controls, d.GetControl, d.log); err != nil {
+		return Profile{}, err
+	}
+
+	return profile, nil
+}
+
+// captureControls reads the values of the controls a profile is able to restore.
+// Controls that cannot be read are left out, some drivers refuse to read controls
+// they announce.
+func captureControls(controls []Control, get func(ControlID) (int32, error), log func(Level, string, ...interface{})) (map[string]int32, error) {
+
+	result := map[string]int32{}
+
+	for _, control := range controls {
+		if control.ReadOnly() || control.WriteOnly() || control.Inactive() {
+			continue
+		}
+
+		switch control.Type {
+		case CTRL_TYPE_INTEGER, CTRL_TYPE_BOOLEAN, CTRL_TYPE_MENU, CTRL_TYPE_INTEGER_MENU:
+		default:
+			continue
+		}
+
+		value, err := get(control.ID)
+
+		if err == ErrDeviceClosed {
+			return nil, err
+		}
+
+		if err != nil {
+			log(LEVEL_WARN, "Cannot read control, it is left out of the profile", errorFields(err, "control", control.Name)...)
+			continue
+		}
+
+		result[controlKey(control)] = value
+	}
+
+	return result, nil
+}
+
+//--------------------------------------------------------------------------------------
+//MATCHING AND CLAMPING
+//--------------------------------------------------------------------------------------
+
+func findFormatByName(formats []PixelFormat, name string) PixelFormat {
+	for _, f := range formats {
+		if matchesFormatName(f, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// fitFrameSize finds the supported frame size closest to the requested one, zero
+// width or height matches any.
+func fitFrameSize(sizes FrameSizes, width uint32, height uint32) (DiscreteFrameSize, ProfileStatus, bool) {
+
+	for _, s := range sizes.Stepwise() {
+		w := fitStep(width, s.MinWidth, s.MaxWidth, s.StepWidth)
+		h := fitStep(height, s.MinHeight, s.MaxHeight, s.StepHeight)
+
+		status := Applied
+		if (width != 0 && w != width) || (height != 0 && h != height) {
+			status = Clamped
+		}
+
+		return DiscreteFrameSize{Width: w, Height: h}, status, true
+	}
+
+	best := DiscreteFrameSize{}
+	bestDiff := math.MaxFloat64
+
+	for _, size := range sizes.Discrete() {
+		diff := float64(0)
+
+		if width != 0 {
+			diff += math.Abs(float64(width) - float64(size.Width))
+		}
+
+		if height != 0 {
+			diff += math.Abs(float64(height) - float64(size.Height))
+		}
+
+		if diff < bestDiff {
+			best = size
+			bestDiff = diff
+		}
+	}
+
+	if bestDiff == math.MaxFloat64 {
+		return DiscreteFrameSize{}, Rejected, false
+	}
+
+	if bestDiff == 0 {
+		return best, Applied, true
+	}
+
+	return best, Clamped, true
+}
+
+func fitStep(value uint32, min uint32, max uint32, step uint32) uint32 {
+	if value == 0 || value <= min {
+		return min
+	}
+
+	if value >= max {
+		return max
+	}
+
+	if step <= 1 {
+		return value
+	}
+
+	steps := uint32(math.Round(float64(value-min) / float64(step)))
+	result := min + steps*step
+
+	if result > max {
+		result -= step
+	}
+
+	return result
+}
+
+// fitFrameInterval picks the supported frame interval closest to the frame rate,
+// which must be positive.
+func fitFrameInterval(intervals FrameIntervals, fps float64) (Fraction, bool) {
+
+	if fps <= 0 || math.IsNaN(fps) {
+		return Fraction{}, false
+	}
+
+	requested := Fraction{Numerator: 1000, Denominator: uint32(math.Round(fps * 1000))}
+
+	//the shortest interval of a range means the highest frame rate
+	for _, s := range intervals.Stepwise() {
+		if fps > s.Min.FPS() {
+			return s.Min, true
+		}
+
+		if fps < s.Max.FPS() {
+			return s.Max, true
+		}
+
+		return requested, true
+	}
+
+	best := requested
+	bestDiff := math.MaxFloat64
+
+	for _, interval := range intervals.Discrete() {
+		if diff := math.Abs(interval.FPS() - fps); diff < bestDiff {
+			best = interval
+			bestDiff = diff
+		}
+	}
+
+	return best, true
+}
+
+func fitControlValue(control Control, value int32) (int32, ProfileStatus, string) {
+
+	switch control.Type {
+	case CTRL_TYPE_MENU, CTRL_TYPE_INTEGER_MENU:
+		for _, item := range control.Menu {
+			if int64(item.Index) == int64(value) {
+				return value, Applied, ""
+			}
+		}
+		return 0, Rejected, "value is not an item of the menu"
+
+	case CTRL_TYPE_BUTTON:
+		return value, Applied, ""
+
+	case CTRL_TYPE_INTEGER, CTRL_TYPE_BOOLEAN:
+		fitted := int64(value)
+
+		if fitted < control.Minimum {
+			fitted = control.Minimum
+		}
+
+		if fitted > control.Maximum {
+			fitted = control.Maximum
+		}
+
+		if control.Step > 1 {
+			steps := math.Round(float64(fitted-control.Minimum) / float64(control.Step))
+			fitted = control.Minimum + int64(steps)*int64(control.Step)
+
+			if fitted > control.Maximum {
+				fitted -= int64(control.Step)
+			}
+		}
+
+		if fitted != int64(value) {
+			return int32(fitted), Clamped, ""
+		}
+		return value, Applied, ""
+
+	default:
+		return 0, Rejected, fmt.Sprintf("controls of type %v cannot be set by a profile", control.Type)
+	}
+}
+
+func findControlByName(controls []Control, name string) (Control, bool) {
+	for _, c := range controls {
+		if controlIDToString[c.ID] == name || strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return Control{}, false
+}
+
+func isAutoControl(controls []Control, name string) bool {
+	control, ok := findControlByName(controls, name)
+	return ok && autoControls[control.ID]
+}
+
+func controlKey(control Control) string {
+	if name, ok := controlIDToString[control.ID]; ok {
+		return name
+	}
+	return control.Name
+}
+
+func sizeString(width uint32, height uint32) string {
+	return fmt.Sprintf("%dx%d", width, height)
+}
+
+func fpsString(fps float64) string {
+	return fmt.Sprintf("%.2f", fps)
+}
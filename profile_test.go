@@ -0,0 +1,144 @@
+package webcam
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestFitFrameSize(t *testing.T) {
+	discrete := frameSizes{discrete: []DiscreteFrameSize{{Width: 640, Height: 480}, {Width: 1280, Height: 720}}}
+	stepwise := frameSizes{stepwise: []StepwiseFrameSize{{MinWidth: 160, MaxWidth: 1920, StepWidth: 16, MinHeight: 120, MaxHeight: 1080, StepHeight: 8}}}
+
+	for _, c := range []struct {
+		name          string
+		sizes         FrameSizes
+		width, height uint32
+		expected      DiscreteFrameSize
+		status        ProfileStatus
+		ok            bool
+	}{
+		{"discrete exact", discrete, 1280, 720, DiscreteFrameSize{Width: 1280, Height: 720}, Applied, true},
+		{"discrete closest", discrete, 1200, 700, DiscreteFrameSize{Width: 1280, Height: 720}, Clamped, true},
+		{"discrete width only", discrete, 600, 0, DiscreteFrameSize{Width: 640, Height: 480}, Clamped, true},
+		{"discrete any", discrete, 0, 0, DiscreteFrameSize{Width: 640, Height: 480}, Applied, true},
+		{"stepwise exact", stepwise, 800, 600, DiscreteFrameSize{Width: 800, Height: 600}, Applied, true},
+		{"stepwise rounded to steps", stepwise, 1000, 500, DiscreteFrameSize{Width: 1008, Height: 504}, Clamped, true},
+		{"stepwise out of range", stepwise, 3000, 50, DiscreteFrameSize{Width: 1920, Height: 120}, Clamped, true},
+		{"stepwise any", stepwise, 0, 0, DiscreteFrameSize{Width: 160, Height: 120}, Applied, true},
+		{"no sizes", frameSizes{}, 640, 480, DiscreteFrameSize{}, Rejected, false},
+	} {
+		size, status, ok := fitFrameSize(c.sizes, c.width, c.height)
+
+		if size != c.expected || status != c.status || ok != c.ok {
+			t.Errorf("%s: got %dx%d, %v, %v, expected %dx%d, %v, %v", c.name, size.Width, size.Height, status, ok, c.expected.Width, c.expected.Height, c.status, c.ok)
+		}
+	}
+}
+
+func TestFitFrameInterval(t *testing.T) {
+	discrete := frameIntervals{discrete: []Fraction{{1, 30}, {1, 15}}}
+	stepwise := frameIntervals{stepwise: []StepwiseFrameInterval{{Min: Fraction{1, 60}, Max: Fraction{1, 5}, Step: Fraction{1, 1}}}}
+
+	for _, c := range []struct {
+		name      string
+		intervals FrameIntervals
+		fps       float64
+		expected  Fraction
+		ok        bool
+	}{
+		{"discrete closest", discrete, 25, Fraction{1, 30}, true},
+		{"discrete slower", discrete, 10, Fraction{1, 15}, true},
+		{"stepwise within", stepwise, 24, Fraction{1000, 24000}, true},
+		{"stepwise above", stepwise, 100, Fraction{1, 60}, true},
+		{"stepwise below", stepwise, 2, Fraction{1, 5}, true},
+		{"zero", discrete, 0, Fraction{}, false},
+		{"negative", stepwise, -5, Fraction{}, false},
+	} {
+		interval, ok := fitFrameInterval(c.intervals, c.fps)
+
+		if interval != c.expected || ok != c.ok {
+			t.Errorf("%s: got %v, %v, expected %v, %v", c.name, interval, ok, c.expected, c.ok)
+		}
+	}
+}
+
+func TestFitControlValue(t *testing.T) {
+	integer := Control{Name: "Brightness", Type: CTRL_TYPE_INTEGER, Minimum: -10, Maximum: 10, Step: 5}
+	overshooting := Control{Name: "Zoom", Type: CTRL_TYPE_INTEGER, Minimum: 0, Maximum: 10, Step: 4}
+	menu := Control{Name: "Power Line Frequency", Type: CTRL_TYPE_MENU, Maximum: 2, Menu: []ControlMenuItem{{Index: 0, Name: "Disabled"}, {Index: 2, Name: "60 Hz"}}}
+
+	for _, c := range []struct {
+		name     string
+		control  Control
+		value    int32
+		expected int32
+		status   ProfileStatus
+	}{
+		{"integer exact", integer, 10, 10, Applied},
+		{"integer above", integer, 20, 10, Clamped},
+		{"integer below", integer, -12, -10, Clamped},
+		{"integer between steps", integer, 3, 5, Clamped},
+		{"step beyond maximum", overshooting, 10, 8, Clamped},
+		{"menu item", menu, 2, 2, Applied},
+		{"not a menu item", menu, 1, 0, Rejected},
+		{"button", Control{Type: CTRL_TYPE_BUTTON}, 1, 1, Applied},
+		{"string", Control{Type: CTRL_TYPE_STRING}, 1, 0, Rejected},
+	} {
+		value, status, reason := fitControlValue(c.control, c.value)
+
+		if value != c.expected || status != c.status {
+			t.Errorf("%s: got %d, %v, expected %d, %v", c.name, value, status, c.expected, c.status)
+		}
+
+		if (status == Rejected) != (reason != "") {
+			t.Errorf("%s: status %v comes with reason %q", c.name, status, reason)
+		}
+	}
+}
+
+func TestCaptureControlsSkipsUnreadable(t *testing.T) {
+	cam := newFakeControlCam(
+		Control{ID: CID_BRIGHTNESS, Name: "Brightness", Type: CTRL_TYPE_INTEGER, Maximum: 255, Default: 128},
+		//read-only, write-only and inactive
+		Control{ID: CID_CONTRAST, Name: "Contrast", Type: CTRL_TYPE_INTEGER, Maximum: 255, Flags: 0x4},
+		Control{ID: CID_SATURATION, Name: "Saturation", Type: CTRL_TYPE_INTEGER, Maximum: 255, Flags: 0x40},
+		Control{ID: CID_SHARPNESS, Name: "Sharpness", Type: CTRL_TYPE_INTEGER, Maximum: 255, Flags: 0x10},
+		Control{ID: CID_GAIN, Name: "Gain", Type: CTRL_TYPE_INTEGER, Maximum: 255},
+	)
+	failures := map[ControlID]error{CID_GAIN: syscall.EIO}
+
+	get := func(id ControlID) (int32, error) {
+		if err := failures[id]; err != nil {
+			return 0, err
+		}
+		return cam.GetControl(id)
+	}
+
+	warnings := 0
+	log := func(level Level, msg string, fields ...interface{}) {
+		if level == LEVEL_WARN {
+			warnings++
+		}
+	}
+
+	controls, err := captureControls(cam.controls, get, log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(controls) != 1 || controls["V4L2_CID_BRIGHTNESS"] != 128 {
+		t.Errorf("Captured %v, expected the brightness only", controls)
+	}
+
+	if warnings != 1 {
+		t.Errorf("Logged %d warnings, expected one about the gain", warnings)
+	}
+
+	//a closed device has nothing more to read
+	failures[CID_BRIGHTNESS] = ErrDeviceClosed
+
+	if _, err := captureControls(cam.controls, get, log); err != ErrDeviceClosed {
+		t.Errorf("Capturing a closed device returned %v", err)
+	}
+}
@@ -0,0 +1,501 @@
+package webcam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	PAN PTZAxis = iota
+	TILT
+	ZOOM
+)
+
+var ptzAxisToString = map[PTZAxis]string{
+	PAN:  "pan",
+	TILT: "tilt",
+	ZOOM: "zoom",
+}
+
+func (a PTZAxis) String() string {
+	if name, ok := ptzAxisToString[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("PTZAxis(%d)", int(a))
+}
+
+// controls of every axis
+var ptzControls = map[PTZAxis]struct {
+	absolute ControlID
+	relative ControlID
+	speed    ControlID
+}{
+	PAN:  {CID_PAN_ABSOLUTE, CID_PAN_RELATIVE, CID_PAN_SPEED},
+	TILT: {CID_TILT_ABSOLUTE, CID_TILT_RELATIVE, CID_TILT_SPEED},
+	ZOOM: {CID_ZOOM_ABSOLUTE, CID_ZOOM_RELATIVE, CID_ZOOM_CONTINUOUS},
+}
+
+// how often a smooth move sets the position
+const ptzSmoothInterval = 50 * time.Millisecond
+
+func (p PTZPosition) String() string {
+	return fmt.Sprintf("PTZPosition[pan=%s,tilt=%s,zoom=%s]", p.format(PAN), p.format(TILT), p.format(ZOOM))
+}
+
+// With returns the position with the axis moved to the value.
+func (p PTZPosition) With(axis PTZAxis, value int32) PTZPosition {
+	p.set(axis, value)
+	return p
+}
+
+func (p PTZPosition) format(axis PTZAxis) string {
+	if value, ok := p.get(axis); ok {
+		return fmt.Sprint(value)
+	}
+	return "-"
+}
+
+// get returns the value of the axis, false when the axis keeps its position.
+func (p PTZPosition) get(axis PTZAxis) (int32, bool) {
+	var value *int32
+
+	switch axis {
+	case PAN:
+		value = p.Pan
+	case TILT:
+		value = p.Tilt
+	default:
+		value = p.Zoom
+	}
+
+	if value == nil {
+		return 0, false
+	}
+
+	return *value, true
+}
+
+// set points the axis to a value of its own, so that copies of the position
+// never share it.
+func (p *PTZPosition) set(axis PTZAxis, value int32) {
+	switch axis {
+	case PAN:
+		p.Pan = &value
+	case TILT:
+		p.Tilt = &value
+	default:
+		p.Zoom = &value
+	}
+}
+
+//-----------------------------------------------------------------------------
+//PTZ IMPL
+//-----------------------------------------------------------------------------
+
+type ptz struct {
+	cam  Webcam
+	axes map[PTZAxis]PTZAxisInfo
+
+	mu      sync.Mutex
+	presets map[string]PTZPosition
+	//closed to cancel the running smooth move, nil when none runs
+	cancel chan struct{}
+
+	//held by every move while it sets controls, so that a cancelled smooth
+	//move cannot overwrite the position set by the move that cancelled it
+	move sync.Mutex
+}
+
+func newPTZ(cam Webcam) (PTZ, error) {
+
+	controls, err := cam.QueryControls()
+
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[ControlID]Control{}
+
+	for _, control := range controls {
+		byID[control.ID] = control
+	}
+
+	result := &ptz{cam: cam, axes: map[PTZAxis]PTZAxisInfo{}, presets: map[string]PTZPosition{}}
+
+	for axis, ids := range ptzControls {
+		info := PTZAxisInfo{Axis: axis}
+
+		if control, ok := byID[ids.absolute]; ok {
+			info.Absolute = &control
+		}
+
+		if control, ok := byID[ids.relative]; ok {
+			info.Relative = &control
+		}
+
+		if control, ok := byID[ids.speed]; ok {
+			info.Speed = &control
+		}
+
+		if info.Absolute != nil || info.Relative != nil || info.Speed != nil {
+			result.axes[axis] = info
+		}
+	}
+
+	if len(result.axes) == 0 {
+		return nil, fmt.Errorf("Device %s has no pan, tilt or zoom control.", cam.Info().Path)
+	}
+
+	return result, nil
+}
+
+func (p *ptz) Axes() []PTZAxisInfo {
+	result := []PTZAxisInfo{}
+
+	for _, info := range p.axes {
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Axis < result[j].Axis })
+	return result
+}
+
+func (p *ptz) Position() (PTZPosition, error) {
+	position := PTZPosition{}
+
+	for axis, info := range p.axes {
+		if info.Absolute == nil {
+			continue
+		}
+
+		value, err := p.cam.GetControl(info.Absolute.ID)
+
+		if err != nil {
+			return PTZPosition{}, fmt.Errorf("Cannot read %v position: %w", axis, err)
+		}
+
+		position.set(axis, value)
+	}
+
+	return position, nil
+}
+
+//-----------------------------------------------------------------------------
+//MOVES
+//-----------------------------------------------------------------------------
+
+func (p *ptz) MoveAbsolute(position PTZPosition) error {
+	p.stopSmooth()
+
+	p.move.Lock()
+	defer p.move.Unlock()
+
+	return p.setPosition(position)
+}
+
+// setPosition moves every axis of the position with an absolute control,
+// positions are clamped to the ranges of the axes.
+func (p *ptz) setPosition(position PTZPosition) error {
+	for axis, info := range p.axes {
+		target, ok := position.get(axis)
+
+		if !ok || info.Absolute == nil {
+			continue
+		}
+
+		value, _, _ := fitControlValue(*info.Absolute, target)
+
+		if err := p.cam.SetControl(info.Absolute.ID, value); err != nil {
+			return fmt.Errorf("Cannot move %v to %d: %w", axis, value, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *ptz) MoveRelative(axis PTZAxis, delta int32) error {
+
+	info, ok := p.axes[axis]
+
+	if !ok {
+		return fmt.Errorf("Webcam cannot move %v.", axis)
+	}
+
+	p.stopSmooth()
+
+	p.move.Lock()
+	defer p.move.Unlock()
+
+	if info.Relative != nil {
+		return p.cam.SetControl(info.Relative.ID, delta)
+	}
+
+	if info.Absolute == nil {
+		return fmt.Errorf("Webcam cannot move %v by a distance.", axis)
+	}
+
+	//without a relative control the axis is moved from its current position
+	current, err := p.cam.GetControl(info.Absolute.ID)
+
+	if err != nil {
+		return err
+	}
+
+	value, _, _ := fitControlValue(*info.Absolute, current+delta)
+	return p.cam.SetControl(info.Absolute.ID, value)
+}
+
+func (p *ptz) MoveContinuous(axis PTZAxis, speed int32) error {
+
+	info, ok := p.axes[axis]
+
+	if !ok || info.Speed == nil {
+		return fmt.Errorf("Webcam cannot move %v continuously.", axis)
+	}
+
+	p.stopSmooth()
+
+	p.move.Lock()
+	defer p.move.Unlock()
+
+	value, _, _ := fitControlValue(*info.Speed, speed)
+	return p.cam.SetControl(info.Speed.ID, value)
+}
+
+func (p *ptz) MoveSmooth(position PTZPosition, duration time.Duration) error {
+
+	start, err := p.Position()
+
+	if err != nil {
+		return err
+	}
+
+	cancel := p.startSmooth()
+	defer p.finishSmooth(cancel)
+
+	started := time.Now()
+	ticker := time.NewTicker(ptzSmoothInterval)
+	defer ticker.Stop()
+
+	for {
+		progress := 1.0
+
+		if duration > 0 {
+			progress = float64(time.Since(started)) / float64(duration)
+		}
+
+		target := position
+
+		if progress < 1 {
+			target = interpolate(start, position, progress)
+		}
+
+		if moved, err := p.smoothStep(target, cancel); !moved || err != nil || progress >= 1 {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-cancel:
+			return nil
+		}
+	}
+}
+
+// smoothStep sets a position of a smooth move unless the move has been cancelled,
+// which is checked under the move lock.
+func (p *ptz) smoothStep(position PTZPosition, cancel chan struct{}) (bool, error) {
+	p.move.Lock()
+	defer p.move.Unlock()
+
+	select {
+	case <-cancel:
+		return false, nil
+	default:
+	}
+
+	return true, p.setPosition(position)
+}
+
+// interpolate returns the position at the given progress between 0 and 1 of the
+// way from the start to the end. Axes missing in the end keep their position,
+// those missing in the start jump to the end.
+func interpolate(start PTZPosition, end PTZPosition, progress float64) PTZPosition {
+	result := PTZPosition{}
+
+	for axis := range ptzControls {
+		to, ok := end.get(axis)
+
+		if !ok {
+			continue
+		}
+
+		from, ok := start.get(axis)
+
+		if !ok {
+			from = to
+		}
+
+		result.set(axis, int32(float64(from)+(float64(to)-float64(from))*progress))
+	}
+
+	return result
+}
+
+func (p *ptz) Stop() error {
+
+	p.stopSmooth()
+
+	p.move.Lock()
+	defer p.move.Unlock()
+
+	var errs multiError
+
+	for axis, info := range p.axes {
+		if info.Speed == nil {
+			continue
+		}
+
+		if err := p.cam.SetControl(info.Speed.ID, 0); err != nil {
+			errs = append(errs, fmt.Errorf("Cannot stop %v: %w", axis, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// startSmooth cancels a running smooth move and registers a new one.
+func (p *ptz) startSmooth() chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		close(p.cancel)
+	}
+
+	p.cancel = make(chan struct{})
+	return p.cancel
+}
+
+func (p *ptz) finishSmooth(cancel chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel == cancel {
+		p.cancel = nil
+	}
+}
+
+func (p *ptz) stopSmooth() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		close(p.cancel)
+		p.cancel = nil
+	}
+}
+
+//-----------------------------------------------------------------------------
+//PRESETS
+//-----------------------------------------------------------------------------
+
+func (p *ptz) SavePreset(name string) error {
+
+	if name == "" {
+		return errors.New("Preset needs a name.")
+	}
+
+	position, err := p.Position()
+
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.presets[name] = position
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *ptz) GotoPreset(name string, duration time.Duration) error {
+
+	p.mu.Lock()
+	position, ok := p.presets[name]
+	p.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("No preset named %s.", name)
+	}
+
+	if duration > 0 {
+		return p.MoveSmooth(position, duration)
+	}
+
+	return p.MoveAbsolute(position)
+}
+
+func (p *ptz) DeletePreset(name string) {
+	p.mu.Lock()
+	delete(p.presets, name)
+	p.mu.Unlock()
+}
+
+func (p *ptz) Presets() map[string]PTZPosition {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := map[string]PTZPosition{}
+
+	for name, position := range p.presets {
+		result[name] = position
+	}
+
+	return result
+}
+
+func (p *ptz) SavePresets(path string) error {
+
+	data, err := json.MarshalIndent(p.Presets(), "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadPresets adds the presets stored in the file, replacing those of the same names.
+func (p *ptz) LoadPresets(path string) error {
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	presets := map[string]PTZPosition{}
+
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return fmt.Errorf("Cannot read presets %s: %v", path, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for name, position := range presets {
+		p.presets[name] = position
+	}
+
+	return nil
+}
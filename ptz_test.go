@@ -0,0 +1,166 @@
+package webcam
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newFakePTZCam() *fakeControlCam {
+	return newFakeControlCam(
+		Control{ID: CID_PAN_ABSOLUTE, Name: "Pan, Absolute", Type: CTRL_TYPE_INTEGER, Minimum: -36000, Maximum: 36000, Step: 3600, Default: 0},
+		Control{ID: CID_TILT_ABSOLUTE, Name: "Tilt, Absolute", Type: CTRL_TYPE_INTEGER, Minimum: -36000, Maximum: 36000, Step: 3600, Default: 0},
+		Control{ID: CID_ZOOM_ABSOLUTE, Name: "Zoom, Absolute", Type: CTRL_TYPE_INTEGER, Minimum: 100, Maximum: 500, Step: 1, Default: 100},
+	)
+}
+
+func TestMoveAbsoluteKeepsOtherAxes(t *testing.T) {
+	cam := newFakePTZCam()
+	cam.values[CID_TILT_ABSOLUTE] = -7200
+	cam.values[CID_ZOOM_ABSOLUTE] = 300
+
+	ptz, err := newPTZ(cam)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ptz.MoveAbsolute(PTZPosition{}.With(PAN, 14400)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[ControlID]int32{CID_PAN_ABSOLUTE: 14400, CID_TILT_ABSOLUTE: -7200, CID_ZOOM_ABSOLUTE: 300}
+
+	for id, value := range expected {
+		if cam.value(id) != value {
+			t.Errorf("%v is %d, expected %d", id, cam.value(id), value)
+		}
+	}
+
+	if len(cam.sets) != 1 {
+		t.Errorf("Move set %v, expected the pan only", cam.sets)
+	}
+}
+
+func TestPTZPresetsFile(t *testing.T) {
+	cam := newFakePTZCam()
+	ptz, err := newPTZ(cam)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ptz.MoveAbsolute(PTZPosition{}.With(PAN, 3600).With(ZOOM, 200)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ptz.SavePreset("door"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "presets.json")
+
+	if err := ptz.SavePresets(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := newPTZ(newFakePTZCam())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.LoadPresets(path); err != nil {
+		t.Fatal(err)
+	}
+
+	door, ok := loaded.Presets()["door"]
+
+	if !ok {
+		t.Fatal("Preset door was not loaded")
+	}
+
+	if door.String() != "PTZPosition[pan=3600,tilt=0,zoom=200]" {
+		t.Errorf("Preset door is %v", door)
+	}
+}
+
+func TestMoveSmooth(t *testing.T) {
+	cam := newFakePTZCam()
+	ptz, err := newPTZ(cam)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ptz.MoveSmooth(PTZPosition{}.With(ZOOM, 500), 4*ptzSmoothInterval); err != nil {
+		t.Fatal(err)
+	}
+
+	sets := cam.recorded()
+
+	if len(sets) < 3 || cam.value(CID_ZOOM_ABSOLUTE) != 500 {
+		t.Fatalf("Move set %v, expected steps up to 500", sets)
+	}
+
+	//the zoom goes the way in steps, other axes are left alone
+	previous := int64(100)
+
+	for _, set := range sets {
+		if set.ID != CID_ZOOM_ABSOLUTE || set.Value < previous {
+			t.Errorf("Move set %v after zoom %d", set, previous)
+		}
+		previous = set.Value
+	}
+}
+
+func TestMoveSmoothCancellation(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		interrupt func(ptz PTZ) error
+	}{
+		{"absolute move", func(ptz PTZ) error { return ptz.MoveAbsolute(PTZPosition{}.With(ZOOM, 200)) }},
+		{"relative move", func(ptz PTZ) error { return ptz.MoveRelative(ZOOM, 50) }},
+		{"smooth move", func(ptz PTZ) error { return ptz.MoveSmooth(PTZPosition{}.With(ZOOM, 200), 0) }},
+		{"stop", func(ptz PTZ) error { return ptz.Stop() }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cam := newFakePTZCam()
+			ptz, err := newPTZ(cam)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan error, 1)
+
+			go func() {
+				done <- ptz.MoveSmooth(PTZPosition{}.With(ZOOM, 500), time.Minute)
+			}()
+
+			for len(cam.recorded()) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			if err := c.interrupt(ptz); err != nil {
+				t.Fatal(err)
+			}
+
+			interrupted := cam.recorded()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("Cancelled move failed: %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Smooth move keeps running")
+			}
+
+			//the smooth move has not written after the move that cancelled it
+			if sets := cam.recorded(); len(sets) != len(interrupted) {
+				t.Errorf("Cancelled move set %v", sets[len(interrupted):])
+			}
+		})
+	}
+}
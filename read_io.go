@@ -0,0 +1,73 @@
+package webcam
+
+import (
+	"errors"
+	"syscall"
+)
+
+//-----------------------------------------------------------------------------
+//READ I/O
+//-----------------------------------------------------------------------------
+
+var errCannotRead = errors.New("Device does not support reading frames by read().")
+
+// startReading prepares capturing by read(). Drivers start capturing on the first
+// read and keep the format until the device is closed.
+func (d *device) startReading() error {
+
+	if !d.canRead {
+		return errCannotRead
+	}
+
+	if d.bufType == BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		return errors.New("Frames of multi-planar devices cannot be read by read().")
+	}
+
+	if len(d.layout.sizes) == 0 || d.layout.sizes[0] == 0 {
+		return errors.New("Driver does not tell the size of frames to read.")
+	}
+
+	d.reading = true
+	d.readSequence = 0
+
+	return nil
+}
+
+// readFrame reads a single frame, it is expected to be called once the device
+// is ready to be read.
+func (d *device) readFrame() (*snapshot, error) {
+
+	size := int(d.layout.sizes[0])
+	data := copiedFrames.get(size)[:size]
+
+	for {
+		n, err := d.backend.read(int(d.file.Fd()), data)
+
+		if err == syscall.EINTR {
+			continue
+		}
+
+		if err != nil {
+			d.ioctlFailed("read", err)
+			copiedFrames.put(data)
+			return nil, err
+		}
+
+		meta := frameMeta{sequence: d.readSequence, size: n}
+		d.readSequence++
+		return &snapshot{data: data[:n], strides: d.layout.strides, pooled: true, meta: meta}, nil
+	}
+}
+
+// readHeldFrame reads a frame for StreamFrames, there is no buffer to hold so
+// releasing the frame does nothing.
+func (d *device) readHeldFrame() (*frame, error) {
+
+	snap, err := d.readFrame()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &frame{snapshot: *snap, release: snap.Release}, nil
+}
@@ -0,0 +1,243 @@
+package webcam
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+const (
+	DEFAULT_INITIAL_BACKOFF = 250 * time.Millisecond
+	DEFAULT_MAX_BACKOFF     = 10 * time.Second
+)
+
+func (o ReconnectOptions) withDefaults() ReconnectOptions {
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = DEFAULT_INITIAL_BACKOFF
+	}
+
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DEFAULT_MAX_BACKOFF
+	}
+
+	if o.MaxBackoff < o.InitialBackoff {
+		o.MaxBackoff = o.InitialBackoff
+	}
+
+	return o
+}
+
+//-------------------------------------------------------------------------------------
+//RESILIENT STREAM
+//-------------------------------------------------------------------------------------
+
+// webcamOpener opens the webcam matching the selector, OpenWebcamBy outside of tests.
+type webcamOpener func(selector WebcamSelector) (Webcam, error)
+
+func streamSnapshotsResilient(cam Webcam, framesize *DiscreteFrameSize, options ReconnectOptions, open webcamOpener, snapChan chan Snapshot, gapChan chan StreamGap, errChan chan error, stop chan bool) {
+
+	defer close(snapChan)
+	defer close(errChan)
+
+	if gapChan != nil {
+		defer close(gapChan)
+	}
+
+	options = options.withDefaults()
+	selector := reconnectSelector(cam.Info())
+	profile := restorableProfile(cam)
+
+	for {
+		stopped, err := forwardSnapshots(cam, framesize, snapChan, stop)
+
+		if stopped || !isDeviceLost(err) {
+			closeErr := cam.Close()
+
+			if err = combineErrors(err, closeErr); err != nil {
+				errChan <- err
+			}
+			return
+		}
+
+		gap := StreamGap{Cause: err, Lost: time.Now()}
+		logRecord(LEVEL_WARN, "Device lost", errorFields(err, "path", cam.Info().Path)...)
+
+		if closeErr := cam.Close(); closeErr != nil {
+			logRecord(LEVEL_WARN, "Cannot close lost device", errorFields(closeErr, "path", cam.Info().Path)...)
+		}
+
+		cam, gap.Attempts, stopped, err = reconnect(open, selector, profile, options, stop)
+
+		if stopped {
+			return
+		}
+
+		if err != nil {
+			errChan <- fmt.Errorf("Device matching %v could not be reopened: %v", selector, err)
+			return
+		}
+
+		gap.Resumed = time.Now()
+		gap.Webcam = cam
+		logRecord(LEVEL_INFO, "Device reopened", "path", cam.Info().Path, "after", gap.Resumed.Sub(gap.Lost))
+
+		if gapChan == nil {
+			continue
+		}
+
+		select {
+		case gapChan <- gap:
+		case <-stop:
+			if err := cam.Close(); err != nil {
+				errChan <- err
+			}
+			return
+		}
+	}
+}
+
+// forwardSnapshots runs one stream of the webcam and passes its snapshots on
+// until either the stream fails or the caller stops it.
+func forwardSnapshots(cam Webcam, framesize *DiscreteFrameSize, snapChan chan Snapshot, stop chan bool) (bool, error) {
+
+	innerSnaps := make(chan Snapshot)
+	innerErrs := make(chan error, 1)
+	innerStop := make(chan bool, 1)
+
+	go cam.StreamSnapshots(framesize, innerSnaps, innerErrs, innerStop)
+
+	for {
+		select {
+		case snap, ok := <-innerSnaps:
+			if !ok {
+				return false, <-innerErrs
+			}
+
+			select {
+			case snapChan <- snap:
+			case <-stop:
+				innerStop <- true
+				return true, drainSnapshots(innerSnaps, innerErrs)
+			}
+
+		case <-stop:
+			innerStop <- true
+			return true, drainSnapshots(innerSnaps, innerErrs)
+		}
+	}
+}
+
+func drainSnapshots(snaps chan Snapshot, errs chan error) error {
+	for range snaps {
+	}
+	return <-errs
+}
+
+// reconnect tries to reopen the device with exponential backoff. It returns the
+// reopened webcam and the number of attempts it took.
+func reconnect(open webcamOpener, selector WebcamSelector, profile Profile, options ReconnectOptions, stop chan bool) (Webcam, int, bool, error) {
+
+	backoff := options.InitialBackoff
+	attempts := 0
+
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return nil, attempts, true, nil
+		}
+
+		attempts++
+		cam, err := reopen(open, selector, profile, options)
+
+		if err == nil {
+			return cam, attempts, false, nil
+		}
+
+		if options.MaxAttempts > 0 && attempts >= options.MaxAttempts {
+			return nil, attempts, false, err
+		}
+
+		backoff *= 2
+		if backoff > options.MaxBackoff {
+			backoff = options.MaxBackoff
+		}
+	}
+}
+
+func reopen(open webcamOpener, selector WebcamSelector, profile Profile, options ReconnectOptions) (Webcam, error) {
+
+	cam, err := open(selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := cam.ApplyProfile(profile)
+
+	if err != nil {
+		return nil, combineErrors(err, cam.Close())
+	}
+
+	for _, field := range report.Rejected() {
+		logRecord(LEVEL_WARN, "Cannot restore profile field", "path", cam.Info().Path, "field", field)
+	}
+
+	if options.Reconfigure == nil {
+		return cam, nil
+	}
+
+	if err := options.Reconfigure(cam); err != nil {
+		return nil, combineErrors(err, cam.Close())
+	}
+
+	return cam, nil
+}
+
+// restorableProfile captures the frame rate and controls of the webcam, so that
+// they can be restored on the reopened one. The frame size is given by the stream.
+func restorableProfile(cam Webcam) Profile {
+	profile, err := cam.CaptureProfile()
+
+	if err != nil {
+		logRecord(LEVEL_WARN, "Cannot capture profile", errorFields(err, "path", cam.Info().Path)...)
+		return Profile{}
+	}
+
+	profile.PixelFormat = ""
+	profile.Width = 0
+	profile.Height = 0
+
+	return profile
+}
+
+// reconnectSelector selects the same physical camera, preferably by its serial
+// number, otherwise by the port it is plugged in.
+func reconnectSelector(info WebcamInfo) WebcamSelector {
+	if info.Serial != "" {
+		return WebcamSelector{VendorID: info.VendorID, ProductID: info.ProductID, Serial: info.Serial}
+	}
+
+	if info.ByPath != "" {
+		return WebcamSelector{ByPath: info.ByPath}
+	}
+
+	if info.BusInfo != "" {
+		return WebcamSelector{BusInfo: info.BusInfo}
+	}
+
+	return WebcamSelector{Path: info.Path}
+}
+
+// isDeviceLost tells whether the stream failed because the device is gone. EIO
+// is left out, drivers report transient transfer errors with it too.
+func isDeviceLost(err error) bool {
+	for _, lost := range []error{syscall.ENODEV, syscall.ENXIO, syscall.ESHUTDOWN} {
+		if errors.Is(err, lost) {
+			return true
+		}
+	}
+
+	return false
+}
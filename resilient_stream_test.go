@@ -0,0 +1,197 @@
+//go:build webcam_fake
+// +build webcam_fake
+
+package webcam
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsDeviceLost(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		lost bool
+	}{
+		{nil, false},
+		{syscall.ENODEV, true},
+		{syscall.ENXIO, true},
+		{syscall.ESHUTDOWN, true},
+		{fmt.Errorf("Cannot dequeue buffer: %w", syscall.ENODEV), true},
+		{combineErrors(syscall.EINVAL, syscall.ENODEV), true},
+		{syscall.EIO, false},
+		{syscall.EINVAL, false},
+		{combineErrors(syscall.EIO, syscall.EINVAL), false},
+	} {
+		if lost := isDeviceLost(c.err); lost != c.lost {
+			t.Errorf("isDeviceLost(%v) = %v, expected %v", c.err, lost, c.lost)
+		}
+	}
+}
+
+func TestResilientStreamReconnects(t *testing.T) {
+	lostDev, lostBackend := testDevice(t)
+	reopenedDev, _ := testDevice(t)
+
+	mu := sync.Mutex{}
+	opened := 0
+
+	//the camera reappears on the third attempt
+	open := func(selector WebcamSelector) (Webcam, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if selector.Path != lostDev.Info().Path {
+			t.Errorf("Reopening %v, expected the path of the lost device", selector)
+		}
+
+		opened++
+		if opened < 3 {
+			return nil, syscall.ENOENT
+		}
+		return reopenedDev, nil
+	}
+
+	snaps := make(chan Snapshot)
+	gaps := make(chan StreamGap)
+	errs := make(chan error, 1)
+	stop := make(chan bool)
+	options := ReconnectOptions{InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	go streamSnapshotsResilient(lostDev, testFrameSize(t), options, open, snaps, gaps, errs, stop)
+
+	(<-snaps).Release()
+	lostBackend.fail("DQBUF", syscall.ENODEV)
+
+	var gap StreamGap
+
+	for gap.Webcam == nil {
+		select {
+		case snap := <-snaps:
+			snap.Release()
+		case gap = <-gaps:
+		}
+	}
+
+	if !errors.Is(gap.Cause, syscall.ENODEV) {
+		t.Errorf("Gap was caused by %v, expected ENODEV", gap.Cause)
+	}
+
+	if gap.Attempts != 3 {
+		t.Errorf("Device was reopened after %d attempts, expected 3", gap.Attempts)
+	}
+
+	if gap.Webcam != reopenedDev {
+		t.Errorf("Gap does not carry the reopened webcam")
+	}
+
+	if gap.Resumed.Before(gap.Lost) {
+		t.Errorf("Stream resumed at %v before it was lost at %v", gap.Resumed, gap.Lost)
+	}
+
+	if err := lostDev.Err(); err != ErrDeviceClosed {
+		t.Errorf("Lost device was not closed: %v", err)
+	}
+
+	//the stream goes on with the reopened device
+	(<-snaps).Release()
+	close(stop)
+
+	for range snaps {
+	}
+
+	if err := <-errs; err != nil {
+		t.Errorf("Stream failed: %v", err)
+	}
+
+	if err := reopenedDev.Err(); err != ErrDeviceClosed {
+		t.Errorf("Reopened device was not closed: %v", err)
+	}
+}
+
+func TestResilientStreamEndsOnTransientError(t *testing.T) {
+	dev, backend := testDevice(t)
+
+	open := func(selector WebcamSelector) (Webcam, error) {
+		t.Errorf("Device was reopened after a transient error")
+		return nil, syscall.ENOENT
+	}
+
+	snaps := make(chan Snapshot)
+	errs := make(chan error, 1)
+
+	go streamSnapshotsResilient(dev, testFrameSize(t), ReconnectOptions{InitialBackoff: time.Millisecond}, open, snaps, nil, errs, make(chan bool))
+
+	(<-snaps).Release()
+	backend.fail("DQBUF", syscall.EIO)
+
+	for snap := range snaps {
+		snap.Release()
+	}
+
+	if err := <-errs; !errors.Is(err, syscall.EIO) {
+		t.Errorf("Stream ended with %v, expected EIO", err)
+	}
+
+	if err := dev.Err(); err != ErrDeviceClosed {
+		t.Errorf("Device was not closed: %v", err)
+	}
+}
+
+func TestReconnectBacksOff(t *testing.T) {
+	attempts := []time.Time{}
+
+	open := func(selector WebcamSelector) (Webcam, error) {
+		attempts = append(attempts, time.Now())
+		return nil, syscall.ENOENT
+	}
+
+	options := ReconnectOptions{InitialBackoff: 4 * time.Millisecond, MaxBackoff: 8 * time.Millisecond, MaxAttempts: 5}
+	start := time.Now()
+
+	cam, n, stopped, err := reconnect(open, WebcamSelector{Path: "/dev/video-fake"}, Profile{}, options, make(chan bool))
+
+	if cam != nil || stopped || !errors.Is(err, syscall.ENOENT) {
+		t.Fatalf("Reconnecting returned %v, %v, %v, expected the error of the last attempt", cam, stopped, err)
+	}
+
+	if n != 5 || len(attempts) != 5 {
+		t.Fatalf("Reconnecting made %d attempts and reported %d, expected 5", len(attempts), n)
+	}
+
+	//the backoff doubles up to MaxBackoff
+	expected := []time.Duration{4, 8, 8, 8, 8}
+	previous := start
+
+	for i, at := range attempts {
+		if delay := at.Sub(previous); delay < expected[i]*time.Millisecond {
+			t.Errorf("Attempt %d came after %v, expected at least %v", i+1, delay, expected[i]*time.Millisecond)
+		}
+		previous = at
+	}
+
+	//without the cap the last attempt would wait 64ms
+	if delay := attempts[4].Sub(attempts[3]); delay >= 64*time.Millisecond {
+		t.Errorf("Last attempt came after %v, the backoff is not capped", delay)
+	}
+}
+
+func TestReconnectStops(t *testing.T) {
+	open := func(selector WebcamSelector) (Webcam, error) {
+		t.Errorf("Device was reopened after the stream was stopped")
+		return nil, syscall.ENOENT
+	}
+
+	stop := make(chan bool)
+	close(stop)
+
+	cam, n, stopped, err := reconnect(open, WebcamSelector{}, Profile{}, ReconnectOptions{InitialBackoff: time.Hour, MaxBackoff: time.Hour}, stop)
+
+	if cam != nil || n != 0 || !stopped || err != nil {
+		t.Errorf("Reconnecting returned %v, %d, %v, %v, expected to stop before any attempt", cam, n, stopped, err)
+	}
+}
@@ -0,0 +1,225 @@
+// Package stats computes statistics of frames for quality checks and monitoring:
+// the luma histogram, the means of the channels, the share of under and over
+// exposed pixels, a sharpness score and whether the frame is frozen. It reads
+// the samples of GREY, packed 4:2:2 (YUYV, UYVY, ...) and 4:2:0 (NV12, YUV420,
+// ...) frames in place through webcam.PlaneView, without converting them to RGB,
+// so that it keeps up with the frame rate.
+package stats
+
+import (
+	"fmt"
+	"hash/crc32"
+	"image"
+	"math"
+	"sync"
+
+	"github.com/jalasoft/go-webcam"
+)
+
+// limits of the luma of video range, below and above which pixels are clipped
+const (
+	DEFAULT_UNDER_LEVEL = 16
+	DEFAULT_OVER_LEVEL  = 235
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+//-----------------------------------------------------------------------------
+//OPTIONS AND RESULTS
+//-----------------------------------------------------------------------------
+
+// Options configure an Analyzer. Pixels with a luma at most UnderLevel count as
+// underexposed, those with a luma at least OverLevel as overexposed, defaults
+// (DEFAULT_UNDER_LEVEL, DEFAULT_OVER_LEVEL) are used when zero. SharpnessROI is
+// the region the sharpness is scored on, the whole frame when empty.
+// SkipSharpness leaves the sharpness, the most expensive statistic, out.
+type Options struct {
+	UnderLevel    uint8
+	OverLevel     uint8
+	SharpnessROI  image.Rectangle
+	SkipSharpness bool
+}
+
+// FrameStats are the statistics of a frame. Histogram counts pixels by luma.
+// Means of Y, Cb and Cr are measured, those of R, G and B derived from them
+// (BT.601, full range), which ignores clipping of single pixels; chroma of GREY
+// frames is neutral. Sharpness is the variance of the Laplacian of the luma, see
+// webcam.Sharpness. Frozen tells that the frame is identical to the previous
+// one, FrozenFrames for how many frames in a row.
+type FrameStats struct {
+	Width        uint32      `json:"width"`
+	Height       uint32      `json:"height"`
+	Histogram    [256]uint32 `json:"histogram"`
+	MeanY        float64     `json:"mean_y"`
+	MeanCb       float64     `json:"mean_cb"`
+	MeanCr       float64     `json:"mean_cr"`
+	MeanR        float64     `json:"mean_r"`
+	MeanG        float64     `json:"mean_g"`
+	MeanB        float64     `json:"mean_b"`
+	Underexposed float64     `json:"underexposed_percent"`
+	Overexposed  float64     `json:"overexposed_percent"`
+	Sharpness    float64     `json:"sharpness"`
+	Frozen       bool        `json:"frozen"`
+	FrozenFrames int         `json:"frozen_frames"`
+}
+
+func (s FrameStats) String() string {
+	return fmt.Sprintf("FrameStats[%dx%d,y=%.1f,rgb=%.1f/%.1f/%.1f,under=%.1f%%,over=%.1f%%,sharpness=%.1f,frozen=%d]", s.Width, s.Height, s.MeanY, s.MeanR, s.MeanG, s.MeanB, s.Underexposed, s.Overexposed, s.Sharpness, s.FrozenFrames)
+}
+
+//-----------------------------------------------------------------------------
+//ANALYZER
+//-----------------------------------------------------------------------------
+
+// Analyzer computes the statistics of the frames of a stream. It remembers the
+// last frame to detect frozen ones, so every stream needs its own Analyzer. It
+// is safe for concurrent use, though frames are expected in order.
+type Analyzer struct {
+	options Options
+
+	mu       sync.Mutex
+	checksum uint32
+	size     int
+	frozen   int
+}
+
+func NewAnalyzer(options Options) *Analyzer {
+	if options.UnderLevel == 0 {
+		options.UnderLevel = DEFAULT_UNDER_LEVEL
+	}
+
+	if options.OverLevel == 0 {
+		options.OverLevel = DEFAULT_OVER_LEVEL
+	}
+
+	return &Analyzer{options: options}
+}
+
+// Analyze computes the statistics of a snapshot or frame of the given frame size.
+func (a *Analyzer) Analyze(snap webcam.Snapshot, frameSize webcam.DiscreteFrameSize) (FrameStats, error) {
+
+	view, err := webcam.NewPlaneView(snap, frameSize)
+
+	if err != nil {
+		return FrameStats{}, err
+	}
+
+	result := FrameStats{Width: frameSize.Width, Height: frameSize.Height}
+
+	lumaStats(view, &result, a.options)
+	chromaStats(view, &result)
+	deriveRGB(&result)
+
+	if !a.options.SkipSharpness {
+		if result.Sharpness, err = webcam.Sharpness(snap, frameSize, a.options.SharpnessROI); err != nil {
+			return FrameStats{}, err
+		}
+	}
+
+	a.detectFrozen(&result, snap)
+	return result, nil
+}
+
+// detectFrozen compares the checksum of all the bytes of the frame with that of
+// the previous one.
+func (a *Analyzer) detectFrozen(result *FrameStats, snap webcam.Snapshot) {
+
+	checksum := uint32(0)
+	size := 0
+
+	for _, plane := range snap.Planes() {
+		checksum = crc32.Update(checksum, crcTable, plane)
+		size += len(plane)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if size > 0 && size == a.size && checksum == a.checksum {
+		a.frozen++
+	} else {
+		a.frozen = 0
+	}
+
+	a.checksum = checksum
+	a.size = size
+
+	result.Frozen = a.frozen > 0
+	result.FrozenFrames = a.frozen
+}
+
+//-----------------------------------------------------------------------------
+//STATISTICS
+//-----------------------------------------------------------------------------
+
+func lumaStats(view webcam.PlaneView, result *FrameStats, options Options) {
+
+	var sum uint64
+
+	for y := 0; y < view.Height(); y++ {
+		for x := 0; x < view.Width(); x++ {
+			result.Histogram[view.Y(x, y)]++
+		}
+	}
+
+	var under, over uint64
+
+	for value, count := range result.Histogram {
+		sum += uint64(value) * uint64(count)
+
+		if value <= int(options.UnderLevel) {
+			under += uint64(count)
+		}
+
+		if value >= int(options.OverLevel) {
+			over += uint64(count)
+		}
+	}
+
+	pixels := float64(view.Width() * view.Height())
+
+	result.MeanY = float64(sum) / pixels
+	result.Underexposed = 100 * float64(under) / pixels
+	result.Overexposed = 100 * float64(over) / pixels
+}
+
+// chromaStats averages one sample of every block of pixels sharing chroma.
+func chromaStats(view webcam.PlaneView, result *FrameStats) {
+
+	if !view.HasChroma() {
+		result.MeanCb = 128
+		result.MeanCr = 128
+		return
+	}
+
+	var cb, cr, samples uint64
+	blockWidth, blockHeight := view.ChromaBlock()
+
+	for y := 0; y < view.Height(); y += blockHeight {
+		for x := 0; x < view.Width(); x += blockWidth {
+			b, r := view.CbCr(x, y)
+			cb += uint64(b)
+			cr += uint64(r)
+			samples++
+		}
+	}
+
+	result.MeanCb = float64(cb) / float64(samples)
+	result.MeanCr = float64(cr) / float64(samples)
+}
+
+// deriveRGB converts the means of Y, Cb and Cr into those of R, G and B, which
+// the linearity of the conversion allows.
+func deriveRGB(result *FrameStats) {
+	y := result.MeanY
+	cb := result.MeanCb - 128
+	cr := result.MeanCr - 128
+
+	result.MeanR = clamp(y + 1.402*cr)
+	result.MeanG = clamp(y - 0.344136*cb - 0.714136*cr)
+	result.MeanB = clamp(y + 1.772*cb)
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(255, v))
+}
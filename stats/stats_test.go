@@ -0,0 +1,250 @@
+package stats
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/jalasoft/go-webcam"
+)
+
+// fakeSnapshot holds the planes of a frame built by a test.
+type fakeSnapshot struct {
+	planes  [][]byte
+	strides []uint32
+}
+
+func (s fakeSnapshot) Data() []byte      { return bytes.Join(s.planes, nil) }
+func (s fakeSnapshot) Planes() [][]byte  { return s.planes }
+func (s fakeSnapshot) Strides() []uint32 { return s.strides }
+func (s fakeSnapshot) Release()          {}
+
+func frameSize(t *testing.T, code string, width uint32, height uint32) webcam.DiscreteFrameSize {
+	t.Helper()
+
+	fourcc, err := webcam.ParseFourCC(code)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return webcam.DiscreteFrameSize{PixelFormat: webcam.NewPixelFormat(fourcc), Width: width, Height: height}
+}
+
+// the 4x2 frame all the formats carry: 3 pixels at most 16, 2 at least 235,
+// Cb averaging 115 and Cr 155
+var (
+	testLuma = [][]byte{
+		{0, 10, 20, 250},
+		{16, 100, 235, 200},
+	}
+	testCb = [][]byte{{100, 110}, {120, 130}}
+	testCr = [][]byte{{140, 150}, {160, 170}}
+)
+
+const padding = 255
+
+// pad extends a row to the stride with bytes the statistics must not read.
+func pad(row []byte, stride int) []byte {
+	for len(row) < stride {
+		row = append(row, padding)
+	}
+	return row
+}
+
+func grey(stride int) []byte {
+	data := []byte{}
+
+	for _, row := range testLuma {
+		data = append(data, pad(append([]byte{}, row...), stride)...)
+	}
+
+	return data
+}
+
+func yuyv(stride int) []byte {
+	data := []byte{}
+
+	for y, row := range testLuma {
+		line := []byte{}
+
+		for x := 0; x < len(row); x += 2 {
+			line = append(line, row[x], testCb[y][x/2], row[x+1], testCr[y][x/2])
+		}
+
+		data = append(data, pad(line, stride)...)
+	}
+
+	return data
+}
+
+// nv12Chroma is the only chroma row of the 4:2:0 frame, averaging Cb and Cr of
+// the first and the second row of the other formats.
+func nv12Chroma(stride int) []byte {
+	return pad([]byte{testCb[0][0], testCr[0][0], testCb[1][1], testCr[1][1]}, stride)
+}
+
+//-----------------------------------------------------------------------------
+//STATISTICS
+//-----------------------------------------------------------------------------
+
+func TestAnalyze(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		format  string
+		planes  [][]byte
+		strides []uint32
+		meanCb  float64
+		meanCr  float64
+	}{
+		{"GREY", "GREY", [][]byte{grey(4)}, nil, 128, 128},
+		{"GREY with stride", "GREY", [][]byte{grey(6)}, []uint32{6}, 128, 128},
+		{"YUYV", "YUYV", [][]byte{yuyv(8)}, nil, 115, 155},
+		{"YUYV with stride", "YUYV", [][]byte{yuyv(12)}, []uint32{12}, 115, 155},
+		{"NV12", "NV12", [][]byte{append(grey(4), nv12Chroma(4)...)}, nil, 115, 155},
+		{"NV12 with stride", "NV12", [][]byte{append(grey(6), nv12Chroma(6)...)}, []uint32{6}, 115, 155},
+		{"NV12M", "NM12", [][]byte{grey(4), nv12Chroma(4)}, nil, 115, 155},
+		{"NV12M with strides", "NM12", [][]byte{grey(6), nv12Chroma(8)}, []uint32{6, 8}, 115, 155},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			a := NewAnalyzer(Options{SkipSharpness: true})
+
+			result, err := a.Analyze(fakeSnapshot{planes: c.planes, strides: c.strides}, frameSize(t, c.format, 4, 2))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := [256]uint32{}
+			for _, row := range testLuma {
+				for _, value := range row {
+					expected[value]++
+				}
+			}
+
+			if result.Histogram != expected {
+				t.Errorf("Histogram counts %v, expected %v", nonZero(result.Histogram), nonZero(expected))
+			}
+
+			assertClose(t, "MeanY", result.MeanY, 831.0/8)
+			assertClose(t, "MeanCb", result.MeanCb, c.meanCb)
+			assertClose(t, "MeanCr", result.MeanCr, c.meanCr)
+			assertClose(t, "Underexposed", result.Underexposed, 37.5)
+			assertClose(t, "Overexposed", result.Overexposed, 25)
+
+			if c.meanCb == 128 && (result.MeanR != result.MeanY || result.MeanG != result.MeanY || result.MeanB != result.MeanY) {
+				t.Errorf("Neutral frame has RGB %.1f/%.1f/%.1f, expected gray of %.1f", result.MeanR, result.MeanG, result.MeanB, result.MeanY)
+			}
+		})
+	}
+}
+
+func TestAnalyzeLevels(t *testing.T) {
+	a := NewAnalyzer(Options{UnderLevel: 10, OverLevel: 240, SkipSharpness: true})
+
+	result, err := a.Analyze(fakeSnapshot{planes: [][]byte{grey(4)}}, frameSize(t, "GREY", 4, 2))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//0 and 10 are at most 10, only 250 is at least 240
+	assertClose(t, "Underexposed", result.Underexposed, 25)
+	assertClose(t, "Overexposed", result.Overexposed, 12.5)
+}
+
+func TestAnalyzeShortFrames(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		format  string
+		width   uint32
+		height  uint32
+		planes  [][]byte
+		strides []uint32
+	}{
+		{"GREY", "GREY", 4, 2, [][]byte{grey(4)[:7]}, nil},
+		{"GREY with stride", "GREY", 4, 2, [][]byte{grey(4)}, []uint32{6}},
+		{"YUYV", "YUYV", 4, 2, [][]byte{yuyv(8)[:14]}, nil},
+		{"YUYV with stride", "YUYV", 4, 2, [][]byte{yuyv(8)}, []uint32{12}},
+		{"NV12 without chroma", "NV12", 4, 2, [][]byte{grey(4)}, nil},
+		{"NV12 with short chroma", "NV12", 4, 2, [][]byte{append(grey(4), nv12Chroma(4)[:3]...)}, nil},
+		{"NV12M without chroma plane", "NM12", 4, 2, [][]byte{grey(4)}, nil},
+		{"NV12M with stride", "NM12", 4, 2, [][]byte{grey(4), nv12Chroma(4)}, []uint32{6}},
+		{"empty frame", "GREY", 0, 0, [][]byte{grey(4)}, nil},
+		{"unsupported format", "MJPG", 4, 2, [][]byte{grey(4)}, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			a := NewAnalyzer(Options{SkipSharpness: true})
+
+			if result, err := a.Analyze(fakeSnapshot{planes: c.planes, strides: c.strides}, frameSize(t, c.format, c.width, c.height)); err == nil {
+				t.Errorf("Frame was analyzed as %v, expected an error", result)
+			}
+		})
+	}
+
+	a := NewAnalyzer(Options{SkipSharpness: true})
+
+	if _, err := a.Analyze(fakeSnapshot{planes: [][]byte{grey(4)}}, webcam.DiscreteFrameSize{Width: 4, Height: 2}); err == nil {
+		t.Errorf("Frame size without a pixel format was analyzed")
+	}
+}
+
+//-----------------------------------------------------------------------------
+//FROZEN FRAMES
+//-----------------------------------------------------------------------------
+
+func TestAnalyzeFrozen(t *testing.T) {
+	a := NewAnalyzer(Options{SkipSharpness: true})
+	size := frameSize(t, "YUYV", 4, 2)
+
+	still := yuyv(8)
+	moved := yuyv(8)
+	moved[0]++
+
+	for i, c := range []struct {
+		frame  []byte
+		frozen int
+	}{
+		{still, 0},
+		{still, 1},
+		{still, 2},
+		{moved, 0},
+		{moved, 1},
+		{still, 0},
+	} {
+		result, err := a.Analyze(fakeSnapshot{planes: [][]byte{c.frame}}, size)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.FrozenFrames != c.frozen || result.Frozen != (c.frozen > 0) {
+			t.Errorf("Frame %d is frozen for %d frames (%v), expected %d", i, result.FrozenFrames, result.Frozen, c.frozen)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+//HELPERS
+//-----------------------------------------------------------------------------
+
+func assertClose(t *testing.T, name string, actual float64, expected float64) {
+	t.Helper()
+
+	if math.Abs(actual-expected) > 1e-9 {
+		t.Errorf("%s is %v, expected %v", name, actual, expected)
+	}
+}
+
+// nonZero returns the counts of the histogram by luma, leaving out the empty ones.
+func nonZero(histogram [256]uint32) map[int]uint32 {
+	counts := map[int]uint32{}
+
+	for value, count := range histogram {
+		if count > 0 {
+			counts[value] = count
+		}
+	}
+
+	return counts
+}
@@ -0,0 +1,385 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DEFAULT_STATS_WINDOW   = 2 * time.Second
+	DEFAULT_STATS_INTERVAL = time.Second
+)
+
+//-----------------------------------------------------------------------------
+//FRAME METADATA
+//-----------------------------------------------------------------------------
+
+// frameMeta describes a captured frame for the statistics of its stream.
+type frameMeta struct {
+	sequence uint32
+	//time the driver captured the frame on the monotonic clock, zero when the
+	//driver does not timestamp frames on that clock
+	captured time.Duration
+	//payload of the frame in bytes, even if it has not been copied
+	size int
+}
+
+// newFrameMeta reads the sequence, timestamp and payload of a dequeued buffer.
+func (d *device) newFrameMeta(buffer *C.struct_v4l2_buffer) frameMeta {
+
+	meta := frameMeta{sequence: uint32(buffer.sequence)}
+
+	if buffer.flags&C.V4L2_BUF_FLAG_TIMESTAMP_MASK == C.V4L2_BUF_FLAG_TIMESTAMP_MONOTONIC {
+		meta.captured = time.Duration(buffer.timestamp.tv_sec)*time.Second + time.Duration(buffer.timestamp.tv_usec)*time.Microsecond
+	}
+
+	if d.bufType != BUF_TYPE_VIDEO_CAPTURE_MPLANE {
+		meta.size = int(buffer.bytesused)
+		return meta
+	}
+
+	for _, plane := range bufferPlanes(buffer) {
+		//the offset is part of bytesused, unless a broken driver says otherwise
+		if plane.bytesused > plane.data_offset {
+			meta.size += int(plane.bytesused - plane.data_offset)
+		}
+	}
+
+	return meta
+}
+
+func monotonicNow() time.Duration {
+	return time.Duration(C.monotonicNow())
+}
+
+//-----------------------------------------------------------------------------
+//STREAM STATISTICS
+//-----------------------------------------------------------------------------
+
+// statsSample is a delivered frame within the sliding window.
+type statsSample struct {
+	at      time.Time
+	size    int
+	latency time.Duration
+}
+
+// streamStats is updated by the loop of a stream and read by Stats() from any
+// goroutine, it has its own lock so that readers never wait for an ioctl.
+type streamStats struct {
+	mu      sync.Mutex
+	window  time.Duration
+	buffers int
+	//totals of the device the stream adds to
+	totals *deviceTotals
+
+	started time.Time
+	stopped time.Time
+	running bool
+
+	frames        uint64
+	bytes         uint64
+	driverDrops   uint64
+	consumerDrops uint64
+	errors        uint64
+	queued        int
+
+	//last sequence received from the driver
+	sequence  uint32
+	sequenced bool
+
+	//deliveries within the window, oldest first
+	samples []statsSample
+}
+
+func newStreamStats(totals *deviceTotals, buffers int, window time.Duration) *streamStats {
+	if window <= 0 {
+		window = DEFAULT_STATS_WINDOW
+	}
+
+	totals.mu.Lock()
+	totals.streams++
+	totals.mu.Unlock()
+
+	return &streamStats{window: window, buffers: buffers, totals: totals, started: time.Now(), running: true}
+}
+
+// received accounts a frame taken from the driver, gaps in the sequence are
+// frames the driver dropped because no buffer was queued.
+func (s *streamStats) received(meta frameMeta, queued int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//differences are taken modulo 2^32, so that a wrapping sequence is no gap
+	if gap := meta.sequence - s.sequence - 1; s.sequenced && gap < 1<<31 {
+		s.driverDrops += uint64(gap)
+		s.totals.add(&s.totals.driverDrops, uint64(gap))
+	}
+
+	s.sequence = meta.sequence
+	s.sequenced = true
+	s.queued = queued
+}
+
+// delivered accounts a frame the consumer received.
+func (s *streamStats) delivered(meta frameMeta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample := statsSample{at: time.Now(), size: meta.size}
+
+	if meta.captured > 0 {
+		sample.latency = monotonicNow() - meta.captured
+	}
+
+	s.frames++
+	s.bytes += uint64(meta.size)
+	s.samples = append(s.samples, sample)
+	s.trim(sample.at)
+	s.totals.delivered(meta.size)
+}
+
+// dropped accounts a frame the consumer was not ready to receive.
+func (s *streamStats) dropped() {
+	s.mu.Lock()
+	s.consumerDrops++
+	s.mu.Unlock()
+	s.totals.add(&s.totals.consumerDrops, 1)
+}
+
+func (s *streamStats) failed() {
+	s.mu.Lock()
+	s.errors++
+	s.mu.Unlock()
+	s.totals.add(&s.totals.errors, 1)
+}
+
+func (s *streamStats) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.errors++
+		s.totals.add(&s.totals.errors, 1)
+	}
+
+	s.running = false
+	s.stopped = time.Now()
+}
+
+// trim forgets deliveries that left the window.
+func (s *streamStats) trim(now time.Time) {
+	start := 0
+
+	for start < len(s.samples) && now.Sub(s.samples[start].at) > s.window {
+		start++
+	}
+
+	if start > 0 {
+		s.samples = append(s.samples[:0], s.samples[start:]...)
+	}
+}
+
+func (s *streamStats) report() StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if !s.running {
+		now = s.stopped
+	}
+
+	s.trim(now)
+
+	result := StreamStats{
+		Running:           s.running,
+		Started:           s.started,
+		Duration:          now.Sub(s.started),
+		Frames:            s.frames,
+		Bytes:             s.bytes,
+		DroppedByDriver:   s.driverDrops,
+		DroppedByConsumer: s.consumerDrops,
+		Errors:            s.errors,
+		Queued:            s.queued,
+		Buffers:           s.buffers,
+	}
+
+	//rates are measured over the window, or over the stream while it is younger
+	span := s.window
+
+	if result.Duration < span {
+		span = result.Duration
+	}
+
+	var latencies time.Duration
+	measured := 0
+
+	for _, sample := range s.samples {
+		result.BytesPerSecond += float64(sample.size)
+
+		if sample.latency > 0 {
+			latencies += sample.latency
+			measured++
+
+			if sample.latency > result.MaxLatency {
+				result.MaxLatency = sample.latency
+			}
+		}
+	}
+
+	if span > 0 {
+		result.FPS = float64(len(s.samples)) / span.Seconds()
+		result.BytesPerSecond /= span.Seconds()
+	} else {
+		result.BytesPerSecond = 0
+	}
+
+	if measured > 0 {
+		result.Latency = latencies / time.Duration(measured)
+	}
+
+	return result
+}
+
+//-----------------------------------------------------------------------------
+//DEVICE TOTALS
+//-----------------------------------------------------------------------------
+
+// FRAME_SIZE_BUCKETS are the upper bounds in bytes of the buckets frames are
+// counted in by StreamTotals.FrameSizes.
+var FRAME_SIZE_BUCKETS = []int{16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// deviceTotals accumulate the counters of every stream of a device since it was
+// opened, together with the ioctls that failed.
+type deviceTotals struct {
+	mu            sync.Mutex
+	streams       uint64
+	frames        uint64
+	bytes         uint64
+	driverDrops   uint64
+	consumerDrops uint64
+	errors        uint64
+	//one count per bucket of FRAME_SIZE_BUCKETS and one for larger frames
+	frameSizes  []uint64
+	ioctlErrors map[string]uint64
+}
+
+func (t *deviceTotals) add(counter *uint64, n uint64) {
+	t.mu.Lock()
+	*counter += n
+	t.mu.Unlock()
+}
+
+func (t *deviceTotals) delivered(size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.frameSizes == nil {
+		t.frameSizes = make([]uint64, len(FRAME_SIZE_BUCKETS)+1)
+	}
+
+	bucket := 0
+
+	for bucket < len(FRAME_SIZE_BUCKETS) && size > FRAME_SIZE_BUCKETS[bucket] {
+		bucket++
+	}
+
+	t.frames++
+	t.bytes += uint64(size)
+	t.frameSizes[bucket]++
+}
+
+// ioctlFailed counts a failed ioctl, op is the name of the request without its
+// VIDIOC_ prefix, e.g. "DQBUF", or of the system call, e.g. "poll". Interrupted
+// calls are not failures.
+func (t *deviceTotals) ioctlFailed(op string, err error) {
+	if err == nil || err == syscall.EINTR {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ioctlErrors == nil {
+		t.ioctlErrors = map[string]uint64{}
+	}
+
+	t.ioctlErrors[op]++
+}
+
+func (t *deviceTotals) report() StreamTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := StreamTotals{
+		Streams:           t.streams,
+		Frames:            t.frames,
+		Bytes:             t.bytes,
+		DroppedByDriver:   t.driverDrops,
+		DroppedByConsumer: t.consumerDrops,
+		Errors:            t.errors,
+		FrameSizes:        make([]uint64, len(FRAME_SIZE_BUCKETS)+1),
+		IoctlErrors:       map[string]uint64{},
+	}
+
+	copy(result.FrameSizes, t.frameSizes)
+
+	for op, count := range t.ioctlErrors {
+		result.IoctlErrors[op] = count
+	}
+
+	return result
+}
+
+//-----------------------------------------------------------------------------
+//STATS ACCESS
+//-----------------------------------------------------------------------------
+
+func (d *device) Stats() StreamStats {
+
+	stats := d.loadStats()
+
+	if stats == nil {
+		return StreamStats{}
+	}
+
+	return stats.report()
+}
+
+// loadStats returns the statistics of the running stream or of the last one,
+// nil before the first stream.
+func (d *device) loadStats() *streamStats {
+	stats, _ := d.stats.Load().(*streamStats)
+	return stats
+}
+
+func (d *device) Totals() StreamTotals {
+	return d.totals.report()
+}
+
+// emitStats sends the statistics of a stream every interval until the stream
+// finishes, a consumer that does not keep up misses reports but never stalls
+// the stream.
+func emitStats(stats *streamStats, interval time.Duration, statsChan chan StreamStats, finished chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-finished:
+			return
+		}
+
+		select {
+		case statsChan <- stats.report():
+		case <-finished:
+			return
+		}
+	}
+}
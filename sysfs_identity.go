@@ -0,0 +1,144 @@
+package webcam
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysfsLayout tells where sysfs and device nodes are mounted, so that the
+// identity of a device may be read from a directory tree other than the real one.
+type sysfsLayout struct {
+	sys string
+	dev string
+}
+
+var defaultLayout = sysfsLayout{sys: "/sys", dev: "/dev"}
+
+//---------------------------------------------------------------------------------------
+//IDENTITY
+//---------------------------------------------------------------------------------------
+
+func newWebcamInfo(path string, caps Capabilities, layout sysfsLayout) WebcamInfo {
+	info := WebcamInfo{Path: path, Name: caps.Driver(), Card: caps.Card(), BusInfo: caps.BusInfo()}
+	layout.readIdentity(&info)
+	return info
+}
+
+// readIdentity fills in what sysfs and udev links know about the device node
+// info.Path. Missing pieces of information are silently left empty.
+func (l sysfsLayout) readIdentity(info *WebcamInfo) {
+
+	node, err := filepath.EvalSymlinks(info.Path)
+
+	if err != nil {
+		node = info.Path
+	}
+
+	name := filepath.Base(node)
+	classDir := filepath.Join(l.sys, "class", "video4linux", name)
+
+	if index, ok := readSysfsUint(filepath.Join(classDir, "index"), 10, 32); ok {
+		info.Index = uint32(index)
+	}
+
+	if usbDir, ok := l.findUsbDevice(filepath.Join(classDir, "device")); ok {
+		if vendor, ok := readSysfsUint(filepath.Join(usbDir, "idVendor"), 16, 16); ok {
+			info.VendorID = uint16(vendor)
+		}
+
+		if product, ok := readSysfsUint(filepath.Join(usbDir, "idProduct"), 16, 16); ok {
+			info.ProductID = uint16(product)
+		}
+
+		info.Serial = readSysfsString(filepath.Join(usbDir, "serial"))
+	}
+
+	target := filepath.Join(l.dev, name)
+	info.ByID = findLinkTo(filepath.Join(l.dev, "v4l", "by-id"), target)
+	info.ByPath = findLinkTo(filepath.Join(l.dev, "v4l", "by-path"), target)
+}
+
+// findUsbDevice walks up from the device of a video4linux node (typically an
+// USB interface) to the USB device that carries vendor and product ids.
+func (l sysfsLayout) findUsbDevice(deviceLink string) (string, bool) {
+
+	dir, err := filepath.EvalSymlinks(deviceLink)
+
+	if err != nil {
+		return "", false
+	}
+
+	root := filepath.Clean(l.sys)
+
+	for strings.HasPrefix(dir, root) && dir != root {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir, true
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	return "", false
+}
+
+func findLinkTo(linkDir string, target string) string {
+
+	links, err := filepath.Glob(filepath.Join(linkDir, "*"))
+
+	if err != nil {
+		return ""
+	}
+
+	resolvedTarget, err := filepath.EvalSymlinks(target)
+
+	if err != nil {
+		return ""
+	}
+
+	for _, link := range links {
+		resolved, err := filepath.EvalSymlinks(link)
+
+		if err == nil && resolved == resolvedTarget {
+			return link
+		}
+	}
+
+	return ""
+}
+
+func readSysfsString(path string) string {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+func readSysfsUint(path string, base int, bitSize int) (uint64, bool) {
+	value, err := strconv.ParseUint(readSysfsString(path), base, bitSize)
+	return value, err == nil
+}
+
+//---------------------------------------------------------------------------------------
+//SELECTOR MATCHING
+//---------------------------------------------------------------------------------------
+
+func matchesField(wanted string, actual string) bool {
+	return wanted == "" || wanted == actual
+}
+
+// matchesLink accepts either the whole path of an udev link or just its name.
+func matchesLink(wanted string, actual string) bool {
+	if wanted == "" {
+		return true
+	}
+
+	if actual == "" {
+		return false
+	}
+
+	return wanted == actual || wanted == filepath.Base(actual)
+}
@@ -0,0 +1,124 @@
+package webcam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeCamera is an USB camera plugged in a port, e.g. "1-2", with its video node
+type fakeCamera struct {
+	node    string
+	port    string
+	vendor  uint16
+	product uint16
+	serial  string
+}
+
+// newFakeSysfs builds sysfs and /dev of the cameras the way the kernel and udev
+// lay them out, in a temporary directory.
+func newFakeSysfs(t *testing.T, cameras ...fakeCamera) sysfsLayout {
+	t.Helper()
+
+	root := t.TempDir()
+	layout := sysfsLayout{sys: filepath.Join(root, "sys"), dev: filepath.Join(root, "dev")}
+
+	for i, camera := range cameras {
+		usbDir := filepath.Join(layout.sys, "devices", "pci0000:00", "0000:00:14.0", "usb1", camera.port)
+		interfaceDir := filepath.Join(usbDir, camera.port+":1.0")
+		nodeDir := filepath.Join(interfaceDir, "video4linux", camera.node)
+
+		writeFakeFile(t, filepath.Join(usbDir, "idVendor"), fmt.Sprintf("%04x\n", camera.vendor))
+		writeFakeFile(t, filepath.Join(usbDir, "idProduct"), fmt.Sprintf("%04x\n", camera.product))
+
+		if camera.serial != "" {
+			writeFakeFile(t, filepath.Join(usbDir, "serial"), camera.serial+"\n")
+		}
+
+		writeFakeFile(t, filepath.Join(nodeDir, "index"), "0\n")
+		linkFake(t, interfaceDir, filepath.Join(nodeDir, "device"))
+		linkFake(t, nodeDir, filepath.Join(layout.sys, "class", "video4linux", camera.node))
+
+		node := filepath.Join(layout.dev, camera.node)
+		writeFakeFile(t, node, "")
+		linkFake(t, node, filepath.Join(layout.dev, "v4l", "by-id", fmt.Sprintf("usb-Camera_%s-video-index0", camera.serial)))
+		linkFake(t, node, filepath.Join(layout.dev, "v4l", "by-path", fmt.Sprintf("pci-0000:00:14.0-usb-0:%d:1.0-video-index0", i+1)))
+	}
+
+	return layout
+}
+
+func writeFakeFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func linkFake(t *testing.T, target string, link string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadIdentityOfIdenticalCameras(t *testing.T) {
+	layout := newFakeSysfs(t,
+		fakeCamera{node: "video0", port: "1-1", vendor: 0x046d, product: 0x085c, serial: "A1"},
+		fakeCamera{node: "video2", port: "1-2", vendor: 0x046d, product: 0x085c, serial: "B2"},
+	)
+
+	infos := make([]WebcamInfo, 2)
+
+	for i, node := range []string{"video0", "video2"} {
+		infos[i] = WebcamInfo{Path: filepath.Join(layout.dev, node)}
+		layout.readIdentity(&infos[i])
+	}
+
+	expected := []WebcamInfo{
+		{
+			Path:      filepath.Join(layout.dev, "video0"),
+			VendorID:  0x046d,
+			ProductID: 0x085c,
+			Serial:    "A1",
+			ByID:      filepath.Join(layout.dev, "v4l", "by-id", "usb-Camera_A1-video-index0"),
+			ByPath:    filepath.Join(layout.dev, "v4l", "by-path", "pci-0000:00:14.0-usb-0:1:1.0-video-index0"),
+		},
+		{
+			Path:      filepath.Join(layout.dev, "video2"),
+			VendorID:  0x046d,
+			ProductID: 0x085c,
+			Serial:    "B2",
+			ByID:      filepath.Join(layout.dev, "v4l", "by-id", "usb-Camera_B2-video-index0"),
+			ByPath:    filepath.Join(layout.dev, "v4l", "by-path", "pci-0000:00:14.0-usb-0:2:1.0-video-index0"),
+		},
+	}
+
+	for i, info := range infos {
+		if info != expected[i] {
+			t.Errorf("Camera %d is %+v, expected %+v", i, info, expected[i])
+		}
+	}
+
+	//the serial tells the cameras apart although vendor and product are the same
+	for i, info := range infos {
+		selector := reconnectSelector(info)
+
+		for j, other := range infos {
+			if selector.Matches(other) != (i == j) {
+				t.Errorf("Selector %v of camera %d matches camera %d: %v", selector, i, j, !(i == j))
+			}
+		}
+	}
+}
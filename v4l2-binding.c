@@ -1,9 +1,12 @@
 #include "v4l2-binding.h"
 #include<sys/ioctl.h>
 #include<sys/mman.h>
+#include<poll.h>
 #include<string.h>
 #include<stdio.h>
 #include<errno.h>
+#include<fcntl.h>
+#include<time.h>
 
 struct v4l2_capability *queryCapability(int fd) {
     struct v4l2_capability* cap = malloc(sizeof(struct v4l2_capability));
@@ -11,23 +14,12 @@ struct v4l2_capability *queryCapability(int fd) {
     return cap;
 }
 
-struct v4l2_fmtdesc* queryFormats(int fd, struct v4l2_fmtdesc* desc) {
-    if (desc == NULL) {
-        desc = malloc(sizeof(struct v4l2_fmtdesc));
-        desc->index = 0;
-        desc->type = V4L2_BUF_TYPE_VIDEO_CAPTURE;
-    } else {
-        desc->index++;
-    }
+int enumFormat(int fd, __u32 type, __u32 index, struct v4l2_fmtdesc* desc) {
+    memset(desc, 0, sizeof(struct v4l2_fmtdesc));
+    desc->index = index;
+    desc->type = type;
 
-    int r = ioctl(fd, VIDIOC_ENUM_FMT, desc);
-
-    if (errno == EINVAL) {
-        free(desc);
-        return NULL;
-    }
-
-    return desc;    
+    return ioctl(fd, VIDIOC_ENUM_FMT, desc);
 }
 
 struct v4l2_frmsizeenum* queryFramesizes(int fd, __u32 pixformat, struct v4l2_frmsizeenum* info) {
@@ -50,50 +42,142 @@ struct v4l2_frmsizeenum* queryFramesizes(int fd, __u32 pixformat, struct v4l2_fr
     return info;
 }
 
-void setDiscreteFrameSize(int fd, __u32 pixformat, __u32 width, __u32 height) {
+int queryFrameInterval(int fd, __u32 index, __u32 pixformat, __u32 width, __u32 height, struct v4l2_frmivalenum* info) {
+    memset(info, 0, sizeof(struct v4l2_frmivalenum));
+    info->index = index;
+    info->pixel_format = pixformat;
+    info->width = width;
+    info->height = height;
+
+    return ioctl(fd, VIDIOC_ENUM_FRAMEINTERVALS, info);
+}
+
+int setFormat(int fd, __u32 type, __u32 pixformat, __u32 width, __u32 height, struct v4l2_format* format) {
+    memset(format, 0, sizeof(struct v4l2_format));
+    format->type = type;
+
+    if (type == V4L2_BUF_TYPE_VIDEO_CAPTURE_MPLANE) {
+        format->fmt.pix_mp.pixelformat = pixformat;
+        format->fmt.pix_mp.width = width;
+        format->fmt.pix_mp.height = height;
+        format->fmt.pix_mp.field = V4L2_FIELD_ANY;
+    } else {
+        format->fmt.pix.pixelformat = pixformat;
+        format->fmt.pix.width = width;
+        format->fmt.pix.height = height;
+    }
+
+    return ioctl(fd, VIDIOC_S_FMT, format);
+}
+
+int getFormat(int fd, __u32 type, struct v4l2_format* format) {
+    memset(format, 0, sizeof(struct v4l2_format));
+    format->type = type;
+
+    return ioctl(fd, VIDIOC_G_FMT, format);
+}
 
-    struct v4l2_format format;
-    format.type = V4L2_BUF_TYPE_VIDEO_CAPTURE;
-    format.fmt.pix.pixelformat = pixformat;
-    format.fmt.pix.width = width;
-    format.fmt.pix.height = height;
+int getFrameInterval(int fd, __u32 type, struct v4l2_captureparm* capture) {
+    struct v4l2_streamparm parm;
+    memset(&parm, 0, sizeof(struct v4l2_streamparm));
+    parm.type = type;
 
-    ioctl(fd, VIDIOC_S_FMT, &format);
+    int result = ioctl(fd, VIDIOC_G_PARM, &parm);
+    *capture = parm.parm.capture;
+
+    return result;
 }
 
-void requestBuffer(int fd) {
+int setFrameInterval(int fd, __u32 type, struct v4l2_fract* interval) {
+    struct v4l2_streamparm parm;
+    memset(&parm, 0, sizeof(struct v4l2_streamparm));
+    parm.type = type;
+    parm.parm.capture.timeperframe = *interval;
+
+    int result = ioctl(fd, VIDIOC_S_PARM, &parm);
+    *interval = parm.parm.capture.timeperframe;
+
+    return result;
+}
+
+int requestBuffers(int fd, __u32 type, __u32 memory, __u32 count, __u32* granted) {
 
     struct v4l2_requestbuffers request;
-    request.type = V4L2_BUF_TYPE_VIDEO_CAPTURE;
-    request.memory = V4L2_MEMORY_MMAP;
-    request.count = 1;
+    memset(&request, 0, sizeof(struct v4l2_requestbuffers));
+    request.type = type;
+    request.memory = memory;
+    request.count = count;
 
-    ioctl(fd, VIDIOC_REQBUFS, &request);
+    int result = ioctl(fd, VIDIOC_REQBUFS, &request);
+    *granted = request.count;
 
+    return result;
 }
 
-struct v4l2_buffer* queryBuffer(int fd) {
-    struct v4l2_buffer* buffer = malloc(sizeof(struct v4l2_buffer));
+void initBuffer(struct v4l2_buffer* buffer, __u32 type, __u32 memory, __u32 index, struct v4l2_plane* planes) {
     memset(buffer, 0, sizeof(struct v4l2_buffer));
+    buffer->type = type;
+    buffer->memory = memory;
+    buffer->index = index;
+
+    if (type == V4L2_BUF_TYPE_VIDEO_CAPTURE_MPLANE) {
+        memset(planes, 0, sizeof(struct v4l2_plane) * VIDEO_MAX_PLANES);
+        buffer->m.planes = planes;
+        buffer->length = VIDEO_MAX_PLANES;
+    }
+}
+
+void setUserptr(struct v4l2_buffer* buffer, __u32 plane, unsigned long userptr, __u32 length) {
+    if (buffer->type == V4L2_BUF_TYPE_VIDEO_CAPTURE_MPLANE) {
+        buffer->m.planes[plane].m.userptr = userptr;
+        buffer->m.planes[plane].length = length;
+    } else {
+        buffer->m.userptr = userptr;
+        buffer->length = length;
+    }
+}
 
-    buffer->type = V4L2_BUF_TYPE_VIDEO_CAPTURE;
-    buffer->memory = V4L2_MEMORY_MMAP;
-    buffer->index = 0;
+void setDMABuf(struct v4l2_buffer* buffer, __u32 plane, int fd, __u32 length) {
+    if (buffer->type == V4L2_BUF_TYPE_VIDEO_CAPTURE_MPLANE) {
+        buffer->m.planes[plane].m.fd = fd;
+        buffer->m.planes[plane].length = length;
+    } else {
+        buffer->m.fd = fd;
+        buffer->length = length;
+    }
+}
+
+struct v4l2_plane* newPlanes() {
+    return calloc(VIDEO_MAX_PLANES, sizeof(struct v4l2_plane));
+}
 
+int exportBuffer(int fd, __u32 type, __u32 index, __u32 plane, int* dmabuf) {
+    struct v4l2_exportbuffer export;
+    memset(&export, 0, sizeof(struct v4l2_exportbuffer));
+    export.type = type;
+    export.index = index;
+    export.plane = plane;
+    export.flags = O_RDONLY | O_CLOEXEC;
+
+    int result = ioctl(fd, VIDIOC_EXPBUF, &export);
+    *dmabuf = export.fd;
+
+    return result;
+}
+
+void queryBuffer(int fd, struct v4l2_buffer* buffer) {
     ioctl(fd, VIDIOC_QUERYBUF, buffer);
-	
-    return buffer;
 }
 
-void* mmap2(int fd, struct v4l2_buffer* buf) {
+void* mmap2(int fd, __u32 length, __u32 offset) {
 
-    void* buff_start = mmap(NULL, buf->length, PROT_READ | PROT_WRITE, MAP_SHARED, fd, buf->m.offset);
+    void* buff_start = mmap(NULL, length, PROT_READ | PROT_WRITE, MAP_SHARED, fd, offset);
 
     if (buff_start == MAP_FAILED) {
         return 0;
     }
 
-    memset(buff_start, 0, buf->length);
+    memset(buff_start, 0, length);
     return buff_start;
 }
 
@@ -101,16 +185,6 @@ void munmap2(void* mem_adr, uint length) {
     munmap(mem_adr, length);   
 }
 
-struct v4l2_buffer* newBuffer() {
-
-    struct v4l2_buffer* buffer = malloc(sizeof(struct v4l2_buffer));
-    buffer->type = V4L2_BUF_TYPE_VIDEO_CAPTURE;
-    buffer->memory = V4L2_MEMORY_MMAP;
-    buffer->index = 0;
-
-    return buffer;
-}
-
 void queueBuffer(int fd, struct v4l2_buffer* buff) {
     ioctl(fd, VIDIOC_QBUF, buff);
 }
@@ -119,12 +193,164 @@ void dequeueBuffer(int fd, struct v4l2_buffer* buff) {
     ioctl(fd, VIDIOC_DQBUF, buff);
 }
 
-void streamOn(int fd) {
-    __u32 type = V4L2_BUF_TYPE_VIDEO_CAPTURE;
+void streamOn(int fd, __u32 type) {
     ioctl(fd, VIDIOC_STREAMON, &type);
 }
 
-void streamOff(int fd) {
-    __u32 type = V4L2_BUF_TYPE_VIDEO_CAPTURE;
+void streamOff(int fd, __u32 type) {
     ioctl(fd, VIDIOC_STREAMOFF, &type);
-}
\ No newline at end of file
+}
+
+int pollDevice(int fd, short events, int timeout, short* revents) {
+    struct pollfd descriptor;
+    descriptor.fd = fd;
+    descriptor.events = events;
+    descriptor.revents = 0;
+
+    int result = poll(&descriptor, 1, timeout);
+    *revents = descriptor.revents;
+
+    return result;
+}
+
+int subscribeEvent(int fd, __u32 type, __u32 id) {
+    struct v4l2_event_subscription subscription;
+    memset(&subscription, 0, sizeof(struct v4l2_event_subscription));
+    subscription.type = type;
+    subscription.id = id;
+
+    return ioctl(fd, VIDIOC_SUBSCRIBE_EVENT, &subscription);
+}
+
+int unsubscribeEvent(int fd, __u32 type, __u32 id) {
+    struct v4l2_event_subscription subscription;
+    memset(&subscription, 0, sizeof(struct v4l2_event_subscription));
+    subscription.type = type;
+    subscription.id = id;
+
+    return ioctl(fd, VIDIOC_UNSUBSCRIBE_EVENT, &subscription);
+}
+
+int unsubscribeEvents(int fd) {
+    struct v4l2_event_subscription subscription;
+    memset(&subscription, 0, sizeof(struct v4l2_event_subscription));
+    subscription.type = V4L2_EVENT_ALL;
+
+    return ioctl(fd, VIDIOC_UNSUBSCRIBE_EVENT, &subscription);
+}
+
+int dequeueEvent(int fd, struct v4l2_event* event) {
+    memset(event, 0, sizeof(struct v4l2_event));
+
+    return ioctl(fd, VIDIOC_DQEVENT, event);
+}
+
+__s64 monotonicNow() {
+    struct timespec now;
+    clock_gettime(CLOCK_MONOTONIC, &now);
+
+    return (__s64)now.tv_sec * 1000000000 + now.tv_nsec;
+}
+
+
+int queryControl(int fd, __u32 id, struct v4l2_queryctrl* ctrl) {
+    memset(ctrl, 0, sizeof(struct v4l2_queryctrl));
+    ctrl->id = id;
+
+    return ioctl(fd, VIDIOC_QUERYCTRL, ctrl);
+}
+
+int queryMenu(int fd, __u32 id, __u32 index, struct v4l2_querymenu* item) {
+    memset(item, 0, sizeof(struct v4l2_querymenu));
+    item->id = id;
+    item->index = index;
+
+    return ioctl(fd, VIDIOC_QUERYMENU, item);
+}
+
+int getControl(int fd, __u32 id, __s32* value) {
+    struct v4l2_control control;
+    memset(&control, 0, sizeof(struct v4l2_control));
+    control.id = id;
+
+    int result = ioctl(fd, VIDIOC_G_CTRL, &control);
+    *value = control.value;
+
+    return result;
+}
+
+int setControl(int fd, __u32 id, __s32 value) {
+    struct v4l2_control control;
+    memset(&control, 0, sizeof(struct v4l2_control));
+    control.id = id;
+    control.value = value;
+
+    return ioctl(fd, VIDIOC_S_CTRL, &control);
+}
+
+int queryExtControl(int fd, __u32 id, struct v4l2_query_ext_ctrl* ctrl) {
+    memset(ctrl, 0, sizeof(struct v4l2_query_ext_ctrl));
+    ctrl->id = id;
+
+    return ioctl(fd, VIDIOC_QUERY_EXT_CTRL, ctrl);
+}
+
+struct v4l2_ext_control* newExtControls(__u32 count) {
+    return calloc(count, sizeof(struct v4l2_ext_control));
+}
+
+// v4l2_ext_control is packed, its fields are accessed here rather than from Go
+
+void setExtValue(struct v4l2_ext_control* controls, __u32 index, __u32 id, __s64 value, int is64) {
+    controls[index].id = id;
+
+    if (is64) {
+        controls[index].value64 = value;
+    } else {
+        controls[index].value = (__s32)value;
+    }
+}
+
+void setExtPayload(struct v4l2_ext_control* controls, __u32 index, __u32 id, void* payload, __u32 size) {
+    controls[index].id = id;
+    controls[index].size = size;
+    controls[index].ptr = payload;
+}
+
+__s64 extValue(struct v4l2_ext_control* controls, __u32 index, int is64) {
+    if (is64) {
+        return controls[index].value64;
+    }
+    return controls[index].value;
+}
+
+__u32 extSize(struct v4l2_ext_control* controls, __u32 index) {
+    return controls[index].size;
+}
+
+void setExtSize(struct v4l2_ext_control* controls, __u32 index, __u32 size) {
+    controls[index].size = size;
+}
+
+__u32 extID(struct v4l2_ext_control* controls, __u32 index) {
+    return controls[index].id;
+}
+
+void* extPayload(struct v4l2_ext_control* controls, __u32 index) {
+    return controls[index].ptr;
+}
+
+// op is 0 for VIDIOC_G_EXT_CTRLS, 1 for VIDIOC_S_EXT_CTRLS and 2 for VIDIOC_TRY_EXT_CTRLS
+int extControls(int fd, int op, __u32 which, __u32 count, struct v4l2_ext_control* controls, __u32* error_idx) {
+    struct v4l2_ext_controls request;
+    memset(&request, 0, sizeof(struct v4l2_ext_controls));
+    request.which = which;
+    request.count = count;
+    request.controls = controls;
+
+    unsigned long requests[] = {VIDIOC_G_EXT_CTRLS, VIDIOC_S_EXT_CTRLS, VIDIOC_TRY_EXT_CTRLS};
+    int result = ioctl(fd, requests[op], &request);
+    *error_idx = request.error_idx;
+
+    return result;
+}
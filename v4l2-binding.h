@@ -1,5 +1,6 @@
 #include<stdlib.h>
 #include<linux/videodev2.h>
+#include<poll.h>
 
 struct frmsize_node {
     struct v4l2_frmsizeenum* value;
@@ -8,26 +9,82 @@ struct frmsize_node {
 
 struct v4l2_capability *queryCapability(int fd);
 
-struct v4l2_fmtdesc* queryFormats(int fd, struct v4l2_fmtdesc* desc);
+int enumFormat(int fd, __u32 type, __u32 index, struct v4l2_fmtdesc* desc);
 
 struct v4l2_frmsizeenum* queryFramesizes(int fd, __u32 fixformat, struct v4l2_frmsizeenum* info);
 
-void setDiscreteFrameSize(int fd, __u32 pixformat, __u32 width, __u32 height);
+int queryFrameInterval(int fd, __u32 index, __u32 pixformat, __u32 width, __u32 height, struct v4l2_frmivalenum* info);
 
-void requestBuffer(int fd);
+int setFormat(int fd, __u32 type, __u32 pixformat, __u32 width, __u32 height, struct v4l2_format* format);
 
-struct v4l2_buffer* queryBuffer(int fd);
+int getFormat(int fd, __u32 type, struct v4l2_format* format);
 
-void* mmap2(int fd, struct v4l2_buffer* buff);
+int getFrameInterval(int fd, __u32 type, struct v4l2_captureparm* capture);
 
-void munmap2(void* mem_adr, uint length);
+int setFrameInterval(int fd, __u32 type, struct v4l2_fract* interval);
+
+int requestBuffers(int fd, __u32 type, __u32 memory, __u32 count, __u32* granted);
+
+void initBuffer(struct v4l2_buffer* buffer, __u32 type, __u32 memory, __u32 index, struct v4l2_plane* planes);
+
+void setUserptr(struct v4l2_buffer* buffer, __u32 plane, unsigned long userptr, __u32 length);
+
+void setDMABuf(struct v4l2_buffer* buffer, __u32 plane, int fd, __u32 length);
+
+struct v4l2_plane* newPlanes();
+
+int exportBuffer(int fd, __u32 type, __u32 index, __u32 plane, int* dmabuf);
+
+void queryBuffer(int fd, struct v4l2_buffer* buffer);
 
-struct v4l2_buffer* newBuffer();
+void* mmap2(int fd, __u32 length, __u32 offset);
+
+void munmap2(void* mem_adr, uint length);
 
 void queueBuffer(int fd, struct v4l2_buffer* buff);
 
 void dequeueBuffer(int fd, struct v4l2_buffer* buff);
 
-void streamOn(int fd);
+void streamOn(int fd, __u32 type);
+
+void streamOff(int fd, __u32 type);
+
+int pollDevice(int fd, short events, int timeout, short* revents);
+
+int subscribeEvent(int fd, __u32 type, __u32 id);
+
+int unsubscribeEvent(int fd, __u32 type, __u32 id);
+
+int unsubscribeEvents(int fd);
+
+int dequeueEvent(int fd, struct v4l2_event* event);
+
+__s64 monotonicNow();
+
+int queryControl(int fd, __u32 id, struct v4l2_queryctrl* ctrl);
+
+int queryMenu(int fd, __u32 id, __u32 index, struct v4l2_querymenu* item);
+
+int getControl(int fd, __u32 id, __s32* value);
+
+int setControl(int fd, __u32 id, __s32 value);
+
+int queryExtControl(int fd, __u32 id, struct v4l2_query_ext_ctrl* ctrl);
+
+struct v4l2_ext_control* newExtControls(__u32 count);
+
+void setExtValue(struct v4l2_ext_control* controls, __u32 index, __u32 id, __s64 value, int is64);
+
+void setExtPayload(struct v4l2_ext_control* controls, __u32 index, __u32 id, void* payload, __u32 size);
+
+__s64 extValue(struct v4l2_ext_control* controls, __u32 index, int is64);
+
+__u32 extSize(struct v4l2_ext_control* controls, __u32 index);
+
+void setExtSize(struct v4l2_ext_control* controls, __u32 index, __u32 size);
+
+__u32 extID(struct v4l2_ext_control* controls, __u32 index);
+
+void* extPayload(struct v4l2_ext_control* controls, __u32 index);
 
-void streamOff(int fd);
\ No newline at end of file
+int extControls(int fd, int op, __u32 which, __u32 count, struct v4l2_ext_control* controls, __u32* error_idx);
\ No newline at end of file
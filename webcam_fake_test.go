@@ -0,0 +1,93 @@
+package webcam
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// testFrameSize is the YUYV frame size of 8x4 pixels the fakes capture
+func testFrameSize(t testing.TB) *DiscreteFrameSize {
+	code, err := ParseFourCC("YUYV")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &DiscreteFrameSize{PixelFormat: newPixelFormat(code, "YUYV"), Width: 8, Height: 4}
+}
+
+// fakeControlCam is a webcam that only has controls, calling anything else
+// panics. Every SetControl is recorded.
+type fakeControlCam struct {
+	Webcam
+
+	mu       sync.Mutex
+	controls []Control
+	values   map[ControlID]int32
+	sets     []ControlValue
+	failures map[ControlID]error
+}
+
+func newFakeControlCam(controls ...Control) *fakeControlCam {
+	cam := &fakeControlCam{controls: controls, values: map[ControlID]int32{}, failures: map[ControlID]error{}}
+
+	for _, control := range controls {
+		cam.values[control.ID] = int32(control.Default)
+	}
+
+	return cam
+}
+
+func (c *fakeControlCam) Info() WebcamInfo {
+	return WebcamInfo{Path: "/dev/video-fake"}
+}
+
+func (c *fakeControlCam) QueryControls() ([]Control, error) {
+	return c.controls, nil
+}
+
+func (c *fakeControlCam) GetControl(id ControlID) (int32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.values[id]
+
+	if !ok {
+		return 0, fmt.Errorf("No control %v.", id)
+	}
+
+	return value, nil
+}
+
+func (c *fakeControlCam) SetControl(id ControlID, value int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[id]; !ok {
+		return fmt.Errorf("No control %v.", id)
+	}
+
+	if err := c.failures[id]; err != nil {
+		return err
+	}
+
+	c.values[id] = value
+	c.sets = append(c.sets, ControlValue{ID: id, Value: int64(value)})
+	return nil
+}
+
+// recorded returns the values set so far.
+func (c *fakeControlCam) recorded() []ControlValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]ControlValue(nil), c.sets...)
+}
+
+func (c *fakeControlCam) value(id ControlID) int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[id]
+}
@@ -0,0 +1,196 @@
+package webcam
+
+// #include "v4l2-binding.h"
+import "C"
+
+import (
+	"fmt"
+	"image"
+)
+
+//-------------------------------------------------------------------------------------
+//LAYOUT OF 4:2:0 FORMATS
+//-------------------------------------------------------------------------------------
+
+// yuv420Layout tells how a 4:2:0 format stores its chroma.
+type yuv420Layout struct {
+	//chroma is interleaved in a single plane, as in NV12
+	interleaved bool
+	//Cr comes before Cb, as in NV21 or YVU420
+	swapped bool
+	//every component lives in its own plane of the buffer
+	multiPlanar bool
+}
+
+var yuv420Layouts = map[FourCC]yuv420Layout{
+	C.V4L2_PIX_FMT_NV12:    {interleaved: true},
+	C.V4L2_PIX_FMT_NV21:    {interleaved: true, swapped: true},
+	C.V4L2_PIX_FMT_NV12M:   {interleaved: true, multiPlanar: true},
+	C.V4L2_PIX_FMT_NV21M:   {interleaved: true, swapped: true, multiPlanar: true},
+	C.V4L2_PIX_FMT_YUV420:  {},
+	C.V4L2_PIX_FMT_YVU420:  {swapped: true},
+	C.V4L2_PIX_FMT_YUV420M: {multiPlanar: true},
+	C.V4L2_PIX_FMT_YVU420M: {swapped: true, multiPlanar: true},
+}
+
+//-------------------------------------------------------------------------------------
+//DECODING
+//-------------------------------------------------------------------------------------
+
+func decodeYCbCr(snap Snapshot, frameSize DiscreteFrameSize) (*image.YCbCr, error) {
+
+	if frameSize.PixelFormat == nil {
+		return nil, fmt.Errorf("Frame size %dx%d has no pixel format.", frameSize.Width, frameSize.Height)
+	}
+
+	code := frameSize.PixelFormat.FourCC()
+	layout, ok := yuv420Layouts[code]
+
+	if !ok {
+		return nil, fmt.Errorf("Pixel format %v cannot be decoded as 4:2:0 YUV.", code)
+	}
+
+	width := int(frameSize.Width)
+	height := int(frameSize.Height)
+	chromaWidth := (width + 1) / 2
+	chromaHeight := (height + 1) / 2
+
+	planes, strides := splitPlanes(snap, layout, width, height)
+
+	if len(planes) == 0 {
+		return nil, fmt.Errorf("Snapshot does not contain planes of %v.", code)
+	}
+
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+
+	if !copyRows(img.Y, img.YStride, planes[0], strides[0], width, height) {
+		return nil, fmt.Errorf("Luma plane of %v is too short for %dx%d.", code, width, height)
+	}
+
+	cb, cr := img.Cb, img.Cr
+
+	if layout.swapped {
+		cb, cr = cr, cb
+	}
+
+	if layout.interleaved {
+		if len(planes) < 2 || !deinterleaveRows(cb, cr, img.CStride, planes[1], strides[1], chromaWidth, chromaHeight) {
+			return nil, fmt.Errorf("Chroma plane of %v is too short for %dx%d.", code, width, height)
+		}
+		return img, nil
+	}
+
+	if len(planes) < 3 ||
+		!copyRows(cb, img.CStride, planes[1], strides[1], chromaWidth, chromaHeight) ||
+		!copyRows(cr, img.CStride, planes[2], strides[2], chromaWidth, chromaHeight) {
+		return nil, fmt.Errorf("Chroma planes of %v are too short for %dx%d.", code, width, height)
+	}
+
+	return img, nil
+}
+
+// splitPlanes returns the planes of the snapshot with their strides. Planes of
+// single-planar formats follow each other in the data, their strides are derived
+// from the stride of the luma plane.
+func splitPlanes(snap Snapshot, layout yuv420Layout, width int, height int) ([][]byte, []int) {
+
+	strides := []int{}
+
+	for _, s := range snap.Strides() {
+		strides = append(strides, int(s))
+	}
+
+	if layout.multiPlanar {
+		planes := snap.Planes()
+
+		for i := range planes {
+			if i >= len(strides) {
+				strides = append(strides, 0)
+			}
+
+			if strides[i] == 0 {
+				strides[i] = defaultStride(layout, i, width)
+			}
+		}
+
+		return planes, strides
+	}
+
+	lumaStride := width
+
+	if len(strides) > 0 && strides[0] > 0 {
+		lumaStride = strides[0]
+	}
+
+	data := snap.Data()
+	chromaHeight := (height + 1) / 2
+
+	if layout.interleaved {
+		return sliceAt(data, lumaStride*height), []int{lumaStride, lumaStride}
+	}
+
+	chromaStride := lumaStride / 2
+	parts := sliceAt(data, lumaStride*height, lumaStride*height+chromaStride*chromaHeight)
+
+	return parts, []int{lumaStride, chromaStride, chromaStride}
+}
+
+func defaultStride(layout yuv420Layout, plane int, width int) int {
+	if plane == 0 {
+		return width
+	}
+
+	//interleaved chroma holds a pair of samples for every two pixels, also
+	//for the last odd one
+	if layout.interleaved {
+		return 2 * ((width + 1) / 2)
+	}
+
+	return (width + 1) / 2
+}
+
+// sliceAt splits the data at the given offsets, offsets beyond the data yield
+// empty parts.
+func sliceAt(data []byte, offsets ...int) [][]byte {
+	parts := [][]byte{}
+	start := 0
+
+	for _, offset := range offsets {
+		if offset > len(data) {
+			offset = len(data)
+		}
+		parts = append(parts, data[start:offset])
+		start = offset
+	}
+
+	return append(parts, data[start:])
+}
+
+func copyRows(dst []byte, dstStride int, src []byte, srcStride int, width int, height int) bool {
+	for y := 0; y < height; y++ {
+		start := y * srcStride
+
+		if start+width > len(src) {
+			return false
+		}
+
+		copy(dst[y*dstStride:], src[start:start+width])
+	}
+	return true
+}
+
+func deinterleaveRows(first []byte, second []byte, dstStride int, src []byte, srcStride int, width int, height int) bool {
+	for y := 0; y < height; y++ {
+		row := y * srcStride
+
+		if row+2*width > len(src) {
+			return false
+		}
+
+		for x := 0; x < width; x++ {
+			first[y*dstStride+x] = src[row+2*x]
+			second[y*dstStride+x] = src[row+2*x+1]
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package webcam
+
+import "testing"
+
+func TestDefaultStride(t *testing.T) {
+	nv12 := yuv420Layout{interleaved: true, multiPlanar: true}
+	yuv420 := yuv420Layout{multiPlanar: true}
+
+	tests := []struct {
+		name     string
+		layout   yuv420Layout
+		plane    int
+		width    int
+		expected int
+	}{
+		{"interleaved luma", nv12, 0, 641, 641},
+		{"interleaved chroma", nv12, 1, 640, 640},
+		{"interleaved chroma of odd width", nv12, 1, 641, 642},
+		{"planar luma", yuv420, 0, 641, 641},
+		{"planar chroma", yuv420, 1, 640, 320},
+		{"planar chroma of odd width", yuv420, 2, 641, 321},
+	}
+
+	for _, test := range tests {
+		if stride := defaultStride(test.layout, test.plane, test.width); stride != test.expected {
+			t.Errorf("%s: stride is %d, expected %d", test.name, stride, test.expected)
+		}
+	}
+}